@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/wallet/audit"
+	"github.com/spolia/lemon-wallet/internal/wallet/auth"
+	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+)
+
+// searchUsers returns a page of the users whose alias, email or name contain the q parameter
+func searchUsers(service Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit, err := strconv.ParseUint(ctx.DefaultQuery("limit", "0"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "limit", "must be a non negative integer")
+			return
+		}
+
+		offset, err := strconv.ParseUint(ctx.DefaultQuery("offset", "0"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "offset", "must be a non negative integer")
+			return
+		}
+
+		users, err := service.SearchUsers(ctx.Request.Context(), ctx.Query("q"), limit, offset)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusOK, users)
+	}
+}
+
+// freezeUser freezes or unfreezes, depending on the service method, the wallet of the user
+func freezeUser(setFrozen func(ctx context.Context, id int64) error) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "id", "must be an integer")
+			return
+		}
+
+		if err = setFrozen(ctx.Request.Context(), userID); err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// createAdjustment corrects the balance of a user. The admin making the request is recorded as the actor
+func createAdjustment(service Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var adjustmentRequest movement.Adjustment
+		if err := bindJSON(ctx, &adjustmentRequest); err != nil {
+			abortWithBindError(ctx, err)
+			return
+		}
+
+		identity, _ := auth.FromContext(ctx.Request.Context())
+		adjustmentRequest.ActorID = identity.UserID
+
+		adjustmentResult, err := service.Adjust(ctx.Request.Context(), adjustmentRequest)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, adjustmentResult)
+	}
+}
+
+// searchAuditEvents returns a page of the audit events, newest first, filtered by actor, action, target and date
+func searchAuditEvents(service Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorID, err := parseID(ctx.Query("actorid"))
+		if err != nil {
+			abortWithInvalidParameter(ctx, "actorid", "must be an integer")
+			return
+		}
+
+		targetID, err := parseID(ctx.Query("targetid"))
+		if err != nil {
+			abortWithInvalidParameter(ctx, "targetid", "must be an integer")
+			return
+		}
+
+		limit, err := strconv.ParseUint(ctx.DefaultQuery("limit", "0"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "limit", "must be a non negative integer")
+			return
+		}
+
+		offset, err := strconv.ParseUint(ctx.DefaultQuery("offset", "0"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "offset", "must be a non negative integer")
+			return
+		}
+
+		var filter = audit.Filter{
+			ActorID:    actorID,
+			Action:     ctx.Query("action"),
+			TargetType: ctx.Query("targettype"),
+			TargetID:   targetID,
+			Limit:      limit,
+			Offset:     offset,
+		}
+
+		if filter.From, err = parseTime(ctx.Query("from")); err != nil {
+			abortWithInvalidParameter(ctx, "from", "must be a RFC 3339 timestamp or a date")
+			return
+		}
+
+		if filter.To, err = parseTime(ctx.Query("to")); err != nil {
+			abortWithInvalidParameter(ctx, "to", "must be a RFC 3339 timestamp or a date")
+			return
+		}
+
+		events, err := service.AuditEvents(ctx.Request.Context(), filter)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusOK, events)
+	}
+}
+
+// parseID reads an optional id, zero when it is empty
+func parseID(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
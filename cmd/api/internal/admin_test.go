@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/requestid"
+	"github.com/spolia/lemon-wallet/internal/wallet"
+	"github.com/spolia/lemon-wallet/internal/wallet/audit"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Handler_API_searchUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Token, URL string
+		ExpectedStatus       int
+		Error                error
+	}{
+		{"Ok", adminToken, "/admin/users?q=maria&limit=10&offset=20", http.StatusOK, nil},
+		{"NotAdmin", userToken, "/admin/users?q=maria&limit=10&offset=20", http.StatusForbidden, nil},
+		{"WrongLimit", adminToken, "/admin/users?limit=ten", http.StatusBadRequest, nil},
+		{"InternalServerError", adminToken, "/admin/users?q=maria&limit=10&offset=20", http.StatusInternalServerError, errors.New("fail")},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+		service.On("SearchUsers", "maria", uint64(10), uint64(20)).Return([]user.User{{ID: 1, Alias: "maria", Frozen: true}}, tc.Error)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		request, err := http.NewRequest(http.MethodGet, tc.URL, nil)
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+tc.Token)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+		if tc.ExpectedStatus == http.StatusOK {
+			require.JSONEq(t, `[{"id":1,"firstname":"","lastname":"","alias":"maria","email":"","frozen":true,"walletstatement":null}]`,
+				rr.Body.String())
+		}
+	}
+}
+
+func Test_Handler_API_freezeUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Token, URL, Method string
+		ExpectedStatus               int
+		Error                        error
+	}{
+		{"Freeze", adminToken, "/admin/users/1/freeze", "FreezeUser", http.StatusNoContent, nil},
+		{"Unfreeze", adminToken, "/admin/users/1/unfreeze", "UnfreezeUser", http.StatusNoContent, nil},
+		{"NotAdmin", userToken, "/admin/users/1/freeze", "FreezeUser", http.StatusForbidden, nil},
+		{"WrongID", adminToken, "/admin/users/one/freeze", "FreezeUser", http.StatusBadRequest, nil},
+		{"ErrorUserNotFound", adminToken, "/admin/users/1/freeze", "FreezeUser", http.StatusNotFound, user.ErrorUserNotFound},
+		{"InternalServerError", adminToken, "/admin/users/1/unfreeze", "UnfreezeUser", http.StatusInternalServerError, errors.New("fail")},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+		service.On(tc.Method, int64(1)).Return(tc.Error)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		request, err := http.NewRequest(http.MethodPost, tc.URL, nil)
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+tc.Token)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+	}
+}
+
+func Test_Handler_API_createAdjustment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Token, Filename string
+		ExpectedStatus            int
+		Error                     error
+	}{
+		{"Ok", adminToken, "create_adjustment_ok", http.StatusCreated, nil},
+		{"NotAdmin", userToken, "create_adjustment_ok", http.StatusForbidden, nil},
+		{"NoReason", adminToken, "create_adjustment_no_reason", http.StatusBadRequest, nil},
+		{"ErrorInsufficientBalance", adminToken, "create_adjustment_ok", http.StatusBadRequest, movement.ErrorInsufficientBalance},
+		{"InternalServerError", adminToken, "create_adjustment_ok", http.StatusInternalServerError, errors.New("fail")},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+		// the actor is the admin of the token, whatever the body says
+		service.On("Adjust", mock.MatchedBy(func(adjustment movement.Adjustment) bool {
+			return adjustment.ActorID == 3 && adjustment.Reason == "duplicated deposit"
+		})).Return(movement.Adjustment{ID: 9}, tc.Error)
+		service.On("GetCurrency", "usdt").Return(currency.Currency{Name: "USDT", Digits: 2}, nil)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+		body, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s.json", tc.Filename))
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/admin/adjustments", bytes.NewReader(body))
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+tc.Token)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+	}
+}
+
+func Test_Handler_API_searchAuditEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Token, URL string
+		ExpectedStatus       int
+		Error                error
+	}{
+		{"Ok", adminToken, "/admin/audit?actorid=3&targettype=user&targetid=1&from=2022-03-01&limit=10", http.StatusOK, nil},
+		{"NotAdmin", userToken, "/admin/audit?actorid=3&targettype=user&targetid=1&from=2022-03-01&limit=10", http.StatusForbidden, nil},
+		{"WrongTarget", adminToken, "/admin/audit?targetid=one", http.StatusBadRequest, nil},
+		{"WrongDate", adminToken, "/admin/audit?from=yesterday", http.StatusBadRequest, nil},
+		{"ErrorAuditUnavailable", adminToken, "/admin/audit?actorid=3&targettype=user&targetid=1&from=2022-03-01&limit=10",
+			http.StatusServiceUnavailable, wallet.ErrorAuditUnavailable},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+		service.On("AuditEvents", audit.Filter{ActorID: 3, TargetType: audit.TargetUser, TargetID: 1,
+			From: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), Limit: 10}).
+			Return([]audit.Event{{ID: 7, ActorID: 3, Action: audit.ActionWalletFrozen}}, tc.Error)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		request, err := http.NewRequest(http.MethodGet, tc.URL, nil)
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+tc.Token)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+	}
+}
+
+func Test_Handler_API_RequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, RequestID string
+		Generated           bool
+	}{
+		{"FromHeader", "req-1", false},
+		{"Missing", "", true},
+		{"TooLong", strings.Repeat("a", 65), true},
+	}
+
+	for _, tc := range tt {
+		// When
+		var bound string
+		router := gin.Default()
+		API(router, &serviceMock{}, nil, newAuthenticatorMock(), logging.Discard())
+		router.GET("/probe", func(ctx *gin.Context) {
+			bound = requestid.FromContext(ctx.Request.Context())
+		})
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/probe", nil)
+		assert.NoError(t, err)
+		request.Header.Set(requestid.Header, tc.RequestID)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, bound, rr.Header().Get(requestid.Header), tc.TestName)
+		if tc.Generated {
+			require.Len(t, bound, 32, tc.TestName)
+		} else {
+			require.Equal(t, tc.RequestID, bound, tc.TestName)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/wallet/auth"
+)
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, credential string) (auth.Identity, error)
+	IssueStreamTicket(ctx context.Context, userID int64) (string, error)
+	AuthenticateStreamTicket(ctx context.Context, ticket string) (auth.Identity, error)
+}
+
+// authenticate rejects the requests without a valid bearer token or API key, and binds the identity of the
+// caller to the request context
+func authenticate(authenticator Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		credential := strings.TrimSpace(strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer "))
+		identity, err := authenticator.Authenticate(ctx.Request.Context(), credential)
+		if err != nil {
+			if errors.Is(err, auth.ErrorUnauthenticated) || errors.Is(err, auth.ErrorInvalidToken) || errors.Is(err, auth.ErrorExpiredToken) {
+				ctx.Header("WWW-Authenticate", `Bearer realm="wallet"`)
+			}
+
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.Request = ctx.Request.WithContext(auth.NewContext(ctx.Request.Context(), identity))
+		ctx.Next()
+	}
+}
+
+// authenticateStream authenticates the requests of a stream with the ticket query parameter, which browsers can
+// send from EventSource unlike the Authorization header, and with the Authorization header when there is no ticket
+func authenticateStream(authenticator Authenticator) gin.HandlerFunc {
+	bearer := authenticate(authenticator)
+	return func(ctx *gin.Context) {
+		ticket := ctx.Query("ticket")
+		if ticket == "" {
+			bearer(ctx)
+			return
+		}
+
+		identity, err := authenticator.AuthenticateStreamTicket(ctx.Request.Context(), ticket)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.Request = ctx.Request.WithContext(auth.NewContext(ctx.Request.Context(), identity))
+		ctx.Next()
+	}
+}
+
+// authorize responds 403 and returns false unless the caller can act on the wallet of the user
+func authorize(ctx *gin.Context, userID int64) bool {
+	identity, _ := auth.FromContext(ctx.Request.Context())
+	if !identity.CanAccess(userID) {
+		abortWithError(ctx, auth.ErrorForbidden)
+		return false
+	}
+
+	return true
+}
+
+// requireScope responds 403 to the callers whose identity lacks the scope
+func requireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		identity, _ := auth.FromContext(ctx.Request.Context())
+		if !identity.HasScope(scope) {
+			abortWithError(ctx, auth.ErrorForbidden)
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/wallet/auth"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// userToken authenticates the user 1, the owner of the wallet of the fixtures
+	userToken  = "user-token"
+	otherToken = "other-token"
+	adminToken = "admin-token"
+)
+
+func Test_Handler_API_Authentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Header string
+		ExpectedStatus   int
+	}{
+		{"Ok", "Bearer " + userToken, http.StatusOK},
+		{"MissingCredentials", "", http.StatusUnauthorized},
+		{"InvalidToken", "Bearer wrong", http.StatusUnauthorized},
+		{"ExpiredToken", "Bearer expired", http.StatusUnauthorized},
+		{"AuthenticatorError", "Bearer failing", http.StatusInternalServerError},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+		service.On("GetUser").Return(user.User{ID: 1}, nil)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		request, err := http.NewRequest(http.MethodGet, "/users/1", nil)
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", tc.Header)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+	}
+}
+
+func Test_Handler_API_Authorization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Token, Method, URL, Filename string
+		ExpectedStatus                         int
+	}{
+		{"GetOwnUser", userToken, http.MethodGet, "/users/1", "", http.StatusOK},
+		{"GetOtherUser", otherToken, http.MethodGet, "/users/1", "", http.StatusForbidden},
+		{"AdminGetsUser", adminToken, http.MethodGet, "/users/1", "", http.StatusOK},
+		{"SearchOtherUser", otherToken, http.MethodGet, "/movements/search?userid=1", "", http.StatusForbidden},
+		{"AdminSearches", adminToken, http.MethodGet, "/movements/search?userid=1", "", http.StatusOK},
+		{"MovementOnOtherWallet", otherToken, http.MethodPost, "/movements", "create_movement_ok", http.StatusForbidden},
+		{"AdminMovement", adminToken, http.MethodPost, "/movements", "create_movement_ok", http.StatusCreated},
+		{"TransferFromOtherWallet", otherToken, http.MethodPost, "/transfers", "create_transfer_ok", http.StatusForbidden},
+		{"ExchangeOnOtherWallet", otherToken, http.MethodPost, "/exchanges", "create_exchange_ok", http.StatusForbidden},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+		service.On("GetUser").Return(user.User{ID: 1}, nil)
+		service.On("SearchMovement", mock.Anything).Return(movement.Page{}, nil)
+		service.On("CreateMovement").Return(int64(1), nil)
+		service.On("GetCurrency", mock.Anything).Return(currency.Currency{Name: "USDT", Digits: 2}, nil)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		var body []byte
+		if tc.Filename != "" {
+			var err error
+			body, err = ioutil.ReadFile("testdata/" + tc.Filename + ".json")
+			require.NoError(t, err)
+		}
+		request, err := http.NewRequest(tc.Method, tc.URL, bytes.NewReader(body))
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+tc.Token)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+	}
+}
+
+func Test_Handler_API_createAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Token, Body string
+		ExpectedStatus        int
+		Error                 error
+		ExpectedScopes        []string
+	}{
+		{"Ok", userToken, "", http.StatusCreated, nil, nil},
+		{"OtherUser", otherToken, "", http.StatusForbidden, nil, nil},
+		{"ScopesByUser", userToken, `{"scopes":["admin"]}`, http.StatusForbidden, nil, nil},
+		{"ScopesByAdmin", adminToken, `{"scopes":["admin"]}`, http.StatusCreated, nil, []string{auth.ScopeAdmin}},
+		{"WrongFormat", userToken, `{"scopes":"admin"}`, http.StatusBadRequest, nil, nil},
+		{"ErrorUserNotFound", adminToken, "", http.StatusNotFound, user.ErrorUserNotFound, nil},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+		service.On("CreateAPIKey", int64(1), tc.ExpectedScopes).Return("lw_key", tc.Error)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		request, err := http.NewRequest(http.MethodPost, "/users/1/apikeys", bytes.NewReader([]byte(tc.Body)))
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+tc.Token)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+		if tc.ExpectedStatus == http.StatusCreated {
+			require.JSONEq(t, `{"key":"lw_key"}`, rr.Body.String())
+		}
+	}
+}
+
+// newAuthenticatorMock authenticates the test tokens
+func newAuthenticatorMock() *authenticatorMock {
+	authenticator := &authenticatorMock{}
+	authenticator.On("Authenticate", userToken).Return(auth.Identity{UserID: 1}, nil)
+	authenticator.On("Authenticate", otherToken).Return(auth.Identity{UserID: 2}, nil)
+	authenticator.On("Authenticate", adminToken).Return(auth.Identity{UserID: 3, Scopes: []string{auth.ScopeAdmin}}, nil)
+	authenticator.On("Authenticate", "").Return(auth.Identity{}, auth.ErrorUnauthenticated)
+	authenticator.On("Authenticate", "expired").Return(auth.Identity{}, auth.ErrorExpiredToken)
+	authenticator.On("Authenticate", "failing").Return(auth.Identity{}, errors.New("fail"))
+	authenticator.On("Authenticate", mock.Anything).Return(auth.Identity{}, auth.ErrorInvalidToken)
+	authenticator.On("IssueStreamTicket", int64(1)).Return("ticket-1", nil)
+	authenticator.On("AuthenticateStreamTicket", "ticket-1").Return(auth.Identity{UserID: 1}, nil)
+	authenticator.On("AuthenticateStreamTicket", "ticket-2").Return(auth.Identity{UserID: 2}, nil)
+	authenticator.On("AuthenticateStreamTicket", mock.Anything).Return(auth.Identity{}, auth.ErrorInvalidToken)
+	return authenticator
+}
+
+type authenticatorMock struct {
+	mock.Mock
+}
+
+func (a *authenticatorMock) Authenticate(ctx context.Context, credential string) (auth.Identity, error) {
+	args := a.Called(credential)
+	return args.Get(0).(auth.Identity), args.Error(1)
+}
+
+func (a *authenticatorMock) IssueStreamTicket(ctx context.Context, userID int64) (string, error) {
+	args := a.Called(userID)
+	return args.String(0), args.Error(1)
+}
+
+func (a *authenticatorMock) AuthenticateStreamTicket(ctx context.Context, ticket string) (auth.Identity, error) {
+	args := a.Called(ticket)
+	return args.Get(0).(auth.Identity), args.Error(1)
+}
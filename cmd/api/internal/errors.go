@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/spolia/lemon-wallet/internal/requestid"
+	"github.com/spolia/lemon-wallet/internal/wallet"
+	"github.com/spolia/lemon-wallet/internal/wallet/auth"
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+	"github.com/spolia/lemon-wallet/internal/wallet/idempotency"
+	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+	"github.com/spolia/lemon-wallet/internal/wallet/rate"
+	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/spolia/lemon-wallet/internal/wallet/webhook"
+)
+
+// ErrorResponse is the body of every error response. Code is stable and meant for the clients to branch on, the
+// message may change
+type ErrorResponse struct {
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"request_id"`
+}
+
+// ErrorDetail describes the problem with a field of the request body or a parameter
+type ErrorDetail struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	codeInternal         = "internal_error"
+	codeInvalidBody      = "invalid_body"
+	codeValidationFailed = "validation_failed"
+	codeInvalidParameter = "invalid_parameter"
+	codeRouteNotFound    = "route_not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+)
+
+// apiError is the status and code a known error is responded with
+type apiError struct {
+	err    error
+	status int
+	code   string
+}
+
+// apiErrors maps the errors of the service to their responses. They are matched with errors.Is in order, so wrapped
+// errors keep their code and the specific errors go before the ones they wrap. The database errors the repositories
+// did not translate are answered by their class, the deadlocks and timeouts as 503 so the client retries them
+var apiErrors = []apiError{
+	{auth.ErrorUnauthenticated, http.StatusUnauthorized, "unauthenticated"},
+	{auth.ErrorInvalidToken, http.StatusUnauthorized, "invalid_token"},
+	{auth.ErrorExpiredToken, http.StatusUnauthorized, "expired_token"},
+	{auth.ErrorForbidden, http.StatusForbidden, "forbidden"},
+	{idempotency.ErrorKeyReused, http.StatusConflict, "idempotency_key_reused"},
+	{idempotency.ErrorRequestInProgress, http.StatusConflict, "request_in_progress"},
+	{idempotency.ErrorOutcomeUnknown, http.StatusConflict, "request_outcome_unknown"},
+	{user.ErrorUserNotFound, http.StatusNotFound, "user_not_found"},
+	{user.ErrorAliasAlreadyExist, http.StatusConflict, "alias_already_exist"},
+	{user.ErrorEmailAlreadyExist, http.StatusConflict, "email_already_exist"},
+	{user.ErrorAlreadyExist, http.StatusConflict, "user_already_exist"},
+	{movement.ErrorNoMovements, http.StatusNotFound, "no_movements"},
+	{movement.ErrorWalletFrozen, http.StatusConflict, "wallet_frozen"},
+	{movement.ErrorInsufficientBalance, http.StatusBadRequest, "insufficient_balance"},
+	{movement.ErrorWrongCurrency, http.StatusBadRequest, "wrong_currency"},
+	{movement.ErrorWrongUser, http.StatusBadRequest, "wrong_user"},
+	{movement.ErrorSameUser, http.StatusBadRequest, "same_user"},
+	{movement.ErrorSameCurrency, http.StatusBadRequest, "same_currency"},
+	{movement.ErrorAmountTooSmall, http.StatusBadRequest, "amount_too_small"},
+	{movement.ErrorInvalidAmount, http.StatusBadRequest, "invalid_amount"},
+	{movement.ErrorInvalidPrecision, http.StatusBadRequest, "invalid_precision"},
+	{movement.ErrorReasonRequired, http.StatusBadRequest, "reason_required"},
+	{movement.ErrorInvalidCursor, http.StatusBadRequest, "invalid_cursor"},
+	{movement.ErrorInvalidSort, http.StatusBadRequest, "invalid_sort"},
+	{rate.ErrorRateNotFound, http.StatusBadRequest, "rate_not_found"},
+	{webhook.ErrorWebhookNotFound, http.StatusNotFound, "webhook_not_found"},
+	{webhook.ErrorInvalidURL, http.StatusBadRequest, "invalid_url"},
+	{webhook.ErrorUnresolvableHost, http.StatusBadRequest, "unresolvable_host"},
+	{webhook.ErrorForbiddenAddress, http.StatusBadRequest, "forbidden_address"},
+	{wallet.ErrorExchangeUnavailable, http.StatusServiceUnavailable, "exchange_unavailable"},
+	{wallet.ErrorAuditUnavailable, http.StatusServiceUnavailable, "audit_unavailable"},
+	{wallet.ErrorWebhooksUnavailable, http.StatusServiceUnavailable, "webhooks_unavailable"},
+	{wallet.ErrorAPIKeysUnavailable, http.StatusServiceUnavailable, "api_keys_unavailable"},
+	{wallet.ErrorStreamUnavailable, http.StatusServiceUnavailable, "stream_unavailable"},
+	{dberror.ErrorDuplicate, http.StatusConflict, "conflict"},
+	{dberror.ErrorForeignKey, http.StatusUnprocessableEntity, "reference_not_found"},
+	{dberror.ErrorOutOfRange, http.StatusUnprocessableEntity, "value_out_of_range"},
+	{dberror.ErrorDeadlock, http.StatusServiceUnavailable, "database_busy"},
+	{dberror.ErrorTimeout, http.StatusServiceUnavailable, "database_busy"},
+}
+
+// abortWithError responds the status, code and message of a known error, without the context it may be wrapped in.
+// Any other error is responded 500 without its message, which is kept in the context for the access log and the trace
+func abortWithError(ctx *gin.Context, err error) {
+	for _, known := range apiErrors {
+		if errors.Is(err, known.err) {
+			abortWithResponse(ctx, known.status, known.code, known.err.Error(), nil)
+			return
+		}
+	}
+
+	_ = ctx.Error(err)
+	abortWithResponse(ctx, http.StatusInternalServerError, codeInternal, "internal server error", nil)
+}
+
+// abortWithBindError responds 400 to a request body that could not be bound, with a detail per invalid field
+func abortWithBindError(ctx *gin.Context, err error) {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		details := make([]ErrorDetail, 0, len(validationErrors))
+		for _, fieldError := range validationErrors {
+			details = append(details, ErrorDetail{
+				Field:   fieldName(fieldError),
+				Code:    fieldError.Tag(),
+				Message: validationMessage(fieldError),
+			})
+		}
+
+		abortWithResponse(ctx, http.StatusBadRequest, codeValidationFailed, "the request has invalid fields", details)
+		return
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) && typeError.Field != "" {
+		details := []ErrorDetail{{Field: typeError.Field, Code: "type", Message: "must be " + jsonType(typeError.Type)}}
+		abortWithResponse(ctx, http.StatusBadRequest, codeValidationFailed, "the request has invalid fields", details)
+		return
+	}
+
+	abortWithResponse(ctx, http.StatusBadRequest, codeInvalidBody, "the request body is not valid JSON", nil)
+}
+
+// abortWithInvalidParameter responds 400 to a path or query parameter that could not be parsed
+func abortWithInvalidParameter(ctx *gin.Context, name, message string) {
+	details := []ErrorDetail{{Field: name, Code: "format", Message: message}}
+	abortWithResponse(ctx, http.StatusBadRequest, codeInvalidParameter, "the request has invalid parameters", details)
+}
+
+// routeNotFound responds 404 to the requests no route matches
+func routeNotFound(ctx *gin.Context) {
+	abortWithResponse(ctx, http.StatusNotFound, codeRouteNotFound, "the route does not exist", nil)
+}
+
+// methodNotAllowed responds 405 to the requests whose path has routes for other methods only
+func methodNotAllowed(ctx *gin.Context) {
+	abortWithResponse(ctx, http.StatusMethodNotAllowed, codeMethodNotAllowed, "the method is not allowed for the route", nil)
+}
+
+func abortWithResponse(ctx *gin.Context, status int, code, message string, details []ErrorDetail) {
+	ctx.AbortWithStatusJSON(status, ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestid.FromContext(ctx.Request.Context()),
+	})
+}
+
+// fieldName is the path of the field in the request body, its namespace without the name of the root struct
+func fieldName(fieldError validator.FieldError) string {
+	namespace := fieldError.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+
+	return namespace
+}
+
+// validationMessage describes the binding tags used by the requests. The parameters naming other fields hold
+// their Go names, which are their JSON names in lowercase
+func validationMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "currency":
+		return "is not a supported currency"
+	case "max":
+		return fmt.Sprintf("must be at most %s characters long", fieldError.Param())
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fieldError.Param()), ", ")
+	case "required_without":
+		return "is required when " + strings.ToLower(fieldError.Param()) + " is missing"
+	case "excluded_with":
+		return "must not be sent along with " + strings.ToLower(fieldError.Param())
+	}
+
+	return "is not valid"
+}
+
+// jsonType names the JSON type a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+
+	return "an object"
+}
+
+// jsonTagName names the fields of the validation errors by their JSON name instead of their Go name
+func jsonTagName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
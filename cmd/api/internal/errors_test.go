@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/requestid"
+	"github.com/spolia/lemon-wallet/internal/wallet"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
+	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ErrorResponse_KnownErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName       string
+		Error          error
+		ExpectedStatus int
+		ExpectedCode   string
+	}{
+		{"InsufficientBalance", movement.ErrorInsufficientBalance, http.StatusBadRequest, "insufficient_balance"},
+		{"Wrapped", fmt.Errorf("transfer: %w", movement.ErrorWalletFrozen), http.StatusConflict, "wallet_frozen"},
+		{"Unknown", errors.New("dial tcp: connection refused"), http.StatusInternalServerError, "internal_error"},
+		{"Deadlock", dberror.Classify(&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}),
+			http.StatusServiceUnavailable, "database_busy"},
+	}
+
+	for _, tc := range tt {
+		// Given
+		service := &serviceMock{}
+		service.On("CreateMovement").Return(int64(0), tc.Error)
+		service.On("GetCurrency", "usdt").Return(currency.Currency{Name: "USDT", Digits: 2}, nil)
+		router := gin.New()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		// When
+		rr := postTestdata(t, router, "/movements", "create_movement_ok")
+
+		// then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, tc.TestName)
+		var response ErrorResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response), tc.TestName)
+		require.Equal(t, tc.ExpectedCode, response.Code, tc.TestName)
+		require.Equal(t, "req-1", response.RequestID, tc.TestName)
+		require.NotContains(t, response.Message, "connection refused", tc.TestName)
+		require.NotContains(t, response.Message, "Deadlock found", tc.TestName)
+	}
+}
+
+func Test_ErrorResponse_RepositoryDeadlock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	currencies := currency.MustNewRegistry([]currency.Currency{{ID: 1, Name: "USDT", Digits: 2}})
+	service := wallet.New(user.New(db, logging.Discard()), movement.New(db, currencies, logging.Discard()), currencies,
+		txn.New(db))
+	router := gin.New()
+	API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT b.amount, b.last_hash, u.frozen FROM balances b JOIN users u ON u.id = b.user_id "+
+		"WHERE b.user_id = ? AND b.currency_name = ? FOR UPDATE OF b FOR SHARE OF u;").
+		WithArgs(int64(1), "USDT").
+		WillReturnError(&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"})
+	mock.ExpectRollback()
+
+	// When
+	rr := postTestdata(t, router, "/movements", "create_movement_ok")
+
+	// then
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.JSONEq(t, `{"code":"database_busy","message":"`+dberror.ErrorDeadlock.Error()+`","request_id":"req-1"}`,
+		rr.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func Test_ErrorResponse_ValidationErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Path, Filename string
+		ExpectedCode             string
+		ExpectedDetails          []ErrorDetail
+	}{
+		{"Required", "/users", "create_user_no_required_field", "validation_failed", []ErrorDetail{
+			{Field: "firstname", Code: "required", Message: "is required"},
+			{Field: "lastname", Code: "required", Message: "is required"},
+		}},
+		{"WrongType", "/movements", "create_movement_wrong_format", "validation_failed", []ErrorDetail{
+			{Field: "userid", Code: "type", Message: "must be a number"},
+		}},
+		{"ExcludedWith", "/transfers", "create_transfer_wrong_format", "validation_failed", []ErrorDetail{
+			{Field: "touserid", Code: "excluded_with", Message: "must not be sent along with toalias"},
+			{Field: "toalias", Code: "excluded_with", Message: "must not be sent along with touserid"},
+		}},
+	}
+
+	for _, tc := range tt {
+		// Given
+		service := &serviceMock{}
+		service.On("GetCurrency", "usdt").Return(currency.Currency{Name: "USDT", Digits: 2}, nil)
+		router := gin.New()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		// When
+		rr := postTestdata(t, router, tc.Path, tc.Filename)
+
+		// then
+		require.Equal(t, http.StatusBadRequest, rr.Code, tc.TestName)
+		var response ErrorResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response), tc.TestName)
+		require.Equal(t, tc.ExpectedCode, response.Code, tc.TestName)
+		require.Equal(t, tc.ExpectedDetails, response.Details, tc.TestName)
+		require.NotContains(t, rr.Body.String(), "Name", tc.TestName)
+		require.NotContains(t, rr.Body.String(), "UserID", tc.TestName)
+	}
+}
+
+func Test_ErrorResponse_CurrencyOfEachRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	supporting := &serviceMock{}
+	supporting.On("CreateMovement").Return(int64(1), nil)
+	supporting.On("GetCurrency", "usdt").Return(currency.Currency{Name: "USDT", Digits: 2}, nil)
+	notSupporting := &serviceMock{}
+	notSupporting.On("GetCurrency", "usdt").Return(currency.Currency{}, currency.ErrorCurrencyNotFound)
+	supportingRouter, notSupportingRouter := gin.New(), gin.New()
+	API(supportingRouter, supporting, nil, newAuthenticatorMock(), logging.Discard())
+	API(notSupportingRouter, notSupporting, nil, newAuthenticatorMock(), logging.Discard())
+
+	// When
+	rejected := postTestdata(t, notSupportingRouter, "/movements", "create_movement_ok")
+	accepted := postTestdata(t, supportingRouter, "/movements", "create_movement_ok")
+
+	// then
+	require.Equal(t, http.StatusCreated, accepted.Code)
+	require.Equal(t, http.StatusBadRequest, rejected.Code)
+	require.JSONEq(t, `{"code":"validation_failed","message":"the request has invalid fields","request_id":"req-1",
+		"details":[{"field":"currencyname","code":"currency","message":"is not a supported currency"}]}`,
+		rejected.Body.String())
+}
+
+func Test_ErrorResponse_InvalidBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	router := gin.New()
+	API(router, &serviceMock{}, nil, newAuthenticatorMock(), logging.Discard())
+	request, err := http.NewRequest(http.MethodPost, "/movements", strings.NewReader(`{"type":`))
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+userToken)
+	rr := httptest.NewRecorder()
+
+	// When
+	router.ServeHTTP(rr, request)
+
+	// then
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.JSONEq(t, `{"code":"invalid_body","message":"the request body is not valid JSON","request_id":"`+
+		rr.Header().Get(requestid.Header)+`"}`, rr.Body.String())
+}
+
+func Test_ErrorResponse_InvalidParameter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	router := gin.New()
+	API(router, &serviceMock{}, nil, newAuthenticatorMock(), logging.Discard())
+	request, err := http.NewRequest(http.MethodGet, "/movements/search?userid=1&from=yesterday", nil)
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+userToken)
+	request.Header.Set(requestid.Header, "req-1")
+	rr := httptest.NewRecorder()
+
+	// When
+	router.ServeHTTP(rr, request)
+
+	// then
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.JSONEq(t, `{"code":"invalid_parameter","message":"the request has invalid parameters","request_id":"req-1",
+		"details":[{"field":"from","code":"format","message":"must be a RFC 3339 timestamp or a date"}]}`, rr.Body.String())
+}
+
+func Test_ErrorResponse_UnknownRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Method, Path string
+		ExpectedStatus         int
+		ExpectedBody           string
+	}{
+		{"NoRoute", http.MethodGet, "/unknown", http.StatusNotFound,
+			`{"code":"route_not_found","message":"the route does not exist","request_id":"req-1"}`},
+		{"NoMethod", http.MethodDelete, "/currencies", http.StatusMethodNotAllowed,
+			`{"code":"method_not_allowed","message":"the method is not allowed for the route","request_id":"req-1"}`},
+	}
+
+	for _, tc := range tt {
+		// Given
+		router := gin.New()
+		API(router, &serviceMock{}, nil, newAuthenticatorMock(), logging.Discard())
+		request, err := http.NewRequest(tc.Method, tc.Path, nil)
+		require.NoError(t, err)
+		request.Header.Set(requestid.Header, "req-1")
+		rr := httptest.NewRecorder()
+
+		// When
+		router.ServeHTTP(rr, request)
+
+		// then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, tc.TestName)
+		require.JSONEq(t, tc.ExpectedBody, rr.Body.String(), tc.TestName)
+	}
+}
+
+func postTestdata(t *testing.T, router *gin.Engine, path, filename string) *httptest.ResponseRecorder {
+	body, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s.json", filename))
+	require.NoError(t, err)
+	request, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+userToken)
+	request.Header.Set(requestid.Header, "req-1")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, request)
+	return rr
+}
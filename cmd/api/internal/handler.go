@@ -3,8 +3,11 @@ package internal
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/spolia/lemon-wallet/internal/wallet/auth"
 	"github.com/spolia/lemon-wallet/internal/wallet/movement"
 	"github.com/spolia/lemon-wallet/internal/wallet/user"
 )
@@ -12,18 +15,14 @@ import (
 func createUser(service Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var userRequest user.User
-		if err := ctx.ShouldBindJSON(&userRequest); err != nil {
-			ctx.JSON(http.StatusBadRequest, err.Error())
+		if err := bindJSON(ctx, &userRequest); err != nil {
+			abortWithBindError(ctx, err)
 			return
 		}
 
-		userID, err := service.CreateUser(ctx, userRequest.FirstName, userRequest.LastName, userRequest.Alias, userRequest.Email)
+		userID, err := service.CreateUser(ctx.Request.Context(), userRequest.FirstName, userRequest.LastName, userRequest.Alias, userRequest.Email)
 		if err != nil {
-			if err == user.ErrorAlreadyExist {
-				ctx.JSON(http.StatusBadRequest, err.Error())
-				return
-			}
-			ctx.JSON(http.StatusInternalServerError, err.Error())
+			abortWithError(ctx, err)
 			return
 		}
 		ctx.JSON(http.StatusCreated, userID)
@@ -34,41 +33,77 @@ func getUser(service Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, err.Error())
+			abortWithInvalidParameter(ctx, "id", "must be an integer")
 			return
 		}
 
-		userResult, err := service.GetUser(ctx, userID)
+		if !authorize(ctx, userID) {
+			return
+		}
+
+		userResult, err := service.GetUser(ctx.Request.Context(), userID)
 		if err != nil {
-			if err == user.ErrorUserNotFound {
-				ctx.JSON(http.StatusNotFound, err.Error())
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusOK, userResult)
+	}
+}
+
+// createAPIKey returns a new API key of the user. Only admins can grant scopes to a key
+func createAPIKey(service Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "id", "must be an integer")
+			return
+		}
+
+		if !authorize(ctx, userID) {
+			return
+		}
+
+		var keyRequest struct {
+			Scopes []string `json:"scopes"`
+		}
+		if ctx.Request.ContentLength != 0 {
+			if err = bindJSON(ctx, &keyRequest); err != nil {
+				abortWithBindError(ctx, err)
 				return
 			}
+		}
 
-			ctx.JSON(http.StatusInternalServerError, err.Error())
+		if identity, _ := auth.FromContext(ctx.Request.Context()); len(keyRequest.Scopes) > 0 && !identity.HasScope(auth.ScopeAdmin) {
+			abortWithError(ctx, auth.ErrorForbidden)
 			return
 		}
 
-		ctx.JSON(http.StatusOK, userResult)
+		key, err := service.CreateAPIKey(ctx.Request.Context(), userID, keyRequest.Scopes)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, gin.H{"key": key})
 	}
 }
 
 func createMovement(service Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var movementRequest movement.Movement
-		if err := ctx.ShouldBindJSON(&movementRequest); err != nil {
-			ctx.JSON(http.StatusBadRequest, err.Error())
+		if err := bindJSON(ctx, &movementRequest); err != nil {
+			abortWithBindError(ctx, err)
 			return
 		}
 
-		movementID, err := service.CreateMovement(ctx, movementRequest)
-		if err != nil {
-			if err == movement.ErrorWrongCurrency || err == movement.ErrorWrongUser || err == movement.ErrorInsufficientBalance {
-				ctx.JSON(http.StatusBadRequest, err.Error())
-				return
-			}
+		if !authorize(ctx, movementRequest.UserID) {
+			return
+		}
 
-			ctx.JSON(http.StatusInternalServerError, err.Error())
+		movementID, err := service.CreateMovement(ctx.Request.Context(), movementRequest)
+		if err != nil {
+			abortWithError(ctx, err)
 			return
 		}
 
@@ -76,45 +111,143 @@ func createMovement(service Service) gin.HandlerFunc {
 	}
 }
 
+func createTransfer(service Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var transferRequest movement.Transfer
+		if err := bindJSON(ctx, &transferRequest); err != nil {
+			abortWithBindError(ctx, err)
+			return
+		}
+
+		if !authorize(ctx, transferRequest.FromUserID) {
+			return
+		}
+
+		transferResult, err := service.Transfer(ctx.Request.Context(), transferRequest)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, transferResult)
+	}
+}
+
+func createExchange(service Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var exchangeRequest movement.Exchange
+		if err := bindJSON(ctx, &exchangeRequest); err != nil {
+			abortWithBindError(ctx, err)
+			return
+		}
+
+		if !authorize(ctx, exchangeRequest.UserID) {
+			return
+		}
+
+		exchangeResult, err := service.Exchange(ctx.Request.Context(), exchangeRequest)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, exchangeResult)
+	}
+}
+
 func searchMovement(service Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		userID, err := strconv.ParseInt(ctx.Query("userid"), 10, 64)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, err.Error())
+			abortWithInvalidParameter(ctx, "userid", "must be an integer")
+			return
+		}
+
+		if !authorize(ctx, userID) {
+			return
+		}
+
+		limit, err := strconv.ParseUint(ctx.DefaultQuery("limit", "0"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "limit", "must be a non negative integer")
 			return
 		}
 
-		limit, _ := strconv.ParseUint(ctx.DefaultQuery("limit", "0"), 10, 64)
-		offset, _ := strconv.ParseUint(ctx.DefaultQuery("offset", "0"), 10, 0)
-		typeMov := ctx.Query("type")
-		currency := ctx.Query("currencyname")
+		offset, err := strconv.ParseUint(ctx.DefaultQuery("offset", "0"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "offset", "must be a non negative integer")
+			return
+		}
 
-		var searchRequest = struct {
-			Limit        uint64
-			Offset       uint64
-			Type         string
-			CurrencyName string
-			UserID       int64
-		}{
+		var filter = movement.Filter{
+			UserID:       userID,
+			Type:         ctx.Query("type"),
+			CurrencyName: ctx.Query("currencyname"),
+			Sort:         ctx.Query("sort"),
+			Direction:    ctx.Query("direction"),
 			Limit:        limit,
 			Offset:       offset,
-			Type:         typeMov,
-			CurrencyName: currency,
-			UserID:       userID,
+			Cursor:       ctx.Query("cursor"),
 		}
 
-		movementsResult, err := service.SearchMovement(ctx, searchRequest.UserID, searchRequest.Limit, searchRequest.Offset, searchRequest.Type,
-			searchRequest.CurrencyName)
-		if err != nil {
-			if err == movement.ErrorNoMovements {
-				ctx.JSON(http.StatusNotFound, err.Error())
-				return
-			}
+		if filter.From, err = parseTime(ctx.Query("from")); err != nil {
+			abortWithInvalidParameter(ctx, "from", "must be a RFC 3339 timestamp or a date")
+			return
+		}
 
-			ctx.JSON(http.StatusInternalServerError, err.Error())
+		if filter.To, err = parseTime(ctx.Query("to")); err != nil {
+			abortWithInvalidParameter(ctx, "to", "must be a RFC 3339 timestamp or a date")
+			return
+		}
+
+		if filter.MinAmount, err = parseAmount(ctx.Query("min_amount")); err != nil {
+			abortWithInvalidParameter(ctx, "min_amount", "must be a decimal number")
+			return
+		}
+
+		if filter.MaxAmount, err = parseAmount(ctx.Query("max_amount")); err != nil {
+			abortWithInvalidParameter(ctx, "max_amount", "must be a decimal number")
+			return
+		}
+
+		movementsResult, err := service.SearchMovement(ctx.Request.Context(), filter)
+		if err != nil {
+			abortWithError(ctx, err)
 			return
 		}
 
 		ctx.JSON(http.StatusOK, movementsResult)
 	}
 }
+
+// parseTime reads a RFC 3339 timestamp or a date, which is the start of the day in UTC
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseAmount(value string) (decimal.NullDecimal, error) {
+	if value == "" {
+		return decimal.NullDecimal{}, nil
+	}
+
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.NullDecimal{}, err
+	}
+
+	return decimal.NullDecimal{Decimal: amount, Valid: true}, nil
+}
+
+func listCurrencies(service Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, service.Currencies(ctx.Request.Context()))
+	}
+}
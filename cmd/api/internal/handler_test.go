@@ -3,16 +3,28 @@ package internal
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/wallet"
+	"github.com/spolia/lemon-wallet/internal/wallet/audit"
+	"github.com/spolia/lemon-wallet/internal/wallet/broadcast"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
 	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+	"github.com/spolia/lemon-wallet/internal/wallet/rate"
 	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/spolia/lemon-wallet/internal/wallet/webhook"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -27,7 +39,10 @@ func Test_Handler_API_createUser(t *testing.T) {
 	}{
 		{"Ok", "create_user_ok", http.StatusCreated, nil},
 		{"WrongFormat", "create_user_wrong_format", http.StatusBadRequest, nil},
-		{"ErrorAlreadyExist", "create_user_ok", http.StatusBadRequest, user.ErrorAlreadyExist},
+		{"ErrorAlreadyExist", "create_user_ok", http.StatusConflict, user.ErrorAlreadyExist},
+		{"ErrorAliasAlreadyExist", "create_user_ok", http.StatusConflict, user.ErrorAliasAlreadyExist},
+		{"ErrorEmailAlreadyExist", "create_user_ok", http.StatusConflict, user.ErrorEmailAlreadyExist},
+		{"ErrorDeadlock", "create_user_ok", http.StatusServiceUnavailable, dberror.Classify(&mysql.MySQLError{Number: 1213})},
 		{"InternalServerError", "create_user_ok", http.StatusInternalServerError, errors.New("fail")},
 	}
 
@@ -39,12 +54,13 @@ func Test_Handler_API_createUser(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 		router := gin.Default()
-		API(router, service)
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
 		body, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s.json", tc.Filename))
 		require.NoError(t, err)
 		reader := bytes.NewReader(body)
 		request, err := http.NewRequest(http.MethodPost, "/users", reader)
 		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+userToken)
 
 		router.ServeHTTP(rr, request)
 		// Then
@@ -81,10 +97,11 @@ func Test_Handler_API_getUser(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 		router := gin.Default()
-		API(router, service)
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
 
 		request, err := http.NewRequest(http.MethodGet, "/users/1", nil)
 		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+userToken)
 
 		router.ServeHTTP(rr, request)
 		// Then
@@ -102,6 +119,8 @@ func Test_Handler_API_createMovement(t *testing.T) {
 		{"WrongFormat", "create_movement_wrong_format", http.StatusBadRequest, nil},
 		{"ErrorWrongCurrency", "create_movement_ok", http.StatusBadRequest, movement.ErrorWrongCurrency},
 		{"ErrorInsufficientBalance", "create_movement_ok", http.StatusBadRequest, movement.ErrorInsufficientBalance},
+		{"ErrorWalletFrozen", "create_movement_ok", http.StatusConflict, movement.ErrorWalletFrozen},
+		{"ErrorInvalidPrecision", "create_movement_ok", http.StatusBadRequest, movement.ErrorInvalidPrecision},
 		{"InternalServerError", "create_movement_ok", http.StatusInternalServerError, errors.New("fail")},
 	}
 
@@ -110,15 +129,17 @@ func Test_Handler_API_createMovement(t *testing.T) {
 		service := &serviceMock{}
 
 		service.On("CreateMovement").Return(int64(1), tc.Error)
+		service.On("GetCurrency", "usdt").Return(currency.Currency{Name: "USDT", Digits: 2}, nil)
 
 		rr := httptest.NewRecorder()
 		router := gin.Default()
-		API(router, service)
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
 		body, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s.json", tc.Filename))
 		require.NoError(t, err)
 		reader := bytes.NewReader(body)
 		request, err := http.NewRequest(http.MethodPost, "/movements", reader)
 		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+userToken)
 
 		router.ServeHTTP(rr, request)
 		// Then
@@ -126,6 +147,170 @@ func Test_Handler_API_createMovement(t *testing.T) {
 	}
 }
 
+func Test_Handler_API_createTransfer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Filename string
+		ExpectedStatus     int
+		Error              error
+	}{
+		{"Ok", "create_transfer_ok", http.StatusCreated, nil},
+		{"OkByAlias", "create_transfer_alias_ok", http.StatusCreated, nil},
+		{"WrongFormat", "create_transfer_wrong_format", http.StatusBadRequest, nil},
+		{"ErrorUserNotFound", "create_transfer_alias_ok", http.StatusNotFound, user.ErrorUserNotFound},
+		{"ErrorSameUser", "create_transfer_ok", http.StatusBadRequest, movement.ErrorSameUser},
+		{"ErrorInsufficientBalance", "create_transfer_ok", http.StatusBadRequest, movement.ErrorInsufficientBalance},
+		{"ErrorWalletFrozen", "create_transfer_ok", http.StatusConflict, movement.ErrorWalletFrozen},
+		{"InternalServerError", "create_transfer_ok", http.StatusInternalServerError, errors.New("fail")},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+
+		service.On("Transfer").Return(movement.Transfer{}, tc.Error)
+		service.On("GetCurrency", "usdt").Return(currency.Currency{Name: "USDT", Digits: 2}, nil)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+		body, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s.json", tc.Filename))
+		require.NoError(t, err)
+		reader := bytes.NewReader(body)
+		request, err := http.NewRequest(http.MethodPost, "/transfers", reader)
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+userToken)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+	}
+}
+
+func Test_Handler_API_createExchange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Filename string
+		ExpectedStatus     int
+		Error              error
+	}{
+		{"Ok", "create_exchange_ok", http.StatusCreated, nil},
+		{"WrongFormat", "create_exchange_wrong_format", http.StatusBadRequest, nil},
+		{"ErrorSameCurrency", "create_exchange_ok", http.StatusBadRequest, movement.ErrorSameCurrency},
+		{"ErrorRateNotFound", "create_exchange_ok", http.StatusBadRequest, rate.ErrorRateNotFound},
+		{"ErrorInsufficientBalance", "create_exchange_ok", http.StatusBadRequest, movement.ErrorInsufficientBalance},
+		{"ErrorExchangeUnavailable", "create_exchange_ok", http.StatusServiceUnavailable, wallet.ErrorExchangeUnavailable},
+		{"InternalServerError", "create_exchange_ok", http.StatusInternalServerError, errors.New("fail")},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+
+		service.On("Exchange").Return(movement.Exchange{}, tc.Error)
+		service.On("GetCurrency", "usdt").Return(currency.Currency{Name: "USDT", Digits: 2}, nil)
+		service.On("GetCurrency", "btc").Return(currency.Currency{Name: "BTC", Digits: 8}, nil)
+		service.On("GetCurrency", "eth").Return(currency.Currency{}, currency.ErrorCurrencyNotFound)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+		body, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s.json", tc.Filename))
+		require.NoError(t, err)
+		reader := bytes.NewReader(body)
+		request, err := http.NewRequest(http.MethodPost, "/exchanges", reader)
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+userToken)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+	}
+}
+
+func Test_Handler_API_listCurrencies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// When
+	service := &serviceMock{}
+	service.On("Currencies").Return([]currency.Currency{{ID: 1, Name: "ARS", Digits: 2}, {ID: 2, Name: "BTC", Digits: 8}})
+
+	rr := httptest.NewRecorder()
+	router := gin.Default()
+	API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+	request, err := http.NewRequest(http.MethodGet, "/currencies", nil)
+	assert.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+userToken)
+
+	router.ServeHTTP(rr, request)
+	// Then
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.JSONEq(t, `[{"id":1,"name":"ARS","digits":2},{"id":2,"name":"BTC","digits":8}]`, rr.Body.String())
+}
+
+func Test_Handler_API_searchMovement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	page := movement.Page{
+		Items: []movement.Row{{ID: 7, CurrencyName: "ARS", Type: movement.DepositMov, Amount: decimal.RequireFromString("10"),
+			TotalAmount: decimal.RequireFromString("10")}},
+		Total:      3,
+		NextCursor: "eyJpIjo3fQ",
+	}
+
+	tt := []struct {
+		TestName, Query string
+		ExpectedStatus  int
+		Error           error
+		Page            movement.Page
+	}{
+		{"Ok", "userid=1&limit=1&offset=1&type=deposit&currencyname=ars", http.StatusOK, nil, page},
+		{"WrongUserID", "userid=one", http.StatusBadRequest, nil, movement.Page{}},
+		{"RangeOk", "userid=1&from=2022-03-01&to=2022-04-01T00:00:00Z&min_amount=1000&sort=amount&direction=asc", http.StatusOK,
+			nil, page},
+		{"WrongLimit", "userid=1&limit=-1", http.StatusBadRequest, nil, movement.Page{}},
+		{"WrongOffset", "userid=1&limit=1&offset=one", http.StatusBadRequest, nil, movement.Page{}},
+		{"WrongFrom", "userid=1&from=march", http.StatusBadRequest, nil, movement.Page{}},
+		{"WrongMaxAmount", "userid=1&max_amount=1.000,5", http.StatusBadRequest, nil, movement.Page{}},
+		{"ErrorInvalidSort", "userid=1&sort=type", http.StatusBadRequest, movement.ErrorInvalidSort, movement.Page{}},
+		{"ErrorInvalidCursor", "userid=1&limit=1&cursor=wrong", http.StatusBadRequest, movement.ErrorInvalidCursor, movement.Page{}},
+		{"ErrorNoMovements", "userid=1&limit=1&offset=1", http.StatusNotFound, movement.ErrorNoMovements, movement.Page{}},
+		{"InternalServerError", "userid=1&limit=1&offset=1", http.StatusInternalServerError, errors.New("fail"), movement.Page{}},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+		service.On("SearchMovement", movement.Filter{UserID: 1, Limit: 1, Offset: 1, Type: "deposit", CurrencyName: "ars"}).
+			Return(tc.Page, tc.Error)
+		service.On("SearchMovement", mock.MatchedBy(func(filter movement.Filter) bool {
+			return filter.From.Equal(time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)) &&
+				filter.To.Equal(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)) &&
+				filter.MinAmount.Valid && filter.MinAmount.Decimal.Equal(decimal.NewFromInt(1000)) && !filter.MaxAmount.Valid &&
+				filter.Sort == movement.SortByAmount && filter.Direction == movement.SortAsc
+		})).Return(tc.Page, tc.Error)
+		service.On("SearchMovement", mock.Anything).Return(movement.Page{}, tc.Error)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		request, err := http.NewRequest(http.MethodGet, "/movements/search?"+tc.Query, nil)
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+userToken)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+		if tc.ExpectedStatus == http.StatusOK {
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			require.Equal(t, float64(3), response["total"])
+			require.Equal(t, "eyJpIjo3fQ", response["next_cursor"])
+			require.Len(t, response["items"], 1)
+		}
+	}
+}
+
 type serviceMock struct {
 	mock.Mock
 }
@@ -140,11 +325,82 @@ func (s *serviceMock) GetUser(ctx context.Context, id int64) (user.User, error)
 	return args.Get(0).(user.User), args.Error(1)
 }
 
+func (s *serviceMock) CreateAPIKey(ctx context.Context, userID int64, scopes []string) (string, error) {
+	args := s.Called(userID, scopes)
+	return args.String(0), args.Error(1)
+}
+
 func (s *serviceMock) CreateMovement(ctx context.Context, movement movement.Movement) (int64, error) {
 	args := s.Called()
 	return args.Get(0).(int64), args.Error(1)
 }
-func (s *serviceMock) SearchMovement(ctx context.Context, userID int64, limit, offset uint64, movType, currencyName string) ([]movement.Row, error) {
+func (s *serviceMock) SearchMovement(ctx context.Context, filter movement.Filter) (movement.Page, error) {
+	args := s.Called(filter)
+	return args.Get(0).(movement.Page), args.Error(1)
+}
+
+func (s *serviceMock) Transfer(ctx context.Context, transfer movement.Transfer) (movement.Transfer, error) {
+	args := s.Called()
+	return args.Get(0).(movement.Transfer), args.Error(1)
+}
+
+func (s *serviceMock) Exchange(ctx context.Context, exchange movement.Exchange) (movement.Exchange, error) {
+	args := s.Called()
+	return args.Get(0).(movement.Exchange), args.Error(1)
+}
+
+func (s *serviceMock) Currencies(ctx context.Context) []currency.Currency {
 	args := s.Called()
-	return args.Get(0).([]movement.Row), args.Error(1)
+	return args.Get(0).([]currency.Currency)
+}
+
+func (s *serviceMock) GetCurrency(ctx context.Context, name string) (currency.Currency, error) {
+	args := s.Called(name)
+	return args.Get(0).(currency.Currency), args.Error(1)
+}
+
+func (s *serviceMock) SearchUsers(ctx context.Context, text string, limit, offset uint64) ([]user.User, error) {
+	args := s.Called(text, limit, offset)
+	return args.Get(0).([]user.User), args.Error(1)
+}
+
+func (s *serviceMock) FreezeUser(ctx context.Context, id int64) error {
+	args := s.Called(id)
+	return args.Error(0)
+}
+
+func (s *serviceMock) UnfreezeUser(ctx context.Context, id int64) error {
+	args := s.Called(id)
+	return args.Error(0)
+}
+
+func (s *serviceMock) Adjust(ctx context.Context, adjustment movement.Adjustment) (movement.Adjustment, error) {
+	args := s.Called(adjustment)
+	return args.Get(0).(movement.Adjustment), args.Error(1)
+}
+
+func (s *serviceMock) AuditEvents(ctx context.Context, filter audit.Filter) ([]audit.Event, error) {
+	args := s.Called(filter)
+	return args.Get(0).([]audit.Event), args.Error(1)
+}
+
+func (s *serviceMock) CreateWebhook(ctx context.Context, hook webhook.Webhook) (webhook.Webhook, error) {
+	args := s.Called(hook)
+	return args.Get(0).(webhook.Webhook), args.Error(1)
+}
+
+func (s *serviceMock) GetWebhook(ctx context.Context, id int64) (webhook.Webhook, error) {
+	args := s.Called(id)
+	return args.Get(0).(webhook.Webhook), args.Error(1)
+}
+
+func (s *serviceMock) WebhookDeliveries(ctx context.Context, webhookID int64, limit, offset uint64) ([]webhook.Delivery, error) {
+	args := s.Called(webhookID, limit, offset)
+	return args.Get(0).([]webhook.Delivery), args.Error(1)
+}
+
+func (s *serviceMock) Subscribe(ctx context.Context, userID int64) (<-chan broadcast.Event, func(), error) {
+	args := s.Called(userID)
+	events, _ := args.Get(0).(chan broadcast.Event)
+	return events, func() {}, args.Error(1)
 }
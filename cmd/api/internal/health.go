@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkTimeout bounds each readiness check, so a hung dependency answers not ready instead of hanging the probe
+const checkTimeout = 2 * time.Second
+
+// Check is a dependency the API needs to serve requests, e.g. the database
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Probes adds the liveness and readiness probes of the orchestrator. GET /healthz answers while the process serves
+// requests, and GET /readyz while every check passes
+func Probes(router *gin.Engine, checks ...Check) {
+	router.GET("/healthz", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	router.GET("/readyz", ready(checks))
+}
+
+// ready runs the checks and answers 503 with the failures unless all of them pass
+func ready(checks []Check) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var status = http.StatusOK
+		var results = make(map[string]string, len(checks))
+		for _, v := range checks {
+			checkCtx, cancel := context.WithTimeout(ctx.Request.Context(), checkTimeout)
+			err := v.Run(checkCtx)
+			cancel()
+			if err != nil {
+				status, results[v.Name] = http.StatusServiceUnavailable, err.Error()
+				continue
+			}
+			results[v.Name] = "ok"
+		}
+
+		if status != http.StatusOK {
+			ctx.JSON(status, gin.H{"status": "not ready", "checks": results})
+			return
+		}
+
+		ctx.JSON(status, gin.H{"status": "ready", "checks": results})
+	}
+}
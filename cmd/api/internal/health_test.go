@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Handler_Probes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, URL   string
+		MigrationsError error
+		ExpectedStatus  int
+		ExpectedBody    string
+	}{
+		{"Healthz", "/healthz", errors.New("2 pending migrations"), http.StatusOK, `{"status":"ok"}`},
+		{"Ready", "/readyz", nil, http.StatusOK, `{"status":"ready","checks":{"database":"ok","migrations":"ok"}}`},
+		{"NotReady", "/readyz", errors.New("2 pending migrations"), http.StatusServiceUnavailable,
+			`{"status":"not ready","checks":{"database":"ok","migrations":"2 pending migrations"}}`},
+	}
+
+	for _, tc := range tt {
+		// When
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		Probes(router,
+			Check{Name: "database", Run: func(ctx context.Context) error { return nil }},
+			Check{Name: "migrations", Run: func(ctx context.Context) error { return tc.MigrationsError }})
+
+		request, err := http.NewRequest(http.MethodGet, tc.URL, nil)
+		assert.NoError(t, err)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+		require.JSONEq(t, tc.ExpectedBody, rr.Body.String(), tc.TestName)
+	}
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/wallet/auth"
+	"github.com/spolia/lemon-wallet/internal/wallet/idempotency"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotent replays the stored response when a request is retried with the same Idempotency-Key,
+// and rejects the key when it is reused with a different request. Keys are scoped to the caller, and
+// the reservation of a key is released when the request fails or panics so the client can retry it.
+// A key whose request was lost keeps its reservation, as the request may have been processed.
+func idempotent(keys idempotency.Repository) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+
+		body, err := ioutil.ReadAll(ctx.Request.Body)
+		if err != nil {
+			abortWithBindError(ctx, err)
+			return
+		}
+		ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		identity, _ := auth.FromContext(ctx.Request.Context())
+		requestHash := hashRequest(ctx.Request.Method, ctx.FullPath(), body)
+
+		if err = keys.Reserve(ctx.Request.Context(), identity.UserID, key, requestHash); err != nil {
+			if err != idempotency.ErrorKeyAlreadyExist {
+				abortWithError(ctx, err)
+				return
+			}
+
+			record, err := keys.Get(ctx.Request.Context(), identity.UserID, key)
+			if err != nil {
+				abortWithError(ctx, err)
+				return
+			}
+
+			replay(ctx, record, requestHash)
+			return
+		}
+
+		// the outcome is stored even when the client went away, it is what a retry is answered with
+		storeCtx := context.WithoutCancel(ctx.Request.Context())
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if err := keys.Release(storeCtx, identity.UserID, key); err != nil {
+					_ = ctx.Error(err)
+				}
+				panic(recovered)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+		ctx.Writer = recorder
+		ctx.Next()
+
+		// server errors are not stored so the client can retry the request
+		if recorder.Status() >= http.StatusInternalServerError {
+			if err = keys.Release(storeCtx, identity.UserID, key); err != nil {
+				_ = ctx.Error(err)
+			}
+			return
+		}
+
+		if err = keys.Complete(storeCtx, identity.UserID, key, recorder.Status(), recorder.body.Bytes()); err != nil {
+			_ = ctx.Error(err)
+		}
+	}
+}
+
+func replay(ctx *gin.Context, record idempotency.Record, requestHash string) {
+	if record.RequestHash != requestHash {
+		abortWithError(ctx, idempotency.ErrorKeyReused)
+		return
+	}
+
+	if record.Expired {
+		abortWithError(ctx, idempotency.ErrorOutcomeUnknown)
+		return
+	}
+
+	if record.StatusCode == 0 {
+		abortWithError(ctx, idempotency.ErrorRequestInProgress)
+		return
+	}
+
+	ctx.Data(record.StatusCode, gin.MIMEJSON+"; charset=utf-8", record.ResponseBody)
+	ctx.Abort()
+}
+
+// hashRequest identifies a request by its route and body, so a key reused with another request is rejected
+func hashRequest(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body to store it with the key
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(data string) (int, error) {
+	r.body.WriteString(data)
+	return r.ResponseWriter.WriteString(data)
+}
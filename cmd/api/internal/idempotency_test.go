@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/spolia/lemon-wallet/internal/wallet/idempotency"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Idempotent_FirstRequest_StoresResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	body, err := ioutil.ReadFile("testdata/create_movement_ok.json")
+	require.NoError(t, err)
+	hash := hashRequest(http.MethodPost, "/movements", body)
+
+	// When
+	service := &serviceMock{}
+	service.On("CreateMovement").Return(int64(1), nil).Once()
+	keys := &idempotencyRepositoryMock{}
+	keys.On("Reserve", int64(1), "key", hash).Return(nil).Once()
+	keys.On("Complete", int64(1), "key", http.StatusCreated, []byte("1")).Return(nil).Once()
+
+	rr := serveIdempotent(t, service, keys, "key", body)
+
+	// Then
+	require.Equal(t, http.StatusCreated, rr.Code)
+	keys.AssertExpectations(t)
+	service.AssertExpectations(t)
+}
+
+func Test_Idempotent_Retry_ReplaysResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	body, err := ioutil.ReadFile("testdata/create_movement_ok.json")
+	require.NoError(t, err)
+	hash := hashRequest(http.MethodPost, "/movements", body)
+
+	// When
+	service := &serviceMock{}
+	keys := &idempotencyRepositoryMock{}
+	keys.On("Reserve", int64(1), "key", hash).Return(idempotency.ErrorKeyAlreadyExist).Once()
+	keys.On("Get", int64(1), "key").Return(idempotency.Record{
+		Key:          "key",
+		RequestHash:  hash,
+		StatusCode:   http.StatusCreated,
+		ResponseBody: []byte("1"),
+	}, nil).Once()
+
+	rr := serveIdempotent(t, service, keys, "key", body)
+
+	// Then
+	require.Equal(t, http.StatusCreated, rr.Code)
+	require.Equal(t, "1", rr.Body.String())
+	service.AssertNotCalled(t, "CreateMovement")
+}
+
+func Test_Idempotent_Conflicts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body, err := ioutil.ReadFile("testdata/create_movement_ok.json")
+	require.NoError(t, err)
+	hash := hashRequest(http.MethodPost, "/movements", body)
+
+	tt := []struct {
+		TestName     string
+		Record       idempotency.Record
+		ExpectedCode string
+	}{
+		{"KeyReused", idempotency.Record{Key: "key", RequestHash: "other", StatusCode: http.StatusCreated}, "idempotency_key_reused"},
+		{"RequestInProgress", idempotency.Record{Key: "key", RequestHash: hash}, "request_in_progress"},
+		{"OutcomeUnknown", idempotency.Record{Key: "key", RequestHash: hash, Expired: true}, "request_outcome_unknown"},
+		{"ExpiredKeyReused", idempotency.Record{Key: "key", RequestHash: "other", Expired: true}, "idempotency_key_reused"},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+		keys := &idempotencyRepositoryMock{}
+		keys.On("Reserve", int64(1), "key", hash).Return(idempotency.ErrorKeyAlreadyExist).Once()
+		keys.On("Get", int64(1), "key").Return(tc.Record, nil).Once()
+
+		rr := serveIdempotent(t, service, keys, "key", body)
+
+		// Then
+		require.Equal(t, http.StatusConflict, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+		var response ErrorResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response), tc.TestName)
+		require.Equal(t, tc.ExpectedCode, response.Code, tc.TestName)
+		service.AssertNotCalled(t, "CreateMovement")
+	}
+}
+
+func Test_Idempotent_ServerError_ReleasesKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	body, err := ioutil.ReadFile("testdata/create_movement_ok.json")
+	require.NoError(t, err)
+	hash := hashRequest(http.MethodPost, "/movements", body)
+
+	// When
+	service := &serviceMock{}
+	service.On("CreateMovement").Return(int64(0), errors.New("fail")).Once()
+	keys := &idempotencyRepositoryMock{}
+	keys.On("Reserve", int64(1), "key", hash).Return(nil).Once()
+	keys.On("Release", int64(1), "key").Return(nil).Once()
+
+	rr := serveIdempotent(t, service, keys, "key", body)
+
+	// Then
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	keys.AssertExpectations(t)
+}
+
+func Test_Idempotent_KeyOfOtherCaller_ProcessesRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	body, err := ioutil.ReadFile("testdata/create_movement_ok.json")
+	require.NoError(t, err)
+	hash := hashRequest(http.MethodPost, "/movements", body)
+
+	// When
+	service := &serviceMock{}
+	service.On("GetCurrency", "usdt").Return(currency.Currency{Name: "USDT", Digits: 2}, nil)
+	service.On("CreateMovement").Return(int64(2), nil).Once()
+	keys := &idempotencyRepositoryMock{}
+	keys.On("Reserve", int64(3), "key", hash).Return(nil).Once()
+	keys.On("Complete", int64(3), "key", http.StatusCreated, []byte("2")).Return(nil).Once()
+
+	rr := httptest.NewRecorder()
+	router := gin.Default()
+	API(router, service, keys, newAuthenticatorMock(), logging.Discard())
+	request, err := http.NewRequest(http.MethodPost, "/movements", bytes.NewReader(body))
+	require.NoError(t, err)
+	request.Header.Set(idempotencyKeyHeader, "key")
+	request.Header.Set("Authorization", "Bearer "+adminToken)
+	router.ServeHTTP(rr, request)
+
+	// Then
+	require.Equal(t, http.StatusCreated, rr.Code)
+	require.Equal(t, "2", rr.Body.String())
+	keys.AssertExpectations(t)
+	keys.AssertNotCalled(t, "Get", int64(1), "key")
+}
+
+func Test_Idempotent_Panic_ReleasesKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	body, err := ioutil.ReadFile("testdata/create_movement_ok.json")
+	require.NoError(t, err)
+	hash := hashRequest(http.MethodPost, "/movements", body)
+
+	// When
+	service := &serviceMock{}
+	service.On("CreateMovement").Run(func(mock.Arguments) { panic("boom") }).Return(int64(0), nil).Once()
+	keys := &idempotencyRepositoryMock{}
+	keys.On("Reserve", int64(1), "key", hash).Return(nil).Once()
+	keys.On("Release", int64(1), "key").Return(nil).Once()
+
+	rr := serveIdempotent(t, service, keys, "key", body)
+
+	// Then
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	keys.AssertExpectations(t)
+	keys.AssertNotCalled(t, "Complete", int64(1), "key", mock.Anything, mock.Anything)
+}
+
+func serveIdempotent(t *testing.T, service *serviceMock, keys idempotency.Repository, key string, body []byte) *httptest.ResponseRecorder {
+	service.On("GetCurrency", "usdt").Return(currency.Currency{Name: "USDT", Digits: 2}, nil)
+	rr := httptest.NewRecorder()
+	router := gin.Default()
+	API(router, service, keys, newAuthenticatorMock(), logging.Discard())
+	request, err := http.NewRequest(http.MethodPost, "/movements", bytes.NewReader(body))
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+userToken)
+	request.Header.Set(idempotencyKeyHeader, key)
+
+	router.ServeHTTP(rr, request)
+	return rr
+}
+
+type idempotencyRepositoryMock struct {
+	mock.Mock
+}
+
+func (i *idempotencyRepositoryMock) Reserve(ctx context.Context, callerID int64, key, requestHash string) error {
+	args := i.Called(callerID, key, requestHash)
+	return args.Error(0)
+}
+
+func (i *idempotencyRepositoryMock) Get(ctx context.Context, callerID int64, key string) (idempotency.Record, error) {
+	args := i.Called(callerID, key)
+	return args.Get(0).(idempotency.Record), args.Error(1)
+}
+
+func (i *idempotencyRepositoryMock) Complete(ctx context.Context, callerID int64, key string, statusCode int, responseBody []byte) error {
+	args := i.Called(callerID, key, statusCode, responseBody)
+	return args.Error(0)
+}
+
+func (i *idempotencyRepositoryMock) Release(ctx context.Context, callerID int64, key string) error {
+	args := i.Called(callerID, key)
+	return args.Error(0)
+}
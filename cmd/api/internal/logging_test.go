@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/requestid"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_accessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName      string
+		Error         error
+		ExpectedLevel string
+		ExpectedError interface{}
+	}{
+		{"Ok", nil, "INFO", nil},
+		{"InternalServerError", errors.New("deadlock"), "ERROR", "Error #01: deadlock\n"},
+	}
+
+	for _, tc := range tt {
+		// Given
+		service := &serviceMock{}
+		service.On("CreateMovement").Return(int64(1), tc.Error)
+		service.On("GetCurrency", "usdt").Return(currency.Currency{Name: "USDT", Digits: 2}, nil)
+
+		var out bytes.Buffer
+		logger, err := logging.New(&out, "info")
+		require.NoError(t, err)
+		router := gin.New()
+		API(router, service, nil, newAuthenticatorMock(), logger)
+
+		body, err := ioutil.ReadFile("testdata/create_movement_ok.json")
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/movements", bytes.NewReader(body))
+		require.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+userToken)
+		request.Header.Set(requestid.Header, "req-1")
+
+		// When
+		router.ServeHTTP(httptest.NewRecorder(), request)
+
+		// Then
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &record), tc.TestName)
+		require.Equal(t, tc.ExpectedLevel, record["level"], tc.TestName)
+		require.Equal(t, "req-1", record["request_id"], tc.TestName)
+		require.Equal(t, "/movements", record["route"], tc.TestName)
+		require.Equal(t, tc.ExpectedError, record["error"], tc.TestName)
+	}
+}
+
+func Test_recovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	var out bytes.Buffer
+	logger, err := logging.New(&out, "info")
+	require.NoError(t, err)
+	router := gin.New()
+	API(router, &serviceMock{}, nil, newAuthenticatorMock(), logger)
+	router.GET("/panic", func(ctx *gin.Context) { panic("boom") })
+
+	// When
+	rr := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/panic", nil)
+	require.NoError(t, err)
+	request.Header.Set(requestid.Header, "req-1")
+	router.ServeHTTP(rr, request)
+
+	// Then
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.JSONEq(t, `{"code":"internal_error","message":"internal server error","request_id":"req-1"}`, rr.Body.String())
+	require.Contains(t, out.String(), `"msg":"panic","panic":"boom"`)
+	require.Contains(t, out.String(), `"status":500`)
+}
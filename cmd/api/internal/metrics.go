@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/metrics"
+)
+
+// unmatchedRoute labels the requests that match no route, so unknown paths do not add series
+const unmatchedRoute = "unmatched"
+
+// Metrics adds GET /metrics, in the Prometheus text format, and counts the requests of the routes added after it by
+// method, route and status
+func Metrics(router *gin.Engine, registry *metrics.Registry) {
+	requests := registry.Counter("http_requests_total", "Number of HTTP requests by method, route and status.",
+		"method", "route", "status")
+	latency := registry.Histogram("http_request_duration_seconds", "Latency of the HTTP requests by method and route.",
+		metrics.DefaultBuckets, "method", "route")
+
+	router.Use(func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		requests.Inc(ctx.Request.Method, route, strconv.Itoa(ctx.Writer.Status()))
+		latency.Observe(time.Since(start).Seconds(), ctx.Request.Method, route)
+	})
+	router.GET("/metrics", gin.WrapH(registry.Handler()))
+}
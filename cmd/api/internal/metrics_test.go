@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/metrics"
+	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Metrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	service := &serviceMock{}
+	service.On("GetUser").Return(user.User{ID: 1}, nil)
+	router := gin.New()
+	Metrics(router, metrics.New())
+	API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+	for _, url := range []string{"/users/1", "/users/2", "/unknown"} {
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+userToken)
+		router.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	// When
+	rr := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+	router.ServeHTTP(rr, request)
+
+	// Then
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, metrics.ContentType, rr.Header().Get("Content-Type"))
+	require.Contains(t, rr.Body.String(), `http_requests_total{method="GET",route="/users/:id",status="200"} 1`)
+	require.Contains(t, rr.Body.String(), `http_requests_total{method="GET",route="/users/:id",status="403"} 1`)
+	require.Contains(t, rr.Body.String(), `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	require.Contains(t, rr.Body.String(), `http_request_duration_seconds_count{method="GET",route="/users/:id"} 2`)
+}
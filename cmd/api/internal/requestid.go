@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/requestid"
+)
+
+// maxRequestIDLength bounds the request IDs sent by the clients, longer ones are replaced
+const maxRequestIDLength = 64
+
+// requestID binds the X-Request-ID of the request, or a new one, to the request context and echoes it in the
+// response
+func requestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(requestid.Header)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = requestid.New()
+		}
+
+		ctx.Header(requestid.Header, id)
+		ctx.Request = ctx.Request.WithContext(requestid.NewContext(ctx.Request.Context(), id))
+		ctx.Next()
+	}
+}
@@ -2,22 +2,99 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
+	"log/slog"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/spolia/lemon-wallet/internal/wallet/audit"
+	"github.com/spolia/lemon-wallet/internal/wallet/auth"
+	"github.com/spolia/lemon-wallet/internal/wallet/broadcast"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/spolia/lemon-wallet/internal/wallet/idempotency"
 	"github.com/spolia/lemon-wallet/internal/wallet/movement"
 	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/spolia/lemon-wallet/internal/wallet/webhook"
 )
 
 type Service interface {
 	CreateUser(ctx context.Context, name, lastName, alias, email string) (int64, error)
 	GetUser(ctx context.Context, id int64) (user.User, error)
+	CreateAPIKey(ctx context.Context, userID int64, scopes []string) (string, error)
 	CreateMovement(ctx context.Context, movement movement.Movement) (int64, error)
-	SearchMovement(ctx context.Context, userID int64, limit, offset uint64, movType, currencyName string) ([]movement.Row, error)
+	SearchMovement(ctx context.Context, filter movement.Filter) (movement.Page, error)
+	Transfer(ctx context.Context, transfer movement.Transfer) (movement.Transfer, error)
+	Exchange(ctx context.Context, exchange movement.Exchange) (movement.Exchange, error)
+	Currencies(ctx context.Context) []currency.Currency
+	GetCurrency(ctx context.Context, name string) (currency.Currency, error)
+	SearchUsers(ctx context.Context, text string, limit, offset uint64) ([]user.User, error)
+	FreezeUser(ctx context.Context, id int64) error
+	UnfreezeUser(ctx context.Context, id int64) error
+	Adjust(ctx context.Context, adjustment movement.Adjustment) (movement.Adjustment, error)
+	AuditEvents(ctx context.Context, filter audit.Filter) ([]audit.Event, error)
+	CreateWebhook(ctx context.Context, hook webhook.Webhook) (webhook.Webhook, error)
+	GetWebhook(ctx context.Context, id int64) (webhook.Webhook, error)
+	WebhookDeliveries(ctx context.Context, webhookID int64, limit, offset uint64) ([]webhook.Delivery, error)
+	Subscribe(ctx context.Context, userID int64) (<-chan broadcast.Event, func(), error)
 }
 
-func API(router *gin.Engine, service Service) {
-	router.POST("/users", createUser(service))
-	router.GET("/users/:id", getUser(service))
-	router.POST("/movements", createMovement(service))
-	router.GET("/movements/search", searchMovement(service))
+func API(router *gin.Engine, service Service, keys idempotency.Repository, authenticator Authenticator, logger *slog.Logger) {
+	validate := newValidator(service)
+	router.Use(requestID(), accessLog(logger), recovery(logger), func(ctx *gin.Context) {
+		ctx.Set(validatorKey, validate)
+	})
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(routeNotFound)
+	router.NoMethod(methodNotAllowed)
+
+	router.POST("/users", idempotent(keys), createUser(service))
+	router.GET("/currencies", listCurrencies(service))
+
+	router.GET("/users/:id/stream", authenticateStream(authenticator), streamUser(service))
+
+	authorized := router.Group("", authenticate(authenticator))
+	authorized.GET("/users/:id", getUser(service))
+	authorized.POST("/users/:id/stream/tickets", createStreamTicket(authenticator))
+	authorized.POST("/users/:id/apikeys", createAPIKey(service))
+	authorized.POST("/movements", idempotent(keys), createMovement(service))
+	authorized.GET("/movements/search", searchMovement(service))
+	authorized.POST("/transfers", idempotent(keys), createTransfer(service))
+	authorized.POST("/exchanges", idempotent(keys), createExchange(service))
+	authorized.POST("/webhooks", createWebhook(service))
+	authorized.GET("/webhooks/:id/deliveries", searchWebhookDeliveries(service))
+
+	admin := authorized.Group("/admin", requireScope(auth.ScopeAdmin))
+	admin.GET("/users", searchUsers(service))
+	admin.POST("/users/:id/freeze", freezeUser(service.FreezeUser))
+	admin.POST("/users/:id/unfreeze", freezeUser(service.UnfreezeUser))
+	admin.POST("/adjustments", idempotent(keys), createAdjustment(service))
+	admin.GET("/audit", searchAuditEvents(service))
+}
+
+// validatorKey is the key of the validator of the router in the gin context
+const validatorKey = "validator"
+
+// newValidator returns the validator of the request bodies of a router. It checks the binding tags, with the
+// "currency" tag accepting the currencies supported by the service, and names the fields of the validation errors
+// as the clients send them. Each router owns its validator, so the currencies of a router are never resolved
+// through the service of another one
+func newValidator(service Service) *validator.Validate {
+	validate := validator.New()
+	validate.SetTagName("binding")
+	validate.RegisterTagNameFunc(jsonTagName)
+	_ = validate.RegisterValidationCtx("currency", func(ctx context.Context, field validator.FieldLevel) bool {
+		_, err := service.GetCurrency(ctx, field.Field().String())
+		return err == nil
+	})
+
+	return validate
+}
+
+// bindJSON decodes the request body into obj and validates it with the validator of the router
+func bindJSON(ctx *gin.Context, obj interface{}) error {
+	if err := json.NewDecoder(ctx.Request.Body).Decode(obj); err != nil {
+		return err
+	}
+
+	return ctx.MustGet(validatorKey).(*validator.Validate).StructCtx(ctx.Request.Context(), obj)
 }
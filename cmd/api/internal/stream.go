@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/wallet/broadcast"
+)
+
+// keepAlive is the interval of the comments that keep an idle stream open through proxies
+var keepAlive = 15 * time.Second
+
+type connKey struct{}
+
+// ConnContext binds the connection to the context of its requests. It is the ConnContext of the http.Server, so the
+// streams can outlive its write timeout
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// extendWriteDeadline replaces the write timeout of the server for the connection of a stream: it is extended on
+// each write, so a client that stops reading is still dropped
+func extendWriteDeadline(ctx context.Context) {
+	if conn, ok := ctx.Value(connKey{}).(net.Conn); ok {
+		_ = conn.SetWriteDeadline(time.Now().Add(2 * keepAlive))
+	}
+}
+
+// createStreamTicket returns a ticket that opens the stream of the wallet of the user for a minute, for the browsers
+// whose EventSource can not send the Authorization header
+func createStreamTicket(authenticator Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "id", "must be an integer")
+			return
+		}
+
+		if !authorize(ctx, userID) {
+			return
+		}
+
+		ticket, err := authenticator.IssueStreamTicket(ctx.Request.Context(), userID)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, gin.H{"ticket": ticket})
+	}
+}
+
+// streamUser pushes the balances and movements of the wallet of the user as Server-Sent Events. The stream starts
+// with the current balance, and ends when the client goes away or falls behind, or the server shuts down, in which
+// case it should reconnect
+func streamUser(service Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "id", "must be an integer")
+			return
+		}
+
+		if !authorize(ctx, userID) {
+			return
+		}
+
+		// subscribed before reading the balance, so no movement committed meanwhile is missed
+		events, cancel, err := service.Subscribe(ctx.Request.Context(), userID)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+		defer cancel()
+
+		userResult, err := service.GetUser(ctx.Request.Context(), userID)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.Header("Cache-Control", "no-cache")
+		ctx.Header("X-Accel-Buffering", "no")
+		extendWriteDeadline(ctx.Request.Context())
+		ctx.SSEvent(broadcast.EventBalance, userResult.WalletStatement)
+		ctx.Writer.Flush()
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				extendWriteDeadline(ctx.Request.Context())
+				ctx.SSEvent(event.Type, event.Data)
+			case <-ticker.C:
+				extendWriteDeadline(ctx.Request.Context())
+				if _, err = ctx.Writer.WriteString(": keep-alive\n\n"); err != nil {
+					return
+				}
+			case <-ctx.Request.Context().Done():
+				return
+			}
+			ctx.Writer.Flush()
+		}
+	}
+}
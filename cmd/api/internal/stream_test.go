@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/wallet"
+	"github.com/spolia/lemon-wallet/internal/wallet/broadcast"
+	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Handler_API_streamUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Token, URL         string
+		ExpectedStatus               int
+		SubscribeError, GetUserError error
+	}{
+		{"Ok", userToken, "/users/1/stream", http.StatusOK, nil, nil},
+		{"OtherWallet", otherToken, "/users/1/stream", http.StatusForbidden, nil, nil},
+		{"WrongID", userToken, "/users/one/stream", http.StatusBadRequest, nil, nil},
+		{"ErrorStreamUnavailable", userToken, "/users/1/stream", http.StatusServiceUnavailable, wallet.ErrorStreamUnavailable, nil},
+		{"ErrorUserNotFound", adminToken, "/users/1/stream", http.StatusNotFound, nil, user.ErrorUserNotFound},
+		{"InternalServerError", userToken, "/users/1/stream", http.StatusInternalServerError, nil, errors.New("fail")},
+		{"Ticket", "", "/users/1/stream?ticket=ticket-1", http.StatusOK, nil, nil},
+		{"TicketOfOtherWallet", "", "/users/1/stream?ticket=ticket-2", http.StatusForbidden, nil, nil},
+		{"InvalidTicket", "", "/users/1/stream?ticket=wrong", http.StatusUnauthorized, nil, nil},
+		{"NoCredential", "", "/users/1/stream", http.StatusUnauthorized, nil, nil},
+	}
+
+	for _, tc := range tt {
+		// When
+		events := make(chan broadcast.Event, 1)
+		events <- broadcast.Event{Type: broadcast.EventMovement, UserID: 1, Data: movement.Movement{ID: 10,
+			Type: movement.DepositMov, Amount: decimal.RequireFromString("100"), CurrencyName: "ARS", UserID: 1}}
+		// the subscription ends after the movement, as when the client falls behind
+		close(events)
+		service := &serviceMock{}
+		service.On("Subscribe", int64(1)).Return(events, tc.SubscribeError)
+		service.On("GetUser").Return(user.User{ID: 1,
+			WalletStatement: movement.AccountExtract{"ARS": decimal.RequireFromString("50")}}, tc.GetUserError)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		request, err := http.NewRequest(http.MethodGet, tc.URL, nil)
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+tc.Token)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+		if tc.ExpectedStatus == http.StatusOK {
+			require.Equal(t, "text/event-stream", rr.Header().Get("Content-Type"))
+			require.True(t, strings.HasPrefix(rr.Body.String(), "event:balance\ndata:{\"ARS\":\"50\"}\n\n"), rr.Body.String())
+			require.Contains(t, rr.Body.String(), "event:movement\ndata:{\"id\":10,")
+		}
+	}
+}
+
+func Test_Handler_API_createStreamTicket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Token, URL string
+		ExpectedStatus       int
+	}{
+		{"Ok", userToken, "/users/1/stream/tickets", http.StatusCreated},
+		{"Admin", adminToken, "/users/1/stream/tickets", http.StatusCreated},
+		{"OtherWallet", otherToken, "/users/1/stream/tickets", http.StatusForbidden},
+		{"WrongID", userToken, "/users/one/stream/tickets", http.StatusBadRequest},
+	}
+
+	for _, tc := range tt {
+		// When
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, &serviceMock{}, nil, newAuthenticatorMock(), logging.Discard())
+
+		request, err := http.NewRequest(http.MethodPost, tc.URL, nil)
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+tc.Token)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+		if tc.ExpectedStatus == http.StatusCreated {
+			require.JSONEq(t, `{"ticket":"ticket-1"}`, rr.Body.String(), tc.TestName)
+		}
+	}
+}
+
+func Test_Handler_API_streamUser_OutlivesWriteTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	defer func(interval time.Duration) { keepAlive = interval }(keepAlive)
+	keepAlive = 20 * time.Millisecond
+
+	events := make(chan broadcast.Event, 1)
+	service := &serviceMock{}
+	service.On("Subscribe", int64(1)).Return(events, nil)
+	service.On("GetUser").Return(user.User{ID: 1}, nil)
+	router := gin.Default()
+	API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Config.ConnContext = ConnContext
+	server.Start()
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/users/1/stream", nil)
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+userToken)
+
+	// When
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	time.AfterFunc(300*time.Millisecond, func() {
+		events <- broadcast.Event{Type: broadcast.EventMovement, UserID: 1, Data: movement.Movement{ID: 10}}
+		close(events)
+	})
+
+	// Then
+	var received bool
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		if scanner.Text() == "event:movement" {
+			received = true
+		}
+	}
+	require.True(t, received)
+}
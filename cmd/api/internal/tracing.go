@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/requestid"
+	"github.com/spolia/lemon-wallet/internal/tracing"
+)
+
+// Tracing traces the requests of the routes added after it, each one in a span that is the child of the span of its
+// traceparent header when it has a valid one
+func Tracing(router *gin.Engine, tracer *tracing.Tracer) {
+	router.Use(func(ctx *gin.Context) {
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		requestCtx := ctx.Request.Context()
+		if parent, ok := tracing.ParseTraceparent(ctx.GetHeader(tracing.Header)); ok {
+			requestCtx = tracing.WithRemoteParent(requestCtx, parent)
+		}
+
+		requestCtx, span := tracer.Start(requestCtx, ctx.Request.Method+" "+route)
+		ctx.Request = ctx.Request.WithContext(requestCtx)
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttribute("http.method", ctx.Request.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", ctx.Request.URL.Path)
+		span.SetAttribute("http.status_code", strconv.Itoa(status))
+		span.SetAttribute("request_id", requestid.FromContext(ctx.Request.Context()))
+		if status >= http.StatusInternalServerError {
+			// the panics recovered leave no error in the context
+			var err error = errors.New(http.StatusText(status))
+			if last := ctx.Errors.Last(); last != nil {
+				err = last
+			}
+			span.SetError(err)
+		}
+		span.End()
+	})
+}
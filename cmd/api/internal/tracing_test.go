@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/tracing"
+	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Tracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Traceparent string
+		GetUserError          error
+		ExpectedTraceID       string
+		ExpectedParentID      string
+		ExpectedError         string
+	}{
+		{"Ok", "", nil, "", "", ""},
+		{"RemoteParent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", nil,
+			"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", ""},
+		{"InvalidTraceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", nil, "", "", ""},
+		{"InternalServerError", "", errors.New("fail"), "", "", "fail"},
+	}
+
+	for _, tc := range tt {
+		// Given
+		service := &serviceMock{}
+		service.On("GetUser").Return(user.User{ID: 1}, tc.GetUserError)
+		var exporter tracing.Memory
+		router := gin.New()
+		Tracing(router, tracing.New(&exporter))
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		request, err := http.NewRequest(http.MethodGet, "/users/1", nil)
+		require.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+userToken)
+		if tc.Traceparent != "" {
+			request.Header.Set(tracing.Header, tc.Traceparent)
+		}
+
+		// When
+		router.ServeHTTP(httptest.NewRecorder(), request)
+
+		// Then
+		spans := exporter.Spans()
+		require.Len(t, spans, 1, tc.TestName)
+		require.Equal(t, "GET /users/:id", spans[0].Name, tc.TestName)
+		require.Equal(t, "/users/:id", spans[0].Attributes["http.route"], tc.TestName)
+		require.NotEmpty(t, spans[0].Attributes["request_id"], tc.TestName)
+		require.Equal(t, tc.ExpectedParentID, spans[0].ParentID, tc.TestName)
+		require.Equal(t, tc.ExpectedError, spans[0].Error, tc.TestName)
+		if tc.ExpectedTraceID != "" {
+			require.Equal(t, tc.ExpectedTraceID, spans[0].TraceID, tc.TestName)
+		}
+	}
+}
+
+func Test_Tracing_RecoveredPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Given
+	var exporter tracing.Memory
+	router := gin.New()
+	Tracing(router, tracing.New(&exporter))
+	API(router, &serviceMock{}, nil, newAuthenticatorMock(), logging.Discard())
+	router.GET("/panic", func(ctx *gin.Context) { panic("boom") })
+
+	// When
+	request, err := http.NewRequest(http.MethodGet, "/panic", nil)
+	require.NoError(t, err)
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	// Then
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	require.Equal(t, "Internal Server Error", spans[0].Error)
+	require.Equal(t, "500", spans[0].Attributes["http.status_code"])
+}
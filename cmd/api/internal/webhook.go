@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/wallet/webhook"
+)
+
+// createWebhook registers an url notified of the movements of the wallet of the user. The response carries the
+// secret of the signatures, which is not returned again
+func createWebhook(service Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var webhookRequest webhook.Webhook
+		if err := bindJSON(ctx, &webhookRequest); err != nil {
+			abortWithBindError(ctx, err)
+			return
+		}
+
+		if !authorize(ctx, webhookRequest.UserID) {
+			return
+		}
+
+		webhookResult, err := service.CreateWebhook(ctx.Request.Context(), webhookRequest)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, webhookResult)
+	}
+}
+
+// searchWebhookDeliveries returns a page of the deliveries of a webhook, newest first
+func searchWebhookDeliveries(service Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		webhookID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "id", "must be an integer")
+			return
+		}
+
+		limit, err := strconv.ParseUint(ctx.DefaultQuery("limit", "0"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "limit", "must be a non negative integer")
+			return
+		}
+
+		offset, err := strconv.ParseUint(ctx.DefaultQuery("offset", "0"), 10, 64)
+		if err != nil {
+			abortWithInvalidParameter(ctx, "offset", "must be a non negative integer")
+			return
+		}
+
+		webhookResult, err := service.GetWebhook(ctx.Request.Context(), webhookID)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		if !authorize(ctx, webhookResult.UserID) {
+			return
+		}
+
+		deliveries, err := service.WebhookDeliveries(ctx.Request.Context(), webhookID, limit, offset)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusOK, deliveries)
+	}
+}
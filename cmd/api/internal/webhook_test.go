@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/wallet"
+	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/spolia/lemon-wallet/internal/wallet/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Handler_API_createWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Token, Filename string
+		ExpectedStatus            int
+		Error                     error
+	}{
+		{"Ok", userToken, "create_webhook_ok", http.StatusCreated, nil},
+		{"OtherWallet", otherToken, "create_webhook_ok", http.StatusForbidden, nil},
+		{"NoURL", userToken, "create_webhook_no_url", http.StatusBadRequest, nil},
+		{"ErrorInvalidURL", userToken, "create_webhook_ok", http.StatusBadRequest, webhook.ErrorInvalidURL},
+		{"ErrorUserNotFound", adminToken, "create_webhook_ok", http.StatusNotFound, user.ErrorUserNotFound},
+		{"ErrorWebhooksUnavailable", userToken, "create_webhook_ok", http.StatusServiceUnavailable, wallet.ErrorWebhooksUnavailable},
+		{"InternalServerError", userToken, "create_webhook_ok", http.StatusInternalServerError, errors.New("fail")},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+		service.On("CreateWebhook", webhook.Webhook{UserID: 1, URL: "https://partner.test/hooks"}).
+			Return(webhook.Webhook{ID: 4, UserID: 1, URL: "https://partner.test/hooks", Secret: "whsec_1"}, tc.Error)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+		body, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s.json", tc.Filename))
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body))
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+tc.Token)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+		if tc.ExpectedStatus == http.StatusCreated {
+			require.Contains(t, rr.Body.String(), `"secret":"whsec_1"`)
+		}
+	}
+}
+
+func Test_Handler_API_searchWebhookDeliveries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tt := []struct {
+		TestName, Token, URL string
+		ExpectedStatus       int
+		WebhookError, Error  error
+	}{
+		{"Ok", userToken, "/webhooks/4/deliveries?limit=10", http.StatusOK, nil, nil},
+		{"OtherWallet", otherToken, "/webhooks/4/deliveries?limit=10", http.StatusForbidden, nil, nil},
+		{"AdminReads", adminToken, "/webhooks/4/deliveries?limit=10", http.StatusOK, nil, nil},
+		{"WrongID", userToken, "/webhooks/four/deliveries", http.StatusBadRequest, nil, nil},
+		{"WrongLimit", userToken, "/webhooks/4/deliveries?limit=ten", http.StatusBadRequest, nil, nil},
+		{"ErrorWebhookNotFound", userToken, "/webhooks/4/deliveries?limit=10", http.StatusNotFound, webhook.ErrorWebhookNotFound, nil},
+		{"InternalServerError", userToken, "/webhooks/4/deliveries?limit=10", http.StatusInternalServerError, nil, errors.New("fail")},
+	}
+
+	for _, tc := range tt {
+		// When
+		service := &serviceMock{}
+		service.On("GetWebhook", int64(4)).Return(webhook.Webhook{ID: 4, UserID: 1}, tc.WebhookError)
+		service.On("WebhookDeliveries", int64(4), uint64(10), uint64(0)).
+			Return([]webhook.Delivery{{ID: 9, WebhookID: 4, Status: webhook.StatusDelivered}}, tc.Error)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		API(router, service, nil, newAuthenticatorMock(), logging.Discard())
+
+		request, err := http.NewRequest(http.MethodGet, tc.URL, nil)
+		assert.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer "+tc.Token)
+
+		router.ServeHTTP(rr, request)
+		// Then
+		require.Equal(t, tc.ExpectedStatus, rr.Code, "%s failed. Response: %v", tc.TestName, rr.Code)
+	}
+}
@@ -1,39 +1,234 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/spolia/lemon-wallet/cmd/api/internal"
+	"github.com/spolia/lemon-wallet/internal/config"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/metrics"
+	"github.com/spolia/lemon-wallet/internal/migration"
+	"github.com/spolia/lemon-wallet/internal/tracing"
 	"github.com/spolia/lemon-wallet/internal/wallet"
+	"github.com/spolia/lemon-wallet/internal/wallet/audit"
+	"github.com/spolia/lemon-wallet/internal/wallet/auth"
+	"github.com/spolia/lemon-wallet/internal/wallet/broadcast"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/spolia/lemon-wallet/internal/wallet/idempotency"
 	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+	"github.com/spolia/lemon-wallet/internal/wallet/outbox"
+	"github.com/spolia/lemon-wallet/internal/wallet/rate"
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
 	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/spolia/lemon-wallet/internal/wallet/webhook"
+	"github.com/spolia/lemon-wallet/migrations"
 )
 
 func main() {
-	log.Println("starting")
-	var err error
-	dataSourceName := fmt.Sprintf("%s:%s@tcp(%s)/%s?%s", "root", "rootroot", "127.0.0.1:3306", "wallet", "parseTime=true")
-	log.Println("datasource", dataSourceName)
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		fatal(slog.Default(), "invalid configuration", err)
+	}
 
-	db, err := sql.Open("mysql", dataSourceName)
+	logger, err := logging.New(os.Stdout, cfg.Log.Level)
 	if err != nil {
-		log.Fatal(err)
+		fatal(slog.Default(), "invalid log level", err)
 	}
+	slog.SetDefault(logger)
+	logger.Info("starting", "database", cfg.Database.String())
+
+	db, err := sql.Open("mysql", cfg.Database.DSN())
+	if err != nil {
+		fatal(logger, "open database", err)
+	}
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
 
 	if err := db.Ping(); err != nil {
-		log.Fatal(err)
+		fatal(logger, "ping database", err)
 	}
 
-	service := wallet.New(user.New(db), movement.New(db))
-	log.Println("service successfully configured")
+	all, err := migration.Parse(migrations.MySQL, "mysql")
+	if err != nil {
+		fatal(logger, "parse migrations", err)
+	}
+
+	currencies, err := currency.Load(context.Background(), currency.New(db))
+	if err != nil {
+		fatal(logger, "load currencies", err)
+	}
+
+	// ctx is done on SIGTERM or SIGINT, which stops the server and the workers
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	apiKeys := auth.New(db)
+	var options = []wallet.Option{wallet.WithAuditLog(audit.New(db)), wallet.WithAPIKeys(apiKeys), wallet.WithLogger(logger)}
+	if cfg.Features.Exchanges {
+		rates, err := rate.NewFromFile(cfg.RatesFile)
+		if err != nil {
+			fatal(logger, "load rates", err)
+		}
+		options = append(options, wallet.WithRateProvider(rates))
+	}
 
-	router := gin.Default()
-	internal.API(router, service)
+	if cfg.Features.Events {
+		options = append(options, wallet.WithOutbox(outbox.New(db)))
+	}
+
+	if cfg.Features.Webhooks {
+		options = append(options, wallet.WithWebhooks(webhook.New(db)))
+	}
+
+	var broadcaster *broadcast.Broadcaster
+	if cfg.Features.Stream {
+		broadcaster = broadcast.New(16)
+		options = append(options, wallet.WithBroadcaster(broadcaster))
+	}
+
+	var registry *metrics.Registry
+	var queries *metrics.Histogram
+	if cfg.Features.Metrics {
+		registry = metrics.New()
+		metrics.RegisterDBStats(registry, db)
+		queries = registry.Histogram("wallet_db_query_duration_seconds", "Latency of the repository methods.",
+			metrics.DefaultBuckets, "repository", "method")
+		options = append(options, wallet.WithMetrics(registry))
+	}
+
+	var tracer *tracing.Tracer
+	if cfg.Tracing.Exporter == config.ExporterStdout {
+		tracer = tracing.New(tracing.NewWriterExporter(os.Stdout))
+		options = append(options, wallet.WithTracer(tracer))
+	}
+
+	// the nil metrics and tracer of the disabled features do nothing
+	userRepo := user.Instrument(user.New(db, logger), queries, tracer)
+	movementRepo := movement.Instrument(movement.New(db, currencies, logger), queries, tracer)
+	service := wallet.New(userRepo, movementRepo, currencies, txn.New(db), options...)
+	logger.Info("service successfully configured")
+
+	var workers sync.WaitGroup
+	run := func(worker func(ctx context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker(ctx)
+		}()
+	}
+
+	if cfg.Features.Events {
+		// the events are written as JSON lines to stdout, or appended to the events file
+		var events = os.Stdout
+		if cfg.EventsFile != "" {
+			if events, err = os.OpenFile(cfg.EventsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+				fatal(logger, "open events file", err)
+			}
+			defer events.Close()
+		}
+
+		var publisher outbox.Publisher = outbox.NewWriterPublisher(events)
+		if cfg.Features.Webhooks {
+			publisher = outbox.NewFanout(publisher, webhook.NewDispatcher(webhook.New(db)))
+		}
+		run(outbox.NewRelay(outbox.New(db), txn.New(db), publisher, 100, time.Second, logger).Run)
+	}
+
+	if cfg.Features.Webhooks {
+		run(webhook.NewDeliverer(webhook.New(db), txn.New(db), webhook.NewClient(10*time.Second), 20,
+			time.Second, logger).Run)
+	}
+
+	if cfg.Log.Level != config.LevelDebug {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// the API logs the requests and recovers the panics itself, with the request IDs
+	router := gin.New()
+	if registry != nil {
+		internal.Metrics(router, registry)
+	}
+	if tracer != nil {
+		internal.Tracing(router, tracer)
+	}
+	internal.API(router, service, idempotency.New(db), auth.NewAuthenticator([]byte(cfg.Auth.JWTSecret), apiKeys),
+		logger)
+	internal.Probes(router,
+		internal.Check{Name: "database", Run: db.PingContext},
+		internal.Check{Name: "migrations", Run: func(ctx context.Context) error {
+			pending, err := migration.New(db, all).Pending(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(pending) > 0 {
+				return fmt.Errorf("%d pending migrations", len(pending))
+			}
+			return nil
+		}})
+
+	server := &http.Server{
+		Addr:         cfg.Server.Addr,
+		Handler:      router,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		ConnContext:  internal.ConnContext,
+	}
+	if broadcaster != nil {
+		// the streams never go idle, so they are ended for the shutdown to finish
+		server.RegisterOnShutdown(broadcaster.Close)
+	}
+
+	var serveErr = make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	logger.Info("listening", "addr", cfg.Server.Addr)
+
+	var failed bool
+	select {
+	case err = <-serveErr:
+		logger.Error("serve failed", "error", err)
+		failed = true
+	case <-ctx.Done():
+		logger.Info("shutting down")
+	}
+	stop()
+
+	// the requests in flight are drained before the database is closed, so no movement is cut halfway
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("shutdown failed", "error", err)
+		failed = true
+	}
+	workers.Wait()
+
+	if err = db.Close(); err != nil {
+		logger.Error("close database", "error", err)
+	}
+	logger.Info("stopped")
+
+	if failed {
+		os.Exit(1)
+	}
+}
 
-	router.Run("localhost:8080")
-	log.Println("listening")
+// fatal logs the error that prevents the API from starting and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/spolia/lemon-wallet/internal/config"
+	"github.com/spolia/lemon-wallet/internal/migration"
+	"github.com/spolia/lemon-wallet/migrations"
+)
+
+func main() {
+	dataSourceName := flag.String("dsn", "", "mysql data source name, read from WALLET_CONFIG and WALLET_DB_* when empty")
+	status := flag.Bool("status", false, "list the pending migrations without applying them")
+	flag.Parse()
+
+	if *dataSourceName == "" {
+		database, err := config.LoadDatabase(os.Getenv)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*dataSourceName = database.DSN()
+	}
+
+	db, err := sql.Open("mysql", *dataSourceName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	all, err := migration.Parse(migrations.MySQL, "mysql")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	runner := migration.New(db, all)
+	ctx := context.Background()
+	if *status {
+		pending, err := runner.Pending(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, v := range pending {
+			log.Printf("pending %04d_%s", v.Version, v.Name)
+		}
+		log.Printf("%d pending migrations", len(pending))
+		return
+	}
+
+	applied, err := runner.Up(ctx)
+	for _, v := range applied {
+		log.Printf("applied %04d_%s", v.Version, v.Name)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%d migrations applied", len(applied))
+}
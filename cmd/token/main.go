@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/wallet/auth"
+)
+
+// token signs a token with the WALLET_JWT_SECRET key the api validates, e.g. for an admin:
+// go run ./cmd/token -user 1 -scopes admin -ttl 1h
+func main() {
+	userID := flag.Int64("user", 0, "id of the user the token authenticates")
+	scopes := flag.String("scopes", "", "comma separated scopes granted to the token")
+	ttl := flag.Duration("ttl", time.Hour, "time until the token expires")
+	flag.Parse()
+
+	secret := os.Getenv("WALLET_JWT_SECRET")
+	if secret == "" || *userID <= 0 {
+		flag.Usage()
+		log.Fatal("WALLET_JWT_SECRET and -user are required")
+	}
+
+	var identity = auth.Identity{UserID: *userID}
+	if *scopes != "" {
+		identity.Scopes = strings.Split(*scopes, ",")
+	}
+
+	token, err := auth.SignToken([]byte(secret), identity, time.Now(), *ttl)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(token)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/spolia/lemon-wallet/internal/config"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+)
+
+// verify-ledger walks the hash chain of the movements of every balance and reports the movements altered after they
+// were saved and the balances that do not match their movements. It exits with status 1 when it finds any:
+// go run ./cmd/verify-ledger -dsn 'user:password@tcp(host:3306)/wallet?parseTime=true'
+func main() {
+	dataSourceName := flag.String("dsn", "", "mysql data source name, read from WALLET_CONFIG and WALLET_DB_* when empty")
+	flag.Parse()
+
+	if *dataSourceName == "" {
+		database, err := config.LoadDatabase(os.Getenv)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*dataSourceName = database.DSN()
+	}
+
+	db, err := sql.Open("mysql", *dataSourceName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	// the verification reads every currency found in the movements, so it needs no registry
+	report, err := movement.New(db, nil, logging.Discard()).Verify(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, v := range report.Issues {
+		if v.MovementID != 0 {
+			log.Printf("user %d %s movement %d: %s", v.UserID, v.CurrencyName, v.MovementID, v.Problem)
+			continue
+		}
+		log.Printf("user %d %s balance: %s", v.UserID, v.CurrencyName, v.Problem)
+	}
+
+	log.Printf("%d chains, %d movements, %d without hash, %d issues", report.Chains, report.Movements, report.Unsealed,
+		len(report.Issues))
+	if len(report.Issues) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+)
+
+var (
+	ErrorMissingSecret   = errors.New("config: auth.jwt_secret (WALLET_JWT_SECRET) is required to validate the tokens")
+	ErrorInvalidLogLevel = errors.New("config: log.level must be debug, info, warn or error")
+	ErrorEventsDisabled  = errors.New("config: webhooks need the events feature")
+	ErrorInvalidExporter = errors.New("config: tracing.exporter must be none or stdout")
+)
+
+// Config is the configuration of the API. It is loaded from the defaults, an optional YAML file, the environment
+// and the flags, each one overriding the previous ones
+type Config struct {
+	Database Database `yaml:"database"`
+	Server   Server   `yaml:"server"`
+	Log      Log      `yaml:"log"`
+	Auth     Auth     `yaml:"auth"`
+	Features Features `yaml:"features"`
+	Tracing  Tracing  `yaml:"tracing"`
+	// RatesFile is the JSON file the exchange rates are read from
+	RatesFile string `yaml:"rates_file"`
+	// EventsFile is the file the domain events are appended to, the standard output when empty
+	EventsFile string `yaml:"events_file"`
+}
+
+type Database struct {
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	Name            string        `yaml:"name"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+type Server struct {
+	Addr         string        `yaml:"addr"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout bounds the wait for the requests in flight when the server is stopped
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type Log struct {
+	Level string `yaml:"level"`
+}
+
+type Auth struct {
+	JWTSecret string `yaml:"jwt_secret"`
+}
+
+// Tracing selects where the spans of the requests are exported, none by default
+type Tracing struct {
+	Exporter string `yaml:"exporter"`
+}
+
+// Features turns on and off the optional parts of the API
+type Features struct {
+	Exchanges bool `yaml:"exchanges"`
+	Events    bool `yaml:"events"`
+	Webhooks  bool `yaml:"webhooks"`
+	Stream    bool `yaml:"stream"`
+	Metrics   bool `yaml:"metrics"`
+}
+
+// Default returns the configuration of a local run, without credentials
+func Default() Config {
+	return Config{
+		Database: Database{
+			Host:            "127.0.0.1",
+			Port:            3306,
+			Name:            "wallet",
+			User:            "root",
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 5 * time.Minute,
+		},
+		Server: Server{
+			Addr:            "localhost:8080",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 20 * time.Second,
+		},
+		Log:       Log{Level: LevelInfo},
+		Tracing:   Tracing{Exporter: ExporterNone},
+		Features:  Features{Exchanges: true, Events: true, Webhooks: true, Stream: true, Metrics: true},
+		RatesFile: "rates.json",
+	}
+}
+
+// variables are the environment variables and the setting each one overrides
+var variables = []struct {
+	name    string
+	setting func(c *Config) interface{}
+}{
+	{"WALLET_DB_HOST", func(c *Config) interface{} { return &c.Database.Host }},
+	{"WALLET_DB_PORT", func(c *Config) interface{} { return &c.Database.Port }},
+	{"WALLET_DB_NAME", func(c *Config) interface{} { return &c.Database.Name }},
+	{"WALLET_DB_USER", func(c *Config) interface{} { return &c.Database.User }},
+	{"WALLET_DB_PASSWORD", func(c *Config) interface{} { return &c.Database.Password }},
+	{"WALLET_DB_MAX_OPEN_CONNS", func(c *Config) interface{} { return &c.Database.MaxOpenConns }},
+	{"WALLET_DB_MAX_IDLE_CONNS", func(c *Config) interface{} { return &c.Database.MaxIdleConns }},
+	{"WALLET_DB_CONN_MAX_LIFETIME", func(c *Config) interface{} { return &c.Database.ConnMaxLifetime }},
+	{"WALLET_ADDR", func(c *Config) interface{} { return &c.Server.Addr }},
+	{"WALLET_READ_TIMEOUT", func(c *Config) interface{} { return &c.Server.ReadTimeout }},
+	{"WALLET_WRITE_TIMEOUT", func(c *Config) interface{} { return &c.Server.WriteTimeout }},
+	{"WALLET_IDLE_TIMEOUT", func(c *Config) interface{} { return &c.Server.IdleTimeout }},
+	{"WALLET_SHUTDOWN_TIMEOUT", func(c *Config) interface{} { return &c.Server.ShutdownTimeout }},
+	{"WALLET_LOG_LEVEL", func(c *Config) interface{} { return &c.Log.Level }},
+	{"WALLET_JWT_SECRET", func(c *Config) interface{} { return &c.Auth.JWTSecret }},
+	{"WALLET_FEATURE_EXCHANGES", func(c *Config) interface{} { return &c.Features.Exchanges }},
+	{"WALLET_FEATURE_EVENTS", func(c *Config) interface{} { return &c.Features.Events }},
+	{"WALLET_FEATURE_WEBHOOKS", func(c *Config) interface{} { return &c.Features.Webhooks }},
+	{"WALLET_FEATURE_STREAM", func(c *Config) interface{} { return &c.Features.Stream }},
+	{"WALLET_FEATURE_METRICS", func(c *Config) interface{} { return &c.Features.Metrics }},
+	{"WALLET_TRACING_EXPORTER", func(c *Config) interface{} { return &c.Tracing.Exporter }},
+	{"WALLET_RATES_FILE", func(c *Config) interface{} { return &c.RatesFile }},
+	{"WALLET_EVENTS_FILE", func(c *Config) interface{} { return &c.EventsFile }},
+}
+
+// Load reads the configuration from the command line arguments, without the program name, and the environment.
+// The -config flag, or WALLET_CONFIG, names the YAML file
+func Load(args []string, getenv func(string) string) (Config, error) {
+	flags := flag.NewFlagSet("api", flag.ContinueOnError)
+	path := flags.String("config", getenv("WALLET_CONFIG"), "YAML configuration file")
+	addr := flags.String("addr", "", "address to listen on, e.g. :8080")
+	level := flags.String("log-level", "", "log level: debug, info, warn or error")
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	config, err := load(*path, getenv, "WALLET_")
+	if err != nil {
+		return Config{}, err
+	}
+
+	if *addr != "" {
+		config.Server.Addr = *addr
+	}
+
+	if *level != "" {
+		config.Log.Level = *level
+	}
+
+	return config, config.Validate()
+}
+
+// LoadDatabase reads the database settings like Load, from the defaults, the file named by WALLET_CONFIG and the
+// WALLET_DB_* variables, for the commands that only need the database
+func LoadDatabase(getenv func(string) string) (Database, error) {
+	config, err := load(getenv("WALLET_CONFIG"), getenv, "WALLET_DB_")
+	if err != nil {
+		return Database{}, err
+	}
+
+	return config.Database, nil
+}
+
+// load reads the defaults overridden by the YAML file, if any, and the environment variables with the prefix
+func load(path string, getenv func(string) string, prefix string) (Config, error) {
+	config := Default()
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+
+		if err = yaml.UnmarshalStrict(content, &config); err != nil {
+			return Config{}, fmt.Errorf("config: %s: %w", path, err)
+		}
+	}
+
+	for _, v := range variables {
+		value := getenv(v.name)
+		if value == "" || !strings.HasPrefix(v.name, prefix) {
+			continue
+		}
+
+		if err := set(v.setting(&config), value); err != nil {
+			return Config{}, fmt.Errorf("config: %s: %w", v.name, err)
+		}
+	}
+
+	return config, nil
+}
+
+// set parses the value into the setting
+func set(setting interface{}, value string) error {
+	var err error
+	switch v := setting.(type) {
+	case *string:
+		*v = value
+	case *int:
+		*v, err = strconv.Atoi(value)
+	case *bool:
+		*v, err = strconv.ParseBool(value)
+	case *time.Duration:
+		*v, err = time.ParseDuration(value)
+	}
+
+	return err
+}
+
+// Validate checks the settings the API can not start without
+func (c Config) Validate() error {
+	if c.Auth.JWTSecret == "" {
+		return ErrorMissingSecret
+	}
+
+	switch c.Log.Level {
+	case LevelDebug, LevelInfo, LevelWarn, LevelError:
+	default:
+		return ErrorInvalidLogLevel
+	}
+
+	if c.Features.Webhooks && !c.Features.Events {
+		return ErrorEventsDisabled
+	}
+
+	if c.Tracing.Exporter != ExporterNone && c.Tracing.Exporter != ExporterStdout {
+		return ErrorInvalidExporter
+	}
+
+	return nil
+}
+
+// DSN returns the data source name of the database
+func (d Database) DSN() string {
+	config := mysql.NewConfig()
+	config.User = d.User
+	config.Passwd = d.Password
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(d.Host, strconv.Itoa(d.Port))
+	config.DBName = d.Name
+	config.ParseTime = true
+	return config.FormatDSN()
+}
+
+// String returns the data source name without the password, so the database can be logged
+func (d Database) String() string {
+	if d.Password == "" {
+		return d.DSN()
+	}
+
+	d.Password = "***"
+	return d.DSN()
+}
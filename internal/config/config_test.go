@@ -0,0 +1,108 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_Defaults(t *testing.T) {
+	// Given
+	env := map[string]string{"WALLET_JWT_SECRET": "secret"}
+
+	// When
+	config, err := Load(nil, getenv(env))
+
+	// Then
+	require.NoError(t, err)
+	expected := Default()
+	expected.Auth.JWTSecret = "secret"
+	require.Equal(t, expected, config)
+	require.Equal(t, "root@tcp(127.0.0.1:3306)/wallet?parseTime=true", config.Database.DSN())
+}
+
+func TestLoad_FileEnvAndFlags(t *testing.T) {
+	// Given
+	env := map[string]string{
+		"WALLET_CONFIG":           "testdata/config.yaml",
+		"WALLET_JWT_SECRET":       "secret",
+		"WALLET_DB_PASSWORD":      "from-env",
+		"WALLET_READ_TIMEOUT":     "5s",
+		"WALLET_FEATURE_WEBHOOKS": "false",
+		"WALLET_ADDR":             ":7070",
+	}
+
+	// When
+	config, err := Load([]string{"-addr", ":8081"}, getenv(env))
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, Database{Host: "db.internal", Port: 3306, Name: "wallet_prod", User: "wallet", Password: "from-env",
+		MaxOpenConns: 50, MaxIdleConns: 10, ConnMaxLifetime: time.Minute}, config.Database)
+	require.Equal(t, Server{Addr: ":8081", ReadTimeout: 5 * time.Second, WriteTimeout: time.Minute,
+		IdleTimeout: 2 * time.Minute, ShutdownTimeout: 20 * time.Second}, config.Server)
+	require.Equal(t, LevelWarn, config.Log.Level)
+	require.Equal(t, Features{Exchanges: true, Events: true, Webhooks: false, Stream: false, Metrics: true}, config.Features)
+	require.Equal(t, ExporterStdout, config.Tracing.Exporter)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tt := []struct {
+		TestName string
+		Args     []string
+		Env      map[string]string
+		Expected string
+	}{
+		{"MissingSecret", nil, map[string]string{}, ErrorMissingSecret.Error()},
+		{"InvalidLogLevel", []string{"-log-level", "verbose"}, map[string]string{"WALLET_JWT_SECRET": "secret"},
+			ErrorInvalidLogLevel.Error()},
+		{"WebhooksWithoutEvents", nil, map[string]string{"WALLET_JWT_SECRET": "secret", "WALLET_FEATURE_EVENTS": "false"},
+			ErrorEventsDisabled.Error()},
+		{"InvalidExporter", nil, map[string]string{"WALLET_JWT_SECRET": "secret", "WALLET_TRACING_EXPORTER": "jaeger"},
+			ErrorInvalidExporter.Error()},
+		{"InvalidDuration", nil, map[string]string{"WALLET_JWT_SECRET": "secret", "WALLET_READ_TIMEOUT": "10"},
+			`config: WALLET_READ_TIMEOUT: time: missing unit in duration "10"`},
+		{"UnknownField", []string{"-config", "testdata/unknown_field.yaml"}, map[string]string{"WALLET_JWT_SECRET": "secret"},
+			"config: testdata/unknown_field.yaml: yaml: unmarshal errors:\n  line 2: field hots not found in type config.Database"},
+	}
+
+	for _, tc := range tt {
+		// When
+		_, err := Load(tc.Args, getenv(tc.Env))
+
+		// Then
+		require.EqualError(t, err, tc.Expected, tc.TestName)
+	}
+}
+
+func TestDatabase_String_HidesPassword(t *testing.T) {
+	// Given
+	database := Database{Host: "db.internal", Port: 3306, Name: "wallet", User: "wallet", Password: "rootroot"}
+
+	// Then
+	require.Equal(t, "wallet:rootroot@tcp(db.internal:3306)/wallet?parseTime=true", database.DSN())
+	require.Equal(t, "wallet:***@tcp(db.internal:3306)/wallet?parseTime=true", database.String())
+}
+
+func TestLoadDatabase(t *testing.T) {
+	// Given
+	env := map[string]string{
+		"WALLET_DB_HOST":     "db.internal",
+		"WALLET_DB_PASSWORD": "from-env",
+		"WALLET_LOG_LEVEL":   "verbose",
+	}
+
+	// When
+	database, err := LoadDatabase(getenv(env))
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, "root:from-env@tcp(db.internal:3306)/wallet?parseTime=true", database.DSN())
+}
+
+func getenv(env map[string]string) func(string) string {
+	return func(name string) string {
+		return env[name]
+	}
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/spolia/lemon-wallet/internal/requestid"
+	"github.com/spolia/lemon-wallet/internal/tracing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_AddsRequestID(t *testing.T) {
+	// Given
+	var out bytes.Buffer
+	logger, err := New(&out, "info")
+	require.NoError(t, err)
+
+	// When
+	logger.With("component", "test").InfoContext(requestid.NewContext(context.Background(), "req-1"), "saved", "id", 7)
+	logger.Debug("hidden")
+
+	// Then
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &record))
+	require.Equal(t, "INFO", record["level"])
+	require.Equal(t, "saved", record["msg"])
+	require.Equal(t, "test", record["component"])
+	require.Equal(t, float64(7), record["id"])
+	require.Equal(t, "req-1", record["request_id"])
+}
+
+func TestNew_AddsTrace(t *testing.T) {
+	// Given
+	var out bytes.Buffer
+	logger, err := New(&out, "info")
+	require.NoError(t, err)
+	ctx, span := tracing.New(&tracing.Memory{}).Start(context.Background(), "Service.CreateMovement")
+
+	// When
+	logger.InfoContext(ctx, "movement created")
+
+	// Then
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &record))
+	require.Equal(t, span.Context().TraceID.String(), record["trace_id"])
+	require.Equal(t, span.Context().SpanID.String(), record["span_id"])
+}
+
+func TestNew_InvalidLevel(t *testing.T) {
+	// When
+	_, err := New(&bytes.Buffer{}, "verbose")
+
+	// Then
+	require.Error(t, err)
+}
@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"database/sql"
+)
+
+// RegisterDBStats registers the statistics of the connection pool of the database
+func RegisterDBStats(r *Registry, db *sql.DB) {
+	r.GaugeFunc("wallet_db_max_open_connections", "Maximum number of open connections to the database.",
+		func() float64 { return float64(db.Stats().MaxOpenConnections) })
+	r.GaugeFunc("wallet_db_open_connections", "Number of established connections, in use and idle.",
+		func() float64 { return float64(db.Stats().OpenConnections) })
+	r.GaugeFunc("wallet_db_in_use_connections", "Number of connections in use.",
+		func() float64 { return float64(db.Stats().InUse) })
+	r.GaugeFunc("wallet_db_idle_connections", "Number of idle connections.",
+		func() float64 { return float64(db.Stats().Idle) })
+	r.CounterFunc("wallet_db_wait_count_total", "Number of connections waited for.",
+		func() float64 { return float64(db.Stats().WaitCount) })
+	r.CounterFunc("wallet_db_wait_duration_seconds_total", "Time blocked waiting for a new connection.",
+		func() float64 { return db.Stats().WaitDuration.Seconds() })
+	r.CounterFunc("wallet_db_max_idle_closed_total", "Number of connections closed due to the idle limit.",
+		func() float64 { return float64(db.Stats().MaxIdleClosed) })
+	r.CounterFunc("wallet_db_max_lifetime_closed_total", "Number of connections closed due to the maximum lifetime.",
+		func() float64 { return float64(db.Stats().MaxLifetimeClosed) })
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTo_Counter(t *testing.T) {
+	// Given
+	registry := New()
+	requests := registry.Counter("http_requests_total", "Number of requests.", "route", "status")
+	requests.Inc("/users", "201")
+	requests.Inc("/movements", "400")
+	requests.Add(2, "/movements", "400")
+	requests.Inc(`/a"b`, "500")
+
+	// When
+	var out bytes.Buffer
+	_, err := registry.WriteTo(&out)
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, `# HELP http_requests_total Number of requests.
+# TYPE http_requests_total counter
+http_requests_total{route="/a\"b",status="500"} 1
+http_requests_total{route="/movements",status="400"} 3
+http_requests_total{route="/users",status="201"} 1
+`, out.String())
+}
+
+func TestWriteTo_Histogram(t *testing.T) {
+	// Given
+	registry := New()
+	latency := registry.Histogram("query_seconds", "Query latency.", []float64{0.1, 1}, "method")
+	latency.Observe(0.05, "Get")
+	latency.Observe(0.5, "Get")
+	latency.Observe(3, "Get")
+
+	// When
+	var out bytes.Buffer
+	_, err := registry.WriteTo(&out)
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, `# HELP query_seconds Query latency.
+# TYPE query_seconds histogram
+query_seconds_bucket{method="Get",le="0.1"} 1
+query_seconds_bucket{method="Get",le="1"} 2
+query_seconds_bucket{method="Get",le="+Inf"} 3
+query_seconds_sum{method="Get"} 3.55
+query_seconds_count{method="Get"} 3
+`, out.String())
+}
+
+func TestNilMetrics(t *testing.T) {
+	// Given
+	var counter *Counter
+	var histogram *Histogram
+
+	// Then
+	require.NotPanics(t, func() {
+		counter.Inc("a")
+		histogram.Observe(1, "a")
+	})
+}
+
+func TestRegister_Duplicate(t *testing.T) {
+	// Given
+	registry := New()
+	registry.Counter("requests_total", "Number of requests.")
+
+	// Then
+	require.Panics(t, func() { registry.Counter("requests_total", "Number of requests.") })
+}
+
+func TestHandler_DBStats(t *testing.T) {
+	// Given
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(20)
+	registry := New()
+	RegisterDBStats(registry, db)
+
+	// When
+	rr := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	// Then
+	require.Equal(t, ContentType, rr.Header().Get("Content-Type"))
+	require.Contains(t, rr.Body.String(), "# TYPE wallet_db_max_open_connections gauge\nwallet_db_max_open_connections 20\n")
+	require.Contains(t, rr.Body.String(), "# TYPE wallet_db_wait_count_total counter\nwallet_db_wait_count_total 0\n")
+}
@@ -0,0 +1,97 @@
+package migration
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrorInvalidName      = errors.New("migration: file name must be <version>_<name>.sql")
+	ErrorDuplicateVersion = errors.New("migration: duplicate version")
+)
+
+// Migration is a numbered sql file that changes the schema
+type Migration struct {
+	Version    int64
+	Name       string
+	Statements []string
+}
+
+// Parse reads the .sql files of the directory ordered by version
+func Parse(fsys fs.FS, dir string) ([]Migration, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	var versions = make(map[int64]bool)
+	for _, v := range files {
+		migration, err := parseName(path.Base(v))
+		if err != nil {
+			return nil, err
+		}
+
+		if versions[migration.Version] {
+			return nil, ErrorDuplicateVersion
+		}
+		versions[migration.Version] = true
+
+		content, err := fs.ReadFile(fsys, v)
+		if err != nil {
+			return nil, err
+		}
+		migration.Statements = splitStatements(string(content))
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// parseName reads the version and name of a file such as 0002_unified_movements.sql
+func parseName(fileName string) (Migration, error) {
+	parts := strings.SplitN(strings.TrimSuffix(fileName, ".sql"), "_", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return Migration{}, ErrorInvalidName
+	}
+
+	version, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || version <= 0 {
+		return Migration{}, ErrorInvalidName
+	}
+
+	return Migration{Version: version, Name: parts[1]}, nil
+}
+
+// splitStatements splits the content of a file in the statements ended by a semicolon at the end of a line,
+// skipping blank lines and -- comments
+func splitStatements(content string) []string {
+	var statements []string
+	var current []string
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current = append(current, strings.TrimRight(line, " \t\r"))
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+
+	if len(current) > 0 {
+		statements = append(statements, strings.Join(current, "\n"))
+	}
+
+	return statements
+}
@@ -0,0 +1,71 @@
+package migration
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/spolia/lemon-wallet/migrations"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_ok(t *testing.T) {
+	// Given
+	fsys := fstest.MapFS{
+		"mysql/0002_add_index.sql": {Data: []byte("-- index\nCREATE INDEX a_idx ON a (b);\n")},
+		"mysql/0001_initial.sql": {Data: []byte("CREATE TABLE a (\n  b INT\n);\n\n" +
+			"INSERT INTO a (b)\nVALUES (1);\n")},
+		"mysql/README.md": {Data: []byte("not a migration")},
+	}
+
+	// When
+	result, err := Parse(fsys, "mysql")
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, []Migration{
+		{Version: 1, Name: "initial", Statements: []string{"CREATE TABLE a (\n  b INT\n);", "INSERT INTO a (b)\nVALUES (1);"}},
+		{Version: 2, Name: "add_index", Statements: []string{"CREATE INDEX a_idx ON a (b);"}},
+	}, result)
+}
+
+func TestParse_ErrorInvalidName(t *testing.T) {
+	for _, name := range []string{"initial.sql", "0001.sql", "first_initial.sql", "0000_initial.sql"} {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			fsys := fstest.MapFS{"mysql/" + name: {Data: []byte("SELECT 1;")}}
+
+			// When
+			_, err := Parse(fsys, "mysql")
+
+			// Then
+			require.EqualError(t, err, ErrorInvalidName.Error())
+		})
+	}
+}
+
+func TestParse_ErrorDuplicateVersion(t *testing.T) {
+	// Given
+	fsys := fstest.MapFS{
+		"mysql/0001_initial.sql": {Data: []byte("SELECT 1;")},
+		"mysql/1_other.sql":      {Data: []byte("SELECT 2;")},
+	}
+
+	// When
+	_, err := Parse(fsys, "mysql")
+
+	// Then
+	require.EqualError(t, err, ErrorDuplicateVersion.Error())
+}
+
+func TestParse_EmbeddedMigrations(t *testing.T) {
+	// When
+	result, err := Parse(migrations.MySQL, "mysql")
+
+	// Then
+	require.NoError(t, err)
+	require.NotEmpty(t, result)
+	for i, v := range result {
+		require.Equal(t, int64(i+1), v.Version)
+		require.NotEmpty(t, v.Statements)
+	}
+}
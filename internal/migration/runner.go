@@ -0,0 +1,130 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// lockName is the mysql named lock that keeps two runners from applying the same migrations
+const lockName = "schema_migrations"
+
+var ErrorLocked = errors.New("migration: another runner holds the migrations lock")
+
+type runner struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, migrations []Migration) *runner {
+	return &runner{db: db, migrations: migrations}
+}
+
+// Up applies the pending migrations in order and returns the ones applied. Each migration is recorded in the
+// schema_migrations table once all its statements ran
+func (r runner) Up(ctx context.Context) ([]Migration, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 10);", lockName).Scan(&locked); err != nil {
+		return nil, err
+	}
+	if locked.Int64 != 1 {
+		return nil, ErrorLocked
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?);", lockName)
+
+	if _, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations ("+
+		"version BIGINT NOT NULL, name VARCHAR(255) NOT NULL, date_applied DATETIME NOT NULL DEFAULT current_timestamp, "+
+		"PRIMARY KEY (version));"); err != nil {
+		return nil, err
+	}
+
+	pending, err := r.pending(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, v := range pending {
+		for _, statement := range v.Statements {
+			if _, err = conn.ExecContext(ctx, statement); err != nil {
+				return applied, &Error{Migration: v, Err: err}
+			}
+		}
+
+		if _, err = conn.ExecContext(ctx, "INSERT INTO schema_migrations(version,name)VALUES (?,?);", v.Version, v.Name); err != nil {
+			return applied, &Error{Migration: v, Err: err}
+		}
+		applied = append(applied, v)
+	}
+
+	return applied, nil
+}
+
+// Pending returns the migrations that were not applied yet
+func (r runner) Pending(ctx context.Context) ([]Migration, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return r.pending(ctx, conn)
+}
+
+func (r runner) pending(ctx context.Context, conn *sql.Conn) ([]Migration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations;")
+	if err != nil {
+		// the table is created by the first run
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1146 {
+			return r.migrations, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied = make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, v := range r.migrations {
+		if !applied[v.Version] {
+			pending = append(pending, v)
+		}
+	}
+
+	return pending, nil
+}
+
+// Error is returned when a statement of a migration fails. The statements of the migration that ran before
+// the failure are not rolled back, since mysql commits every schema change
+type Error struct {
+	Migration Migration
+	Err       error
+}
+
+func (e *Error) Error() string {
+	return "migration: " + e.Migration.Name + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,90 @@
+//go:build integration
+// +build integration
+
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/spolia/lemon-wallet/migrations"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests need a MySQL server whose user can create databases, e.g.
+// WALLET_TEST_DSN="root:rootroot@tcp(127.0.0.1:3306)/wallet?parseTime=true" go test -tags integration ./...
+
+func TestUp_UpgradesBaselineScheme(t *testing.T) {
+	// Given
+	db := openScratchDB(t)
+	ctx := context.Background()
+	baseline, err := os.ReadFile("testdata/baseline.sql")
+	require.NoError(t, err)
+	for _, statement := range splitStatements(string(baseline)) {
+		_, err = db.ExecContext(ctx, statement)
+		require.NoError(t, err)
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO users(id,first_name,last_name,alias,email)VALUES (1,'maria','garcia','maria','maria@test.com');")
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, "INSERT INTO movements_ars(mov_type,tx_amount,total_amount,user_id)VALUES "+
+		"('deposit',100,100,1),('extract',30,70,1);")
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, "INSERT INTO movements_btc(mov_type,tx_amount,total_amount,user_id)VALUES ('init',0,0,1);")
+	require.NoError(t, err)
+
+	all, err := Parse(migrations.MySQL, "mysql")
+	require.NoError(t, err)
+
+	// When
+	applied, err := New(db, all).Up(ctx)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, applied, len(all))
+
+	var movements, exchanges int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT COUNT(*), COUNT(exchange_id) FROM movements WHERE user_id = 1;").
+		Scan(&movements, &exchanges))
+	require.Equal(t, 3, movements)
+	require.Equal(t, 0, exchanges)
+
+	var balance string
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT amount FROM balances WHERE user_id = 1 AND currency_name = 'ARS';").
+		Scan(&balance))
+	require.Equal(t, "70.00000000", balance)
+
+	pending, err := New(db, all).Pending(ctx)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+// openScratchDB creates an empty database, dropped when the test ends
+func openScratchDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("WALLET_TEST_DSN")
+	if dsn == "" {
+		t.Skip("WALLET_TEST_DSN is not set")
+	}
+
+	config, err := mysql.ParseDSN(dsn)
+	require.NoError(t, err)
+	admin, err := sql.Open("mysql", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+
+	config.DBName = fmt.Sprintf("wallet_migration_%d", time.Now().UnixNano())
+	_, err = admin.Exec("CREATE DATABASE " + config.DBName + ";")
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Exec("DROP DATABASE " + config.DBName + ";") })
+
+	db, err := sql.Open("mysql", config.FormatDSN())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
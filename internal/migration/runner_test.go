@@ -0,0 +1,111 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+const createTable = "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL, name VARCHAR(255) NOT NULL, " +
+	"date_applied DATETIME NOT NULL DEFAULT current_timestamp, PRIMARY KEY (version));"
+
+var testMigrations = []Migration{
+	{Version: 1, Name: "initial", Statements: []string{"CREATE TABLE a (b INT);"}},
+	{Version: 2, Name: "add_column", Statements: []string{"ALTER TABLE a ADD c INT;", "UPDATE a SET c = b;"}},
+}
+
+func TestUp_AppliesPending(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	runner := New(db, testMigrations)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT GET_LOCK(?, 10);").WithArgs(lockName).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec(createTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version FROM schema_migrations;").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectExec("ALTER TABLE a ADD c INT;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE a SET c = b;").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("INSERT INTO schema_migrations(version,name)VALUES (?,?);").WithArgs(int64(2), "add_column").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("SELECT RELEASE_LOCK(?);").WithArgs(lockName).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// then
+	applied, err := runner.Up(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, testMigrations[1:], applied)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUp_StatementFails(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	runner := New(db, testMigrations)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT GET_LOCK(?, 10);").WithArgs(lockName).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec(createTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version FROM schema_migrations;").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectExec("CREATE TABLE a (b INT);").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations(version,name)VALUES (?,?);").WithArgs(int64(1), "initial").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE a ADD c INT;").WillReturnError(errors.New("database error"))
+	mock.ExpectExec("SELECT RELEASE_LOCK(?);").WithArgs(lockName).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// then
+	applied, err := runner.Up(context.Background())
+	require.EqualError(t, err, "migration: add_column: database error")
+	var migrationErr *Error
+	require.True(t, errors.As(err, &migrationErr))
+	require.Equal(t, int64(2), migrationErr.Migration.Version)
+	require.Equal(t, testMigrations[:1], applied)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUp_ErrorLocked(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	runner := New(db, testMigrations)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT GET_LOCK(?, 10);").WithArgs(lockName).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+
+	// then
+	applied, err := runner.Up(context.Background())
+	require.EqualError(t, err, ErrorLocked.Error())
+	require.Empty(t, applied)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPending_NoMigrationsTable(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	runner := New(db, testMigrations)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT version FROM schema_migrations;").WillReturnError(&mysql.MySQLError{Number: 1146})
+
+	// then
+	pending, err := runner.Pending(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, testMigrations, pending)
+}
@@ -0,0 +1,58 @@
+-- The tables of migrations/mysql/wallet_scheme.sql, the scheme the databases were created with before the migrations.
+CREATE TABLE `users` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `first_name` VARCHAR(45) NOT NULL,
+  `last_name` VARCHAR(45) NOT NULL,
+  `alias` VARCHAR(45) NOT NULL,
+  `email` VARCHAR(45) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `alias_UNIQUE` (`alias` ASC),
+  UNIQUE INDEX `email_UNIQUE` (`email` ASC));
+
+CREATE TABLE `movements_btc` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `mov_type` ENUM("deposit", "extract","init") NOT NULL,
+  `currency_name` VARCHAR(20) NOT NULL DEFAULT 'BTC',
+  `date_created` DATETIME NOT NULL DEFAULT current_timestamp,
+  `tx_amount` DECIMAL(18,8) ZEROFILL NOT NULL,
+  `total_amount` DECIMAL(18,8) ZEROFILL NOT NULL,
+  `user_id` BIGINT NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_btc_user_id`
+      FOREIGN KEY (`user_id`)
+          REFERENCES `users` (`id`)
+          ON DELETE CASCADE
+          ON UPDATE CASCADE);
+
+CREATE TABLE `movements_usdt` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `mov_type` ENUM("deposit", "extract","init") NOT NULL,
+  `currency_name` VARCHAR(20) NOT NULL DEFAULT 'USDT',
+  `date_created` DATETIME NOT NULL DEFAULT current_timestamp,
+  `tx_amount` DECIMAL(18,2) ZEROFILL NOT NULL,
+  `total_amount` DECIMAL(18,2) ZEROFILL NOT NULL,
+  `user_id` BIGINT NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_usdt_user_id`
+      FOREIGN KEY (`user_id`)
+          REFERENCES `users` (`id`)
+          ON DELETE CASCADE
+          ON UPDATE CASCADE);
+
+CREATE TABLE `movements_ars` (
+   `id` BIGINT NOT NULL AUTO_INCREMENT,
+   `mov_type` ENUM("deposit", "extract") NOT NULL,
+   `currency_name` VARCHAR(20) NOT NULL DEFAULT 'ARS',
+   `date_created` DATETIME NOT NULL DEFAULT current_timestamp,
+   `tx_amount` DECIMAL(18,2) ZEROFILL NOT NULL,
+   `total_amount` DECIMAL(18,2) ZEROFILL NOT NULL,
+   `user_id` BIGINT NOT NULL,
+   PRIMARY KEY (`id`),
+   INDEX `user_id_idx` (`user_id` ASC),
+   CONSTRAINT `fk_ars_user_id`
+       FOREIGN KEY (`user_id`)
+           REFERENCES `users` (`id`)
+           ON DELETE CASCADE
+           ON UPDATE CASCADE);
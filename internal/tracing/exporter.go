@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// WriterExporter writes the spans as JSON lines, e.g. to the standard output of a local run
+type WriterExporter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{encoder: json.NewEncoder(w)}
+}
+
+// Export writes the span, dropping it when the writer fails
+func (e *WriterExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_ = e.encoder.Encode(span)
+}
+
+// Memory keeps the exported spans, for tests and local inspection
+type Memory struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// Export keeps the span
+func (m *Memory) Export(span SpanData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = append(m.spans, span)
+}
+
+// Spans returns the spans exported so far, in the order they ended
+func (m *Memory) Spans() []SpanData {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]SpanData(nil), m.spans...)
+}
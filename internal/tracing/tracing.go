@@ -0,0 +1,255 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header is the W3C Trace Context header carrying the parent of a request
+const Header = "traceparent"
+
+// TraceID identifies a trace, the spans of a request across services
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid reports whether the trace ID is not all zeros
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID identifies a span within its trace
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid reports whether the span ID is not all zeros
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext is the part of a span that is propagated to its children, in this process or in others
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// ParseTraceparent reads the value of a traceparent header: version, trace ID, parent span ID and flags, in
+// lowercase hex. It returns false when the value is not valid, which starts a new trace
+func ParseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	var flags [1]byte
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) || !decodeHex(flags[:], parts[3]) {
+		return SpanContext{}, false
+	}
+
+	if !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return SpanContext{}, false
+	}
+
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+func decodeHex(dst []byte, value string) bool {
+	if len(value) != hex.EncodedLen(len(dst)) || strings.ToLower(value) != value {
+		return false
+	}
+
+	_, err := hex.Decode(dst, []byte(value))
+	return err == nil
+}
+
+// Traceparent returns the traceparent header of the children of the span context
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// SpanData is a finished span as it is exported
+type SpanData struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_span_id,omitempty"`
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	Duration   time.Duration     `json:"duration_ns"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Exporter receives the spans of the sampled traces as they end, e.g. to print them or send them to a collector.
+// It is called by the goroutine that ends the span, so it must not block for long
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Tracer starts the spans and exports them to its exporter. A nil tracer starts no spans, so the instrumented code
+// does not check whether tracing is enabled
+type Tracer struct {
+	exporter Exporter
+	now      func() time.Time
+}
+
+func New(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter, now: time.Now}
+}
+
+// Span is an operation of a trace. A nil span does nothing
+type Span struct {
+	tracer   *Tracer
+	context  SpanContext
+	parentID SpanID
+	name     string
+	start    time.Time
+
+	mu         sync.Mutex
+	attributes map[string]string
+	err        string
+	ended      bool
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// Start starts a span, child of the span of the context or of the remote parent bound to it, or the root of a new
+// trace. The returned context carries the span
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{tracer: t, name: name, start: t.now()}
+	if parent, ok := parentContext(ctx); ok {
+		span.context.TraceID, span.context.Sampled, span.parentID = parent.TraceID, parent.Sampled, parent.SpanID
+	} else {
+		span.context.TraceID, span.context.Sampled = newTraceID(), true
+	}
+	span.context.SpanID = newSpanID()
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func parentContext(ctx context.Context) (SpanContext, bool) {
+	if span := FromContext(ctx); span != nil {
+		return span.context, true
+	}
+
+	remote, ok := ctx.Value(remoteKey{}).(SpanContext)
+	return remote, ok
+}
+
+// WithRemoteParent returns a copy of the context whose next span is a child of the span of another process, e.g.
+// the one of a traceparent header
+func WithRemoteParent(ctx context.Context, parent SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, parent)
+}
+
+// FromContext returns the span of the context, nil when there is none
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Context returns the span context propagated to the children of the span
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.context
+}
+
+// SetAttribute sets an attribute of the span, e.g. the id of the user it acts on
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]string)
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed with the error, when it is not nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End ends the span and exports it if its trace is sampled. Only the first call has effect
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		TraceID:    s.context.TraceID.String(),
+		SpanID:     s.context.SpanID.String(),
+		Name:       s.name,
+		Start:      s.start,
+		Duration:   s.tracer.now().Sub(s.start),
+		Attributes: s.attributes,
+		Error:      s.err,
+	}
+	s.mu.Unlock()
+
+	if s.parentID.IsValid() {
+		data.ParentID = s.parentID.String()
+	}
+
+	if s.context.Sampled {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	random(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	random(id[:])
+	return id
+}
+
+func random(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
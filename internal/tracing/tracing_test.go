@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tt := []struct {
+		TestName, Value string
+		Valid, Sampled  bool
+	}{
+		{"Sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"NotSampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"FutureVersion", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"Empty", "", false, false},
+		{"InvalidVersion", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"ExtraFields", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"Uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"ZeroTraceID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"ZeroSpanID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"ShortSpanID", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01", false, false},
+	}
+
+	for _, tc := range tt {
+		// When
+		sc, ok := ParseTraceparent(tc.Value)
+
+		// Then
+		require.Equal(t, tc.Valid, ok, tc.TestName)
+		require.Equal(t, tc.Sampled, sc.Sampled, tc.TestName)
+		if tc.Valid {
+			require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String(), tc.TestName)
+			require.Equal(t, "00f067aa0ba902b7", sc.SpanID.String(), tc.TestName)
+		}
+	}
+}
+
+func TestTraceparent_RoundTrip(t *testing.T) {
+	// Given
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	// When
+	sc, ok := ParseTraceparent(value)
+
+	// Then
+	require.True(t, ok)
+	require.Equal(t, value, sc.Traceparent())
+}
+
+func TestStart_ChildOfRemoteParent(t *testing.T) {
+	// Given
+	var exporter Memory
+	tracer := New(&exporter)
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := WithRemoteParent(context.Background(), parent)
+
+	// When
+	ctx, root := tracer.Start(ctx, "GET /users/:id")
+	_, child := tracer.Start(ctx, "Service.GetUser")
+	child.SetAttribute("user_id", "1")
+	child.SetError(errors.New("user: not found"))
+	child.End()
+	root.End()
+	root.End()
+
+	// Then
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "Service.GetUser", spans[0].Name)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+	require.Equal(t, root.Context().SpanID.String(), spans[0].ParentID)
+	require.Equal(t, map[string]string{"user_id": "1"}, spans[0].Attributes)
+	require.Equal(t, "user: not found", spans[0].Error)
+	require.Equal(t, "00f067aa0ba902b7", spans[1].ParentID)
+	require.Empty(t, spans[1].Error)
+}
+
+func TestStart_NotSampled(t *testing.T) {
+	// Given
+	var exporter Memory
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+
+	// When
+	_, span := New(&exporter).Start(WithRemoteParent(context.Background(), parent), "GET /currencies")
+	span.End()
+
+	// Then
+	require.Empty(t, exporter.Spans())
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.Context().SpanID.String()+"-00", span.Context().Traceparent())
+}
+
+func TestNilTracer(t *testing.T) {
+	// Given
+	var tracer *Tracer
+
+	// When
+	ctx, span := tracer.Start(context.Background(), "noop")
+
+	// Then
+	require.Nil(t, span)
+	require.Nil(t, FromContext(ctx))
+	require.NotPanics(t, func() {
+		span.SetAttribute("key", "value")
+		span.SetError(errors.New("fail"))
+		span.End()
+	})
+}
+
+func TestWriterExporter(t *testing.T) {
+	// Given
+	var out bytes.Buffer
+	tracer := New(NewWriterExporter(&out))
+
+	// When
+	_, span := tracer.Start(context.Background(), "Service.CreateMovement")
+	span.End()
+
+	// Then
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &data))
+	require.Equal(t, "Service.CreateMovement", data["name"])
+	require.Equal(t, span.Context().TraceID.String(), data["trace_id"])
+	require.NotContains(t, data, "parent_span_id")
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	ActionUserCreated       = "user.created"
+	ActionMovementCreated   = "movement.created"
+	ActionTransferCreated   = "transfer.created"
+	ActionExchangeCreated   = "exchange.created"
+	ActionWalletFrozen      = "wallet.frozen"
+	ActionWalletUnfrozen    = "wallet.unfrozen"
+	ActionAdjustmentCreated = "adjustment.created"
+	ActionWebhookCreated    = "webhook.created"
+	ActionAPIKeyCreated     = "apikey.created"
+)
+
+const (
+	TargetUser     = "user"
+	TargetMovement = "movement"
+	TargetExchange = "exchange"
+	TargetWebhook  = "webhook"
+	TargetAPIKey   = "apikey"
+)
+
+type Repository interface {
+	Save(ctx context.Context, event Event) (int64, error)
+	Search(ctx context.Context, filter Filter) ([]Event, error)
+}
+
+// Event records who did what on which target. Before and After are JSON snapshots of the target, Before is empty
+// when the action creates it. ActorID is zero when the action was not made by an authenticated caller, e.g. a
+// user registering
+type Event struct {
+	ID          int64           `json:"id"`
+	ActorID     int64           `json:"actorid"`
+	Action      string          `json:"action"`
+	TargetType  string          `json:"targettype"`
+	TargetID    int64           `json:"targetid"`
+	RequestID   string          `json:"requestid"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	DateCreated time.Time       `json:"datecreated"`
+}
+
+// Filter selects the events of a search, newest first. From is inclusive and To exclusive, the zero values are
+// not applied
+type Filter struct {
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   int64
+	From       time.Time
+	To         time.Time
+	Limit      uint64
+	Offset     uint64
+}
+
+// Snapshot encodes the state of a target for an event, nil encodes no state
+func Snapshot(target interface{}) (json.RawMessage, error) {
+	if target == nil {
+		return nil, nil
+	}
+	return json.Marshal(target)
+}
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *repository {
+	return &repository{db: db}
+}
+
+// Save appends an event. It joins the transaction of the context, so the event is only kept when the change
+// it records is committed
+func (r repository) Save(ctx context.Context, event Event) (int64, error) {
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, "INSERT INTO audit_events(actor_id,action,target_type,target_id,"+
+		"request_id,before_snapshot,after_snapshot)VALUES (?,?,?,?,?,?,?);",
+		sql.NullInt64{Int64: event.ActorID, Valid: event.ActorID != 0}, event.Action, event.TargetType, event.TargetID,
+		sql.NullString{String: event.RequestID, Valid: event.RequestID != ""}, nullJSON(event.Before), nullJSON(event.After))
+	if err != nil {
+		return 0, dberror.Classify(err)
+	}
+
+	return result.LastInsertId()
+}
+
+// Search returns a page of the events matching the filter, newest first
+func (r repository) Search(ctx context.Context, filter Filter) ([]Event, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.ActorID != 0 {
+		conditions, args = append(conditions, "actor_id = ?"), append(args, filter.ActorID)
+	}
+
+	if filter.Action != "" {
+		conditions, args = append(conditions, "action = ?"), append(args, filter.Action)
+	}
+
+	if filter.TargetType != "" {
+		conditions, args = append(conditions, "target_type = ?"), append(args, filter.TargetType)
+	}
+
+	if filter.TargetID != 0 {
+		conditions, args = append(conditions, "target_id = ?"), append(args, filter.TargetID)
+	}
+
+	if !filter.From.IsZero() {
+		conditions, args = append(conditions, "date_created >= ?"), append(args, filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		conditions, args = append(conditions, "date_created < ?"), append(args, filter.To)
+	}
+
+	query := "SELECT id, actor_id, action, target_type, target_id, request_id, before_snapshot, after_snapshot, date_created " +
+		"FROM audit_events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := r.db.QueryContext(ctx, query+" ORDER BY id DESC LIMIT ? OFFSET ?;", append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events = make([]Event, 0)
+	for rows.Next() {
+		var event Event
+		var actorID sql.NullInt64
+		var requestID sql.NullString
+		var before, after []byte
+		err = rows.Scan(&event.ID, &actorID, &event.Action, &event.TargetType, &event.TargetID, &requestID, &before, &after,
+			&event.DateCreated)
+		if err != nil {
+			return nil, err
+		}
+		event.ActorID, event.RequestID, event.Before, event.After = actorID.Int64, requestID.String, before, after
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// nullJSON stores an empty snapshot as NULL
+func nullJSON(snapshot []byte) interface{} {
+	if len(snapshot) == 0 {
+		return nil
+	}
+	return string(snapshot)
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
+	"github.com/stretchr/testify/require"
+)
+
+var eventColumns = []string{"id", "actor_id", "action", "target_type", "target_id", "request_id", "before_snapshot",
+	"after_snapshot", "date_created"}
+
+func TestSave_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	event := Event{ActorID: 3, Action: ActionWalletFrozen, TargetType: TargetUser, TargetID: 1, RequestID: "req",
+		Before: json.RawMessage(`{"frozen":false}`), After: json.RawMessage(`{"frozen":true}`)}
+	// When
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO audit_events(actor_id,action,target_type,target_id,request_id,before_snapshot,after_snapshot)"+
+		"VALUES (?,?,?,?,?,?,?);").
+		WithArgs(int64(3), ActionWalletFrozen, TargetUser, int64(1), "req", `{"frozen":false}`, `{"frozen":true}`).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectCommit()
+
+	// then
+	err = txn.New(db).Run(context.Background(), func(ctx context.Context) error {
+		id, err := repository.Save(ctx, event)
+		require.Equal(t, int64(5), id)
+		return err
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSave_WithoutActor(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectExec("INSERT INTO audit_events(actor_id,action,target_type,target_id,request_id,before_snapshot,after_snapshot)"+
+		"VALUES (?,?,?,?,?,?,?);").
+		WithArgs(sql.NullInt64{}, ActionUserCreated, TargetUser, int64(1), sql.NullString{}, nil, `{"id":1}`).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+
+	// then
+	_, err = repository.Save(context.Background(), Event{Action: ActionUserCreated, TargetType: TargetUser, TargetID: 1,
+		After: json.RawMessage(`{"id":1}`)})
+	require.NoError(t, err)
+}
+
+func TestSearch_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	from := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	// When
+	mock.ExpectQuery("SELECT id, actor_id, action, target_type, target_id, request_id, before_snapshot, after_snapshot, date_created "+
+		"FROM audit_events WHERE actor_id = ? AND target_type = ? AND target_id = ? AND date_created >= ? ORDER BY id DESC LIMIT ? OFFSET ?;").
+		WithArgs(int64(3), TargetUser, int64(1), from, uint64(10), uint64(0)).
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(7, 3, ActionWalletFrozen, TargetUser, 1, "req", `{"frozen":false}`, `{"frozen":true}`, from).
+			AddRow(6, nil, ActionUserCreated, TargetUser, 1, nil, nil, `{"id":1}`, from))
+
+	// then
+	events, err := repository.Search(context.Background(), Filter{ActorID: 3, TargetType: TargetUser, TargetID: 1, From: from, Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, []Event{
+		{ID: 7, ActorID: 3, Action: ActionWalletFrozen, TargetType: TargetUser, TargetID: 1, RequestID: "req",
+			Before: json.RawMessage(`{"frozen":false}`), After: json.RawMessage(`{"frozen":true}`), DateCreated: from},
+		{ID: 6, Action: ActionUserCreated, TargetType: TargetUser, TargetID: 1, After: json.RawMessage(`{"id":1}`), DateCreated: from},
+	}, events)
+}
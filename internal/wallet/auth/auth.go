@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// ScopeAdmin lets the caller act on any wallet
+const ScopeAdmin = "admin"
+
+// apiKeyPrefix tells API keys apart from tokens in the Authorization header
+const apiKeyPrefix = "lw_"
+
+var (
+	ErrorUnauthenticated = errors.New("auth: missing credentials")
+	ErrorInvalidToken    = errors.New("auth: invalid token")
+	ErrorExpiredToken    = errors.New("auth: expired token")
+	ErrorForbidden       = errors.New("auth: the caller can not act on this wallet")
+	ErrorKeyNotFound     = errors.New("auth: api key not found")
+)
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	UserID int64
+	Scopes []string
+}
+
+// HasScope tells whether the caller was granted the scope
+func (i Identity) HasScope(scope string) bool {
+	for _, v := range i.Scopes {
+		if v == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanAccess tells whether the caller can act on the wallet of the user, which is its own wallet unless it is
+// an admin
+func (i Identity) CanAccess(userID int64) bool {
+	return i.UserID == userID || i.HasScope(ScopeAdmin)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of the context that carries the identity
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// FromContext returns the identity carried by the context
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(Identity)
+	return identity, ok
+}
+
+// APIKey is a long-lived credential of a user. Only the hash of the key is stored, and it is never serialized
+type APIKey struct {
+	ID     int64    `json:"id"`
+	UserID int64    `json:"userid"`
+	Hash   string   `json:"-"`
+	Scopes []string `json:"scopes"`
+}
+
+type Repository interface {
+	Save(ctx context.Context, key APIKey) (int64, error)
+	GetByHash(ctx context.Context, hash string) (APIKey, error)
+}
+
+// GenerateKey returns a new random API key
+func GenerateKey() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return apiKeyPrefix + hex.EncodeToString(data), nil
+}
+
+// HashKey returns the hash an API key is stored and looked up with
+func HashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func isAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, apiKeyPrefix)
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+type authenticator struct {
+	secret []byte
+	keys   Repository
+	now    func() time.Time
+}
+
+// NewAuthenticator returns an authenticator of the tokens signed with the secret and of the API keys
+// stored in the repository
+func NewAuthenticator(secret []byte, keys Repository) *authenticator {
+	return &authenticator{secret: secret, keys: keys, now: time.Now}
+}
+
+// Authenticate returns the identity of a bearer credential, which is either an API key or a token
+func (a authenticator) Authenticate(ctx context.Context, credential string) (Identity, error) {
+	if credential == "" {
+		return Identity{}, ErrorUnauthenticated
+	}
+
+	if !isAPIKey(credential) {
+		return ParseToken(a.secret, credential, a.now())
+	}
+
+	key, err := a.keys.GetByHash(ctx, HashKey(credential))
+	if err != nil {
+		if err == ErrorKeyNotFound {
+			return Identity{}, ErrorInvalidToken
+		}
+		return Identity{}, err
+	}
+
+	return Identity{UserID: key.UserID, Scopes: key.Scopes}, nil
+}
+
+// IssueStreamTicket returns a ticket that opens the stream of the wallet of the user for StreamTicketTTL
+func (a authenticator) IssueStreamTicket(ctx context.Context, userID int64) (string, error) {
+	return SignStreamTicket(a.secret, userID, a.now())
+}
+
+// AuthenticateStreamTicket returns the identity of a stream ticket, which can only open the stream of its wallet
+func (a authenticator) AuthenticateStreamTicket(ctx context.Context, ticket string) (Identity, error) {
+	if ticket == "" {
+		return Identity{}, ErrorUnauthenticated
+	}
+
+	return ParseStreamTicket(a.secret, ticket, a.now())
+}
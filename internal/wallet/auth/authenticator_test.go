@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate_Token(t *testing.T) {
+	// Given
+	var keys keyRepositoryMock
+	authenticator := NewAuthenticator(secret, &keys)
+	token, err := SignToken(secret, Identity{UserID: 7}, time.Now(), time.Hour)
+	require.NoError(t, err)
+
+	// When
+	identity, err := authenticator.Authenticate(context.Background(), token)
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, int64(7), identity.UserID)
+	keys.AssertNotCalled(t, "GetByHash", mock.Anything)
+}
+
+func TestAuthenticate_APIKey(t *testing.T) {
+	// Given
+	var keys keyRepositoryMock
+	keys.On("GetByHash", HashKey("lw_key")).Return(APIKey{ID: 5, UserID: 7, Scopes: []string{ScopeAdmin}}, nil).Once()
+	authenticator := NewAuthenticator(secret, &keys)
+
+	// When
+	identity, err := authenticator.Authenticate(context.Background(), "lw_key")
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, Identity{UserID: 7, Scopes: []string{ScopeAdmin}}, identity)
+}
+
+func TestAuthenticate_Errors(t *testing.T) {
+	tt := []struct {
+		TestName, Credential string
+		KeyError, Expected   error
+	}{
+		{"MissingCredential", "", nil, ErrorUnauthenticated},
+		{"UnknownKey", "lw_unknown", ErrorKeyNotFound, ErrorInvalidToken},
+		{"RepositoryError", "lw_key", errors.New("fail"), errors.New("fail")},
+		{"InvalidToken", "token", nil, ErrorInvalidToken},
+	}
+
+	for _, tc := range tt {
+		// Given
+		var keys keyRepositoryMock
+		keys.On("GetByHash", mock.Anything).Return(APIKey{}, tc.KeyError)
+		authenticator := NewAuthenticator(secret, &keys)
+
+		// When
+		_, err := authenticator.Authenticate(context.Background(), tc.Credential)
+
+		// Then
+		require.EqualError(t, err, tc.Expected.Error(), tc.TestName)
+	}
+}
+
+func TestAuthenticateStreamTicket(t *testing.T) {
+	// Given
+	var keys keyRepositoryMock
+	authenticator := NewAuthenticator(secret, &keys)
+	ticket, err := authenticator.IssueStreamTicket(context.Background(), 7)
+	require.NoError(t, err)
+
+	// When
+	identity, err := authenticator.AuthenticateStreamTicket(context.Background(), ticket)
+	_, bearerErr := authenticator.Authenticate(context.Background(), ticket)
+	_, missingErr := authenticator.AuthenticateStreamTicket(context.Background(), "")
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, Identity{UserID: 7}, identity)
+	require.EqualError(t, bearerErr, ErrorInvalidToken.Error())
+	require.EqualError(t, missingErr, ErrorUnauthenticated.Error())
+}
+
+type keyRepositoryMock struct {
+	mock.Mock
+}
+
+func (k *keyRepositoryMock) Save(ctx context.Context, key APIKey) (int64, error) {
+	args := k.Called(key)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (k *keyRepositoryMock) GetByHash(ctx context.Context, hash string) (APIKey, error) {
+	args := k.Called(hash)
+	return args.Get(0).(APIKey), args.Error(1)
+}
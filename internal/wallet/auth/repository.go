@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *repository {
+	return &repository{db: db}
+}
+
+// Save stores the hash of a new API key. It joins the transaction of the context, so the key is only kept along
+// with the audit event of its creation
+func (r repository) Save(ctx context.Context, key APIKey) (int64, error) {
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, "INSERT INTO api_keys(user_id,key_hash,scopes)VALUES (?,?,?);",
+		key.UserID, key.Hash, strings.Join(key.Scopes, " "))
+	if err != nil {
+		return 0, dberror.Classify(err)
+	}
+
+	return result.LastInsertId()
+}
+
+// GetByHash returns the API key with the hash unless it was revoked
+func (r repository) GetByHash(ctx context.Context, hash string) (APIKey, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT id, user_id, scopes FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL;", hash)
+	if row.Err() != nil {
+		return APIKey{}, row.Err()
+	}
+
+	var key = APIKey{Hash: hash}
+	var scopes string
+	if err := row.Scan(&key.ID, &key.UserID, &scopes); err != nil {
+		if err == sql.ErrNoRows {
+			return APIKey{}, ErrorKeyNotFound
+		}
+		return APIKey{}, err
+	}
+	key.Scopes = strings.Fields(scopes)
+
+	return key, nil
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSave_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectExec("INSERT INTO api_keys(user_id,key_hash,scopes)VALUES (?,?,?);").
+		WithArgs(int64(1), "hash", "admin").WillReturnResult(sqlmock.NewResult(5, 1))
+
+	// then
+	id, err := repository.Save(context.Background(), APIKey{UserID: 1, Hash: "hash", Scopes: []string{ScopeAdmin}})
+	require.NoError(t, err)
+	require.Equal(t, int64(5), id)
+}
+
+func TestGetByHash_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT id, user_id, scopes FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL;").
+		WithArgs("hash").WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "scopes"}).AddRow(5, 1, "admin"))
+
+	// then
+	key, err := repository.GetByHash(context.Background(), "hash")
+	require.NoError(t, err)
+	require.Equal(t, APIKey{ID: 5, UserID: 1, Hash: "hash", Scopes: []string{ScopeAdmin}}, key)
+}
+
+func TestGetByHash_ErrorKeyNotFound(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT id, user_id, scopes FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL;").
+		WithArgs("hash").WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "scopes"}))
+
+	// then
+	_, err = repository.GetByHash(context.Background(), "hash")
+	require.EqualError(t, err, ErrorKeyNotFound.Error())
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenHeader is the JWT header of the tokens signed by the wallet
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// tokenAlgorithm is the only algorithm accepted, so the tokens signed with other algorithms or unsigned are rejected
+const tokenAlgorithm = "HS256"
+
+// header is the JWT header of a token. Its other fields, e.g. typ or kid, do not change how it is checked
+type header struct {
+	Algorithm string `json:"alg"`
+}
+
+// streamAudience is the audience of the stream tickets, which open the stream of a wallet and nothing else
+const streamAudience = "stream"
+
+// StreamTicketTTL is how long a stream ticket can be used to open a stream. It is only checked when the stream
+// opens, so the stream itself outlives it
+const StreamTicketTTL = time.Minute
+
+// claims are the JWT claims of a token. The subject is the user id and scope holds the scopes separated by spaces.
+// The tokens for the stream audience are stream tickets, which are not accepted anywhere else
+type claims struct {
+	Subject   string   `json:"sub"`
+	Scope     string   `json:"scope,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// audience is the aud claim, which a JWT holds either as a string or as an array of strings
+type audience []string
+
+func (a audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+
+	return json.Marshal([]string(a))
+}
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// contains tells whether the token is meant for the audience
+func (a audience) contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SignToken returns a HS256 JWT for the identity that expires after the ttl
+func SignToken(secret []byte, identity Identity, now time.Time, ttl time.Duration) (string, error) {
+	return signClaims(secret, claims{
+		Subject:   strconv.FormatInt(identity.UserID, 10),
+		Scope:     strings.Join(identity.Scopes, " "),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+}
+
+// ParseToken checks the signature and expiration of a token returned by SignToken and returns its identity
+func ParseToken(secret []byte, token string, now time.Time) (Identity, error) {
+	result, userID, err := parseClaims(secret, token, now)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if result.Audience.contains(streamAudience) {
+		return Identity{}, ErrorInvalidToken
+	}
+
+	return Identity{UserID: userID, Scopes: strings.Fields(result.Scope)}, nil
+}
+
+// SignStreamTicket returns a ticket that opens the stream of the wallet of the user for StreamTicketTTL. Browsers
+// send it as a query parameter, as EventSource can not send the Authorization header
+func SignStreamTicket(secret []byte, userID int64, now time.Time) (string, error) {
+	return signClaims(secret, claims{
+		Subject:   strconv.FormatInt(userID, 10),
+		Audience:  audience{streamAudience},
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(StreamTicketTTL).Unix(),
+	})
+}
+
+// ParseStreamTicket checks the signature and expiration of a ticket returned by SignStreamTicket and returns the
+// identity it opens the stream of, without scopes
+func ParseStreamTicket(secret []byte, ticket string, now time.Time) (Identity, error) {
+	result, userID, err := parseClaims(secret, ticket, now)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if !result.Audience.contains(streamAudience) {
+		return Identity{}, ErrorInvalidToken
+	}
+
+	return Identity{UserID: userID}, nil
+}
+
+func signClaims(secret []byte, tokenClaims claims) (string, error) {
+	payload, err := json.Marshal(tokenClaims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + sign(secret, unsigned), nil
+}
+
+// parseClaims checks the signature and expiration of a token and returns its claims and subject
+func parseClaims(secret []byte, token string, now time.Time) (claims, int64, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims{}, 0, ErrorInvalidToken
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims{}, 0, ErrorInvalidToken
+	}
+
+	var parsed header
+	if err = json.Unmarshal(rawHeader, &parsed); err != nil || parsed.Algorithm != tokenAlgorithm {
+		return claims{}, 0, ErrorInvalidToken
+	}
+
+	if !hmac.Equal([]byte(parts[2]), []byte(sign(secret, parts[0]+"."+parts[1]))) {
+		return claims{}, 0, ErrorInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims{}, 0, ErrorInvalidToken
+	}
+
+	var result claims
+	if err = json.Unmarshal(payload, &result); err != nil {
+		return claims{}, 0, ErrorInvalidToken
+	}
+
+	userID, err := strconv.ParseInt(result.Subject, 10, 64)
+	if err != nil || userID <= 0 {
+		return claims{}, 0, ErrorInvalidToken
+	}
+
+	if now.Unix() >= result.ExpiresAt {
+		return claims{}, 0, ErrorExpiredToken
+	}
+
+	return result, userID, nil
+}
+
+func sign(secret []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
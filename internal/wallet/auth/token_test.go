@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("secret")
+
+func TestToken_RoundTrip(t *testing.T) {
+	// Given
+	now := time.Now()
+	token, err := SignToken(secret, Identity{UserID: 7, Scopes: []string{ScopeAdmin}}, now, time.Hour)
+	require.NoError(t, err)
+
+	// When
+	identity, err := ParseToken(secret, token, now.Add(59*time.Minute))
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, Identity{UserID: 7, Scopes: []string{ScopeAdmin}}, identity)
+}
+
+func TestParseToken_ErrorExpiredToken(t *testing.T) {
+	// Given
+	now := time.Now()
+	token, err := SignToken(secret, Identity{UserID: 7}, now, time.Hour)
+	require.NoError(t, err)
+
+	// When
+	_, err = ParseToken(secret, token, now.Add(time.Hour))
+
+	// Then
+	require.EqualError(t, err, ErrorExpiredToken.Error())
+}
+
+func TestParseToken_ErrorInvalidToken(t *testing.T) {
+	now := time.Now()
+	token, err := SignToken(secret, Identity{UserID: 7}, now, time.Hour)
+	require.NoError(t, err)
+	parts := strings.Split(token, ".")
+	adminPayload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"7","scope":"admin","exp":9999999999}`))
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	noSubject, err := SignToken(secret, Identity{}, now, time.Hour)
+	require.NoError(t, err)
+	ticket, err := SignStreamTicket(secret, 7, now)
+	require.NoError(t, err)
+
+	tt := []struct {
+		TestName, Token string
+		Secret          []byte
+	}{
+		{"OtherSecret", token, []byte("other")},
+		{"TamperedPayload", parts[0] + "." + adminPayload + "." + parts[2], secret},
+		{"AlgorithmNone", noneHeader + "." + parts[1] + ".", secret},
+		{"NotAToken", "token", secret},
+		{"NoSubject", noSubject, secret},
+		{"StreamTicket", ticket, secret},
+		{"SignedAlgorithmNone", signWithHeader(`{"alg":"none"}`, parts[1]), secret},
+		{"OtherAlgorithm", signWithHeader(`{"alg":"HS512","typ":"JWT"}`, parts[1]), secret},
+		{"NoAlgorithm", signWithHeader(`{"typ":"JWT"}`, parts[1]), secret},
+		{"HeaderNotJSON", signWithHeader(`HS256`, parts[1]), secret},
+	}
+
+	for _, tc := range tt {
+		// When
+		_, err := ParseToken(tc.Secret, tc.Token, now)
+
+		// Then
+		require.EqualError(t, err, ErrorInvalidToken.Error(), tc.TestName)
+	}
+}
+
+func TestParseToken_OtherHeaders(t *testing.T) {
+	// Given
+	now := time.Now()
+	token, err := SignToken(secret, Identity{UserID: 7, Scopes: []string{ScopeAdmin}}, now, time.Hour)
+	require.NoError(t, err)
+	payload := strings.Split(token, ".")[1]
+
+	for _, v := range []string{`{"typ":"JWT","alg":"HS256"}`, `{"alg":"HS256"}`, `{"alg":"HS256","typ":"JWT","kid":"k1"}`} {
+		// When
+		identity, err := ParseToken(secret, signWithHeader(v, payload), now)
+
+		// Then
+		require.NoError(t, err, v)
+		require.Equal(t, Identity{UserID: 7, Scopes: []string{ScopeAdmin}}, identity, v)
+	}
+}
+
+func TestParseToken_Audience(t *testing.T) {
+	// Given
+	now := time.Now()
+	claims := `{"sub":"7","exp":9999999999,"aud":%s}`
+	tt := []struct {
+		TestName, Audience string
+		Expected           error
+	}{
+		{"Single", `"partner"`, nil},
+		{"Array", `["partner","wallet"]`, nil},
+		{"Stream", `"stream"`, ErrorInvalidToken},
+		{"ArrayWithStream", `["partner","stream"]`, ErrorInvalidToken},
+	}
+
+	for _, tc := range tt {
+		payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(claims, tc.Audience)))
+
+		// When
+		_, err := ParseToken(secret, signWithHeader(`{"alg":"HS256"}`, payload), now)
+
+		// Then
+		if tc.Expected == nil {
+			require.NoError(t, err, tc.TestName)
+		} else {
+			require.EqualError(t, err, tc.Expected.Error(), tc.TestName)
+		}
+	}
+}
+
+// signWithHeader signs the payload of a token with the secret under another header
+func signWithHeader(rawHeader, payload string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(rawHeader)) + "." + payload
+	return unsigned + "." + sign(secret, unsigned)
+}
+
+func TestStreamTicket_RoundTrip(t *testing.T) {
+	// Given
+	now := time.Now()
+	ticket, err := SignStreamTicket(secret, 7, now)
+	require.NoError(t, err)
+
+	// When
+	identity, err := ParseStreamTicket(secret, ticket, now.Add(StreamTicketTTL-time.Second))
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, Identity{UserID: 7}, identity)
+}
+
+func TestParseStreamTicket_Errors(t *testing.T) {
+	// Given
+	now := time.Now()
+	ticket, err := SignStreamTicket(secret, 7, now)
+	require.NoError(t, err)
+	token, err := SignToken(secret, Identity{UserID: 7, Scopes: []string{ScopeAdmin}}, now, time.Hour)
+	require.NoError(t, err)
+
+	tt := []struct {
+		TestName, Ticket string
+		Now              time.Time
+		Expected         error
+	}{
+		{"Expired", ticket, now.Add(StreamTicketTTL), ErrorExpiredToken},
+		{"Token", token, now, ErrorInvalidToken},
+		{"WrongSignature", ticket[:strings.LastIndex(ticket, ".")] + ".c2lnbmF0dXJl", now, ErrorInvalidToken},
+	}
+
+	for _, tc := range tt {
+		// When
+		_, err := ParseStreamTicket(secret, tc.Ticket, tc.Now)
+
+		// Then
+		require.EqualError(t, err, tc.Expected.Error(), tc.TestName)
+	}
+}
+
+func TestIdentity_CanAccess(t *testing.T) {
+	require.True(t, Identity{UserID: 1}.CanAccess(1))
+	require.False(t, Identity{UserID: 1}.CanAccess(2))
+	require.True(t, Identity{UserID: 1, Scopes: []string{ScopeAdmin}}.CanAccess(2))
+}
@@ -0,0 +1,104 @@
+package broadcast
+
+import "sync"
+
+const (
+	// EventMovement carries a movement saved on the wallet
+	EventMovement = "movement"
+	// EventBalance carries the balance of each currency of the wallet
+	EventBalance = "balance"
+)
+
+// Event is a change of the wallet of a user pushed to its subscribers. Data is encoded as JSON
+type Event struct {
+	Type   string
+	UserID int64
+	Data   interface{}
+}
+
+// Broadcaster pushes the events of each user to the subscribers of the user within the process. A subscriber that
+// does not keep up, whose buffer is full, is dropped and its channel closed, so it can subscribe again and read the
+// current state instead of missing events silently
+type Broadcaster struct {
+	mu          sync.Mutex
+	buffer      int
+	closed      bool
+	subscribers map[int64]map[chan Event]struct{}
+}
+
+func New(buffer int) *Broadcaster {
+	return &Broadcaster{buffer: buffer, subscribers: make(map[int64]map[chan Event]struct{})}
+}
+
+// Subscribe returns the channel of the events of a user and the function that ends the subscription
+func (b *Broadcaster) Subscribe(userID int64) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := make(chan Event, b.buffer)
+	if b.closed {
+		close(events)
+		return events, func() {}
+	}
+
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan Event]struct{})
+	}
+	b.subscribers[userID][events] = struct{}{}
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.remove(userID, events)
+		})
+	}
+}
+
+// HasSubscribers tells whether someone listens to the events of a user, to skip building events nobody reads
+func (b *Broadcaster) HasSubscribers(userID int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers[userID]) > 0
+}
+
+// Publish pushes the event to the subscribers of its user without blocking
+func (b *Broadcaster) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for v := range b.subscribers[event.UserID] {
+		select {
+		case v <- event:
+		default:
+			b.remove(event.UserID, v)
+		}
+	}
+}
+
+// Close ends every subscription and the ones made afterwards, e.g. to let the streams finish on shutdown
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for userID, subscribers := range b.subscribers {
+		for v := range subscribers {
+			b.remove(userID, v)
+		}
+	}
+}
+
+// remove ends a subscription, if it was not ended yet. The caller holds the lock
+func (b *Broadcaster) remove(userID int64, events chan Event) {
+	if _, ok := b.subscribers[userID][events]; !ok {
+		return
+	}
+
+	delete(b.subscribers[userID], events)
+	if len(b.subscribers[userID]) == 0 {
+		delete(b.subscribers, userID)
+	}
+	close(events)
+}
@@ -0,0 +1,78 @@
+package broadcast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcaster_Publish_ToSubscribersOfTheUser(t *testing.T) {
+	// Given
+	broadcaster := New(1)
+	first, cancelFirst := broadcaster.Subscribe(1)
+	defer cancelFirst()
+	second, cancelSecond := broadcaster.Subscribe(1)
+	defer cancelSecond()
+	other, cancelOther := broadcaster.Subscribe(2)
+	defer cancelOther()
+
+	// When
+	broadcaster.Publish(Event{Type: EventBalance, UserID: 1, Data: "balance"})
+
+	// Then
+	require.Equal(t, Event{Type: EventBalance, UserID: 1, Data: "balance"}, <-first)
+	require.Equal(t, Event{Type: EventBalance, UserID: 1, Data: "balance"}, <-second)
+	require.Len(t, other, 0)
+}
+
+func TestBroadcaster_Publish_DropsSlowSubscribers(t *testing.T) {
+	// Given
+	broadcaster := New(1)
+	events, cancel := broadcaster.Subscribe(1)
+
+	// When
+	broadcaster.Publish(Event{Type: EventMovement, UserID: 1})
+	broadcaster.Publish(Event{Type: EventMovement, UserID: 1})
+
+	// Then
+	<-events
+	_, open := <-events
+	require.False(t, open)
+	require.False(t, broadcaster.HasSubscribers(1))
+	cancel()
+}
+
+func TestBroadcaster_Cancel(t *testing.T) {
+	// Given
+	broadcaster := New(1)
+	events, cancel := broadcaster.Subscribe(1)
+	require.True(t, broadcaster.HasSubscribers(1))
+
+	// When
+	cancel()
+	cancel()
+	broadcaster.Publish(Event{Type: EventMovement, UserID: 1})
+
+	// Then
+	_, open := <-events
+	require.False(t, open)
+	require.False(t, broadcaster.HasSubscribers(1))
+}
+
+func TestBroadcaster_Close(t *testing.T) {
+	// Given
+	broadcaster := New(1)
+	events, cancel := broadcaster.Subscribe(1)
+	defer cancel()
+
+	// When
+	broadcaster.Close()
+	later, cancelLater := broadcaster.Subscribe(2)
+	defer cancelLater()
+
+	// Then
+	_, open := <-events
+	require.False(t, open)
+	_, open = <-later
+	require.False(t, open)
+}
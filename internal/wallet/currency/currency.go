@@ -0,0 +1,25 @@
+package currency
+
+import (
+	"context"
+	"errors"
+)
+
+// MaxDigits is the scale of the amount columns, DECIMAL(18,8)
+const MaxDigits = 8
+
+var (
+	ErrorCurrencyNotFound = errors.New("currency: not found")
+	ErrorInvalidDigits    = errors.New("currency: digits must be between 0 and 8")
+)
+
+type Repository interface {
+	List(ctx context.Context) ([]Currency, error)
+}
+
+// Currency is a supported currency with the decimal places its amounts are stored with
+type Currency struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Digits int32  `json:"digits"`
+}
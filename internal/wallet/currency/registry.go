@@ -0,0 +1,72 @@
+package currency
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Registry holds the supported currencies, loaded once from the currencies table
+type Registry struct {
+	currencies map[string]Currency
+	names      []string
+}
+
+// NewRegistry creates a Registry with the given currencies. A currency with more digits than the amounts are
+// stored with is rejected, since its amounts would be rounded by the database
+func NewRegistry(currencies []Currency) (*Registry, error) {
+	registry := &Registry{currencies: make(map[string]Currency, len(currencies))}
+	for _, v := range currencies {
+		if v.Digits < 0 || v.Digits > MaxDigits {
+			return nil, fmt.Errorf("%w: %s has %d", ErrorInvalidDigits, v.Name, v.Digits)
+		}
+
+		v.Name = strings.ToUpper(v.Name)
+		registry.currencies[v.Name] = v
+		registry.names = append(registry.names, v.Name)
+	}
+	sort.Strings(registry.names)
+
+	return registry, nil
+}
+
+// MustNewRegistry is like NewRegistry but panics when a currency is rejected, for fixed lists of currencies
+func MustNewRegistry(currencies []Currency) *Registry {
+	registry, err := NewRegistry(currencies)
+	if err != nil {
+		panic(err)
+	}
+
+	return registry
+}
+
+// Load creates a Registry with the currencies saved in the repository
+func Load(ctx context.Context, repository Repository) (*Registry, error) {
+	currencies, err := repository.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRegistry(currencies)
+}
+
+// Get returns a currency by its name, regardless of the case
+func (r *Registry) Get(name string) (Currency, error) {
+	currency, ok := r.currencies[strings.ToUpper(name)]
+	if !ok {
+		return Currency{}, ErrorCurrencyNotFound
+	}
+
+	return currency, nil
+}
+
+// List returns all the currencies ordered by name
+func (r *Registry) List() []Currency {
+	var currencies = make([]Currency, 0, len(r.names))
+	for _, v := range r.names {
+		currencies = append(currencies, r.currencies[v])
+	}
+
+	return currencies
+}
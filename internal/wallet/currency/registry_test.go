@@ -0,0 +1,43 @@
+package currency
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Get(t *testing.T) {
+	// Given
+	registry, err := NewRegistry([]Currency{{ID: 1, Name: "usdt", Digits: 2}, {ID: 2, Name: "BTC", Digits: 8}})
+	require.NoError(t, err)
+
+	// When
+	currency, err := registry.Get("Usdt")
+	require.NoError(t, err)
+	require.Equal(t, Currency{ID: 1, Name: "USDT", Digits: 2}, currency)
+
+	// Then
+	_, err = registry.Get("ETH")
+	require.EqualError(t, err, ErrorCurrencyNotFound.Error())
+}
+
+func TestRegistry_List_OrderedByName(t *testing.T) {
+	// Given
+	registry := MustNewRegistry([]Currency{{Name: "USDT"}, {Name: "ARS"}, {Name: "BTC"}})
+
+	// When
+	currencies := registry.List()
+
+	// Then
+	require.Equal(t, []Currency{{Name: "ARS"}, {Name: "BTC"}, {Name: "USDT"}}, currencies)
+}
+
+func TestNewRegistry_ErrorInvalidDigits(t *testing.T) {
+	// When
+	registry, err := NewRegistry([]Currency{{ID: 1, Name: "USDT", Digits: 2}, {ID: 2, Name: "ETH", Digits: 18}})
+
+	// Then
+	require.True(t, errors.Is(err, ErrorInvalidDigits))
+	require.Nil(t, registry)
+}
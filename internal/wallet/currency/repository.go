@@ -0,0 +1,38 @@
+package currency
+
+import (
+	"context"
+	"database/sql"
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *repository {
+	return &repository{db: db}
+}
+
+// List returns all the supported currencies
+func (r repository) List(ctx context.Context) ([]Currency, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, name, digits FROM currencies ORDER BY name;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var currencies []Currency
+	for rows.Next() {
+		var currency Currency
+		if err = rows.Scan(&currency.ID, &currency.Name, &currency.Digits); err != nil {
+			return nil, err
+		}
+		currencies = append(currencies, currency)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return currencies, nil
+}
@@ -0,0 +1,53 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT id, name, digits FROM currencies ORDER BY name;").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "digits"}).
+			AddRow(1, "ARS", 2).
+			AddRow(2, "BTC", 8))
+
+	// then
+	currencies, err := repository.List(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []Currency{
+		{ID: 1, Name: "ARS", Digits: 2},
+		{ID: 2, Name: "BTC", Digits: 8},
+	}, currencies)
+}
+
+func TestList_Fail(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT id, name, digits FROM currencies ORDER BY name;").
+		WillReturnError(errors.New("database error"))
+
+	// then
+	currencies, err := repository.List(context.Background())
+	require.Error(t, err)
+	require.Empty(t, currencies)
+}
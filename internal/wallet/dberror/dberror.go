@@ -0,0 +1,116 @@
+package dberror
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The classes of the MySQL errors the repositories translate or the handlers answer as other than a server error
+var (
+	ErrorDuplicate  = errors.New("dberror: duplicate entry")
+	ErrorForeignKey = errors.New("dberror: foreign key violation")
+	ErrorOutOfRange = errors.New("dberror: value out of range")
+	ErrorDeadlock   = errors.New("dberror: deadlock")
+	ErrorTimeout    = errors.New("dberror: lock wait timeout")
+)
+
+// classes maps the MySQL error numbers to their class
+var classes = map[uint16]error{
+	1022: ErrorDuplicate,
+	1062: ErrorDuplicate,
+	1586: ErrorDuplicate,
+	1216: ErrorForeignKey,
+	1217: ErrorForeignKey,
+	1451: ErrorForeignKey,
+	1452: ErrorForeignKey,
+	1264: ErrorOutOfRange,
+	1690: ErrorOutOfRange,
+	1213: ErrorDeadlock,
+	1205: ErrorTimeout,
+	3024: ErrorTimeout,
+}
+
+// Error is a MySQL error of a known class. errors.Is matches its class, and errors.As the *mysql.MySQLError
+type Error struct {
+	Class error
+	// Key is the unique index a duplicate entry violates, without its table
+	Key string
+	err *mysql.MySQLError
+}
+
+func (e *Error) Error() string {
+	return e.err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Class, e.err}
+}
+
+// Number returns the number of the MySQL error
+func (e *Error) Number() uint16 {
+	return e.err.Number
+}
+
+// Classify returns the classified error when err wraps a MySQL error of a known class. Any other error, e.g. a
+// canceled context or a broken connection, is returned as is
+func Classify(err error) error {
+	if classified, ok := As(err); ok {
+		return classified
+	}
+
+	return err
+}
+
+// As returns the class of the MySQL error wrapped by err, false when it wraps none of a known class
+func As(err error) (*Error, bool) {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified, true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return nil, false
+	}
+
+	class, ok := classes[mysqlErr.Number]
+	if !ok {
+		return nil, false
+	}
+
+	classified = &Error{Class: class, err: mysqlErr}
+	if class == ErrorDuplicate {
+		classified.Key = duplicateKey(mysqlErr.Message)
+	}
+
+	return classified, true
+}
+
+// Number returns the number of the MySQL error wrapped by err, false when it wraps none
+func Number(err error) (uint16, bool) {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return 0, false
+	}
+
+	return mysqlErr.Number, true
+}
+
+// duplicateKey reads the index of a "Duplicate entry 'value' for key 'index'" message. MySQL 8 prefixes the index
+// with its table
+func duplicateKey(message string) string {
+	const marker = "for key '"
+	i := strings.LastIndex(message, marker)
+	if i < 0 {
+		return ""
+	}
+
+	key := strings.TrimSuffix(message[i+len(marker):], "'")
+	if dot := strings.LastIndex(key, "."); dot >= 0 {
+		key = key[dot+1:]
+	}
+
+	return key
+}
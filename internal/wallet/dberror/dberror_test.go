@@ -0,0 +1,84 @@
+package dberror
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	tt := []struct {
+		TestName      string
+		Number        uint16
+		ExpectedClass error
+	}{
+		{"Duplicate", 1062, ErrorDuplicate},
+		{"ForeignKey", 1452, ErrorForeignKey},
+		{"ParentRow", 1451, ErrorForeignKey},
+		{"OutOfRange", 1264, ErrorOutOfRange},
+		{"UnsignedOutOfRange", 1690, ErrorOutOfRange},
+		{"Deadlock", 1213, ErrorDeadlock},
+		{"LockWaitTimeout", 1205, ErrorTimeout},
+	}
+
+	for _, tc := range tt {
+		// Given
+		mysqlErr := &mysql.MySQLError{Number: tc.Number}
+
+		// When
+		err := Classify(fmt.Errorf("movement: %w", mysqlErr))
+
+		// then
+		require.True(t, errors.Is(err, tc.ExpectedClass), tc.TestName)
+		var unwrapped *mysql.MySQLError
+		require.True(t, errors.As(err, &unwrapped), tc.TestName)
+		require.Equal(t, tc.Number, unwrapped.Number, tc.TestName)
+	}
+}
+
+func TestClassify_NotClassified(t *testing.T) {
+	for _, err := range []error{context.Canceled, driver.ErrBadConn, mysql.ErrInvalidConn, &mysql.MySQLError{Number: 1146}} {
+		// When
+		classified, ok := As(err)
+
+		// then
+		require.False(t, ok, err.Error())
+		require.Nil(t, classified, err.Error())
+		require.Equal(t, err, Classify(err), err.Error())
+	}
+}
+
+func TestAs_DuplicateKey(t *testing.T) {
+	tt := []struct {
+		TestName, Message, ExpectedKey string
+	}{
+		{"MySQL57", "Duplicate entry 'maria' for key 'alias_UNIQUE'", "alias_UNIQUE"},
+		{"MySQL8", "Duplicate entry 'maria@gmail.com' for key 'users.email_UNIQUE'", "email_UNIQUE"},
+		{"QuoteInValue", "Duplicate entry 'for key 'x'' for key 'users.alias_UNIQUE'", "alias_UNIQUE"},
+		{"NoKey", "", ""},
+	}
+
+	for _, tc := range tt {
+		// When
+		classified, ok := As(&mysql.MySQLError{Number: 1062, Message: tc.Message})
+
+		// then
+		require.True(t, ok, tc.TestName)
+		require.Equal(t, tc.ExpectedKey, classified.Key, tc.TestName)
+		require.Equal(t, uint16(1062), classified.Number(), tc.TestName)
+	}
+}
+
+func TestNumber(t *testing.T) {
+	number, ok := Number(fmt.Errorf("wrapped: %w", &mysql.MySQLError{Number: 1146}))
+	require.True(t, ok)
+	require.Equal(t, uint16(1146), number)
+
+	_, ok = Number(context.DeadlineExceeded)
+	require.False(t, ok)
+}
@@ -0,0 +1,33 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrorKeyNotFound       = errors.New("idempotency: key not found")
+	ErrorKeyAlreadyExist   = errors.New("idempotency: key already exist")
+	ErrorKeyReused         = errors.New("idempotency: key already used with a different request")
+	ErrorRequestInProgress = errors.New("idempotency: a request with the same key is in progress")
+	ErrorOutcomeUnknown    = errors.New("idempotency: the request with the same key did not finish and its outcome is unknown")
+)
+
+// Repository stores the keys of each caller, so the same key sent by two callers identifies two requests
+type Repository interface {
+	Reserve(ctx context.Context, callerID int64, key, requestHash string) error
+	Get(ctx context.Context, callerID int64, key string) (Record, error)
+	Complete(ctx context.Context, callerID int64, key string, statusCode int, responseBody []byte) error
+	Release(ctx context.Context, callerID int64, key string) error
+}
+
+// Record is the stored outcome of a request sent with an Idempotency-Key. A zero StatusCode
+// means the original request has not finished yet, and Expired that it has not finished within ReservationTTL.
+type Record struct {
+	CallerID     int64
+	Key          string
+	RequestHash  string
+	StatusCode   int
+	ResponseBody []byte
+	Expired      bool
+}
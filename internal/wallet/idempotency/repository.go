@@ -0,0 +1,70 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+)
+
+// ReservationTTL is how long a key stays reserved by a request that has not finished. It is longer than any
+// request takes, so an older reservation belongs to a request that was lost, e.g. when the server crashed, whose
+// outcome is unknown
+const ReservationTTL = 5 * time.Minute
+
+type repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *repository {
+	return &repository{db: db}
+}
+
+// Reserve saves a key for a request that is about to be processed. A reserved key is never taken over, not even
+// when its reservation expired: the lost request may have been processed, so running it again could process it twice
+func (r repository) Reserve(ctx context.Context, callerID int64, key, requestHash string) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO idempotency_keys(caller_id,idempotency_key,request_hash)VALUES (?,?,?);",
+		callerID, key, requestHash)
+	if errors.Is(dberror.Classify(err), dberror.ErrorDuplicate) {
+		return ErrorKeyAlreadyExist
+	}
+
+	return dberror.Classify(err)
+}
+
+// Get returns the record saved for a key
+func (r repository) Get(ctx context.Context, callerID int64, key string) (Record, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT caller_id, idempotency_key, request_hash, status_code, response_body, "+
+		"status_code = 0 AND date_created < current_timestamp - INTERVAL ? SECOND "+
+		"FROM idempotency_keys WHERE caller_id = ? AND idempotency_key = ?;", int64(ReservationTTL/time.Second), callerID, key)
+	if row.Err() != nil {
+		return Record{}, dberror.Classify(row.Err())
+	}
+
+	var record Record
+	if err := row.Scan(&record.CallerID, &record.Key, &record.RequestHash, &record.StatusCode, &record.ResponseBody,
+		&record.Expired); err != nil {
+		if err == sql.ErrNoRows {
+			return Record{}, ErrorKeyNotFound
+		}
+		return Record{}, dberror.Classify(err)
+	}
+
+	return record, nil
+}
+
+// Complete stores the response of the request that reserved the key
+func (r repository) Complete(ctx context.Context, callerID int64, key string, statusCode int, responseBody []byte) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE idempotency_keys SET status_code = ?, response_body = ? "+
+		"WHERE caller_id = ? AND idempotency_key = ?;", statusCode, responseBody, callerID, key)
+	return dberror.Classify(err)
+}
+
+// Release deletes a key whose request did not finish, so it can be retried
+func (r repository) Release(ctx context.Context, callerID int64, key string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE caller_id = ? AND idempotency_key = ? AND status_code = 0;",
+		callerID, key)
+	return dberror.Classify(err)
+}
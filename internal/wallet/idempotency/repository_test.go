@@ -0,0 +1,149 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	insertKey = "INSERT INTO idempotency_keys(caller_id,idempotency_key,request_hash)VALUES (?,?,?);"
+	selectKey = "SELECT caller_id, idempotency_key, request_hash, status_code, response_body, " +
+		"status_code = 0 AND date_created < current_timestamp - INTERVAL ? SECOND " +
+		"FROM idempotency_keys WHERE caller_id = ? AND idempotency_key = ?;"
+)
+
+var keyColumns = []string{"caller_id", "idempotency_key", "request_hash", "status_code", "response_body", "expired"}
+
+func TestReserve_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectExec(insertKey).
+		WithArgs(int64(1), "key", "hash").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// then
+	err = repository.Reserve(context.Background(), 1, "key", "hash")
+	require.NoError(t, err)
+}
+
+func TestReserve_ErrorKeyAlreadyExist(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectExec(insertKey).
+		WithArgs(int64(1), "key", "hash").WillReturnError(&mysql.MySQLError{Number: 1062})
+
+	// then
+	err = repository.Reserve(context.Background(), 1, "key", "hash")
+	require.EqualError(t, err, ErrorKeyAlreadyExist.Error())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGet_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery(selectKey).
+		WithArgs(int64(300), int64(1), "key").WillReturnRows(sqlmock.NewRows(keyColumns).
+		AddRow(1, "key", "hash", 201, []byte("1"), false))
+
+	// then
+	record, err := repository.Get(context.Background(), 1, "key")
+	require.NoError(t, err)
+	require.Equal(t, Record{CallerID: 1, Key: "key", RequestHash: "hash", StatusCode: 201, ResponseBody: []byte("1")}, record)
+}
+
+func TestGet_ExpiredReservation(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery(selectKey).
+		WithArgs(int64(300), int64(1), "key").WillReturnRows(sqlmock.NewRows(keyColumns).
+		AddRow(1, "key", "hash", 0, nil, true))
+
+	// then
+	record, err := repository.Get(context.Background(), 1, "key")
+	require.NoError(t, err)
+	require.Equal(t, Record{CallerID: 1, Key: "key", RequestHash: "hash", Expired: true}, record)
+}
+
+func TestGet_ErrorKeyNotFound(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery(selectKey).
+		WithArgs(int64(300), int64(1), "key").WillReturnRows(sqlmock.NewRows(keyColumns))
+
+	// then
+	record, err := repository.Get(context.Background(), 1, "key")
+	require.EqualError(t, err, ErrorKeyNotFound.Error())
+	require.Empty(t, record)
+}
+
+func TestComplete_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectExec("UPDATE idempotency_keys SET status_code = ?, response_body = ? WHERE caller_id = ? AND idempotency_key = ?;").
+		WithArgs(201, []byte("1"), int64(1), "key").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// then
+	err = repository.Complete(context.Background(), 1, "key", 201, []byte("1"))
+	require.NoError(t, err)
+}
+
+func TestRelease_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE caller_id = ? AND idempotency_key = ? AND status_code = 0;").
+		WithArgs(int64(1), "key").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// then
+	err = repository.Release(context.Background(), 1, "key")
+	require.NoError(t, err)
+}
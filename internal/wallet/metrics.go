@@ -0,0 +1,86 @@
+package wallet
+
+import (
+	"context"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/metrics"
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+	"github.com/spolia/lemon-wallet/internal/wallet/rate"
+	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/spolia/lemon-wallet/internal/wallet/webhook"
+)
+
+// resultOk is the result of the operations that succeeded, and resultError the one of the errors without a name
+const (
+	resultOk    = "ok"
+	resultError = "error"
+)
+
+// errorResults names the results of the operations that failed with an expected error
+var errorResults = map[error]string{
+	movement.ErrorInsufficientBalance: "insufficient_balance",
+	movement.ErrorWrongOperation:      "wrong_operation",
+	movement.ErrorWrongUser:           "wrong_user",
+	movement.ErrorWrongCurrency:       "wrong_currency",
+	movement.ErrorSameUser:            "same_user",
+	movement.ErrorSameCurrency:        "same_currency",
+	movement.ErrorAmountTooSmall:      "amount_too_small",
+	movement.ErrorInvalidAmount:       "invalid_amount",
+	movement.ErrorInvalidPrecision:    "invalid_precision",
+	movement.ErrorWalletFrozen:        "wallet_frozen",
+	movement.ErrorReasonRequired:      "reason_required",
+	user.ErrorUserNotFound:            "user_not_found",
+	user.ErrorAlreadyExist:            "user_already_exist",
+	user.ErrorAliasAlreadyExist:       "alias_already_exist",
+	user.ErrorEmailAlreadyExist:       "email_already_exist",
+	rate.ErrorRateNotFound:            "rate_not_found",
+	webhook.ErrorInvalidURL:           "invalid_url",
+	webhook.ErrorUnresolvableHost:     "unresolvable_host",
+	webhook.ErrorForbiddenAddress:     "forbidden_address",
+	ErrorExchangeUnavailable:          "exchange_unavailable",
+	ErrorWebhooksUnavailable:          "webhooks_unavailable",
+	ErrorAPIKeysUnavailable:           "api_keys_unavailable",
+	context.Canceled:                  "canceled",
+	context.DeadlineExceeded:          "deadline_exceeded",
+	dberror.ErrorDuplicate:            "duplicate",
+	dberror.ErrorForeignKey:           "foreign_key",
+	dberror.ErrorOutOfRange:           "out_of_range",
+	dberror.ErrorDeadlock:             "deadlock",
+	dberror.ErrorTimeout:              "lock_timeout",
+}
+
+// WithMetrics registers the counters and latencies of the operations in the registry
+func WithMetrics(registry *metrics.Registry) Option {
+	return func(s *Service) {
+		s.operations = registry.Counter("wallet_operations_total",
+			"Number of wallet operations by operation and result, ok or the error that rejected it.", "operation", "result")
+		s.latency = registry.Histogram("wallet_operation_duration_seconds", "Latency of the wallet operations.",
+			metrics.DefaultBuckets, "operation")
+	}
+}
+
+// observe counts an operation by its result and observes its latency. It is deferred with the address of the error
+// the operation returns
+func (s *Service) observe(operation string, start time.Time, err *error) {
+	s.operations.Inc(operation, result(*err))
+	s.latency.Observe(time.Since(start).Seconds(), operation)
+}
+
+func result(err error) string {
+	if err == nil {
+		return resultOk
+	}
+
+	if name, ok := errorResults[err]; ok {
+		return name
+	}
+
+	// the database errors are named by their class
+	if classified, ok := dberror.As(err); ok {
+		return errorResults[classified.Class]
+	}
+
+	return resultError
+}
@@ -0,0 +1,21 @@
+package movement
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// chainHash returns the SHA-256 of a movement chained to the hash of the previous movement of the same user and
+// currency, which is empty for the first one. Amounts are hashed without trailing zeros and the date in UTC
+// with a precision of seconds, as the database stores them
+func chainHash(prevHash string, movement Movement, total decimal.Decimal, dateCreated time.Time) string {
+	content, _ := json.Marshal([]interface{}{prevHash, movement.UserID, movement.CurrencyName, movement.Type,
+		movement.Amount.String(), total.String(), movement.ExchangeID, movement.ActorID, movement.Reason,
+		dateCreated.UTC().Format(time.RFC3339)})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,48 @@
+package movement
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// cursor is the position of the last movement of a page in the order it was read with. It is sent to the
+// clients as an opaque token
+type cursor struct {
+	Order       string          `json:"o,omitempty"`
+	DateCreated time.Time       `json:"d"`
+	Amount      decimal.Decimal `json:"a"`
+	ID          int64           `json:"i"`
+}
+
+// encodeCursor returns the token of the position after the row
+func encodeCursor(row Row, sort, direction string) string {
+	data, _ := json.Marshal(cursor{Order: sort + " " + direction, DateCreated: row.DateCreated, Amount: row.Amount, ID: row.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor reads a token returned by encodeCursor for the same order. Tokens without order were
+// issued for the default one, newest first
+func decodeCursor(token, sort, direction string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor{}, ErrorInvalidCursor
+	}
+
+	var result cursor
+	if err = json.Unmarshal(data, &result); err != nil || result.ID <= 0 {
+		return cursor{}, ErrorInvalidCursor
+	}
+
+	if result.Order == "" {
+		result.Order = SortByDate + " " + SortDesc
+	}
+
+	if result.Order != sort+" "+direction {
+		return cursor{}, ErrorInvalidCursor
+	}
+
+	return result, nil
+}
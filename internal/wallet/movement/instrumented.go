@@ -0,0 +1,77 @@
+package movement
+
+import (
+	"context"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/metrics"
+	"github.com/spolia/lemon-wallet/internal/tracing"
+)
+
+// instrumented observes the latency of each method of a repository and traces its calls
+type instrumented struct {
+	next    Repository
+	latency *metrics.Histogram
+	tracer  *tracing.Tracer
+}
+
+// Instrument returns the repository observing the latency of its methods in the histogram, labeled by repository
+// and method, and tracing each call in a span. Either of them can be nil
+func Instrument(next Repository, latency *metrics.Histogram, tracer *tracing.Tracer) Repository {
+	return instrumented{next: next, latency: latency, tracer: tracer}
+}
+
+// start starts the span of a call. The function it returns ends the span with the error the call returns and
+// observes its latency, and is deferred with the address of the error
+func (i instrumented) start(ctx context.Context, method string) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := i.tracer.Start(ctx, "movement.Repository/"+method)
+	span.SetAttribute("db.system", "mysql")
+	return ctx, func(err *error) {
+		span.SetError(*err)
+		span.End()
+		i.latency.Observe(time.Since(start).Seconds(), "movement", method)
+	}
+}
+
+func (i instrumented) Save(ctx context.Context, movement Movement) (_ Movement, err error) {
+	ctx, end := i.start(ctx, "Save")
+	defer end(&err)
+	return i.next.Save(ctx, movement)
+}
+
+func (i instrumented) InitSave(ctx context.Context, movement Movement) (err error) {
+	ctx, end := i.start(ctx, "InitSave")
+	defer end(&err)
+	return i.next.InitSave(ctx, movement)
+}
+
+func (i instrumented) GetAccountExtract(ctx context.Context, id int64) (_ AccountExtract, err error) {
+	ctx, end := i.start(ctx, "GetAccountExtract")
+	defer end(&err)
+	return i.next.GetAccountExtract(ctx, id)
+}
+
+func (i instrumented) Search(ctx context.Context, filter Filter) (_ Page, err error) {
+	ctx, end := i.start(ctx, "Search")
+	defer end(&err)
+	return i.next.Search(ctx, filter)
+}
+
+func (i instrumented) Transfer(ctx context.Context, transfer Transfer) (_ Transfer, err error) {
+	ctx, end := i.start(ctx, "Transfer")
+	defer end(&err)
+	return i.next.Transfer(ctx, transfer)
+}
+
+func (i instrumented) Exchange(ctx context.Context, exchange Exchange) (_ Exchange, err error) {
+	ctx, end := i.start(ctx, "Exchange")
+	defer end(&err)
+	return i.next.Exchange(ctx, exchange)
+}
+
+func (i instrumented) Adjust(ctx context.Context, adjustment Adjustment) (_ Adjustment, err error) {
+	ctx, end := i.start(ctx, "Adjust")
+	defer end(&err)
+	return i.next.Adjust(ctx, adjustment)
+}
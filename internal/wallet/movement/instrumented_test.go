@@ -0,0 +1,42 @@
+package movement
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/metrics"
+	"github.com/spolia/lemon-wallet/internal/tracing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrument_ObservesLatencyAndTraces(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	defer db.Close()
+	registry := metrics.New()
+	latency := registry.Histogram("wallet_db_query_duration_seconds", "Latency.", metrics.DefaultBuckets, "repository", "method")
+	var exporter tracing.Memory
+	repository := Instrument(New(db, testCurrencies, logging.Discard()), latency, tracing.New(&exporter))
+
+	// When
+	mock.ExpectQuery("SELECT currency_name, amount FROM balances WHERE user_id = ?;").
+		WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"currency_name", "amount"}).AddRow(ARS, "100.50"))
+
+	// then
+	accountExtract, err := repository.GetAccountExtract(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, "100.5", accountExtract[ARS].String())
+
+	var out strings.Builder
+	_, err = registry.WriteTo(&out)
+	require.NoError(t, err)
+	require.Contains(t, out.String(), `wallet_db_query_duration_seconds_count{repository="movement",method="GetAccountExtract"} 1`)
+	require.Len(t, exporter.Spans(), 1)
+	require.Equal(t, "movement.Repository/GetAccountExtract", exporter.Spans()[0].Name)
+}
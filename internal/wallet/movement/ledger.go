@@ -0,0 +1,116 @@
+package movement
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+)
+
+// entry is a movement to be applied to the ledger, keeping its position in the request so the saved
+// movements can be returned in the same order after the entries are sorted for locking.
+type entry struct {
+	position int
+	movement Movement
+}
+
+// saveEntries applies the movements to the balances within the transaction and returns the saved
+// movements, with their ids and resulting totals. Balances are locked ordered by user and currency, so two transactions touching
+// the same balances always wait for each other instead of deadlocking.
+func (r repository) saveEntries(ctx context.Context, tx *sql.Tx, movements ...Movement) ([]Movement, error) {
+	var entries = make([]entry, len(movements))
+	for i, v := range movements {
+		entries[i] = entry{position: i, movement: v}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].movement.UserID != entries[j].movement.UserID {
+			return entries[i].movement.UserID < entries[j].movement.UserID
+		}
+		return entries[i].movement.CurrencyName < entries[j].movement.CurrencyName
+	})
+
+	var saved = make([]Movement, len(movements))
+	for _, v := range entries {
+		movement, err := r.saveEntry(ctx, tx, v.movement)
+		if err != nil {
+			return nil, err
+		}
+		saved[v.position] = movement
+	}
+
+	return saved, nil
+}
+
+// saveEntry locks the balance of the user in the movement currency, applies the movement to it and
+// saves the movement with the resulting total, chained to the last movement of the balance. The user is
+// share locked, so a wallet is not frozen while one of its movements is being saved but the movements of
+// a user do not wait for each other, nor for the share lock an exchange takes on the user through its FK
+func (r repository) saveEntry(ctx context.Context, tx *sql.Tx, movement Movement) (Movement, error) {
+	if _, err := r.currencies.Get(movement.CurrencyName); err != nil {
+		return Movement{}, ErrorWrongCurrency
+	}
+
+	var balance decimal.Decimal
+	var lastHash sql.NullString
+	var frozen bool
+	row := tx.QueryRowContext(ctx, "SELECT b.amount, b.last_hash, u.frozen FROM balances b JOIN users u ON u.id = b.user_id "+
+		"WHERE b.user_id = ? AND b.currency_name = ? FOR UPDATE OF b FOR SHARE OF u;", movement.UserID, movement.CurrencyName)
+	if err := row.Scan(&balance, &lastHash, &frozen); err != nil {
+		if err == sql.ErrNoRows {
+			return Movement{}, ErrorWrongUser
+		}
+		r.logger.ErrorContext(ctx, "movement: lock balance failed", "error", err, "user_id", movement.UserID)
+		return Movement{}, dberror.Classify(err)
+	}
+
+	if frozen && movement.Type != AdjustmentInMov && movement.Type != AdjustmentOutMov {
+		return Movement{}, ErrorWalletFrozen
+	}
+
+	total, err := applyMovement(balance, movement)
+	if err != nil {
+		return Movement{}, err
+	}
+
+	dateCreated := r.now().UTC().Truncate(time.Second)
+	hash := chainHash(lastHash.String, movement, total, dateCreated)
+	if _, err = tx.ExecContext(ctx, "UPDATE balances SET amount = ?, last_hash = ? WHERE user_id = ? AND currency_name = ?;",
+		total, hash, movement.UserID, movement.CurrencyName); err != nil {
+		return Movement{}, r.saveError(ctx, err)
+	}
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO movements(mov_type,currency_name,tx_amount,total_amount,user_id,exchange_id,"+
+		"actor_id,reason,date_created,hash)VALUES (?,?,?,?,?,?,?,?,?,?);", movement.Type, movement.CurrencyName, movement.Amount,
+		total, movement.UserID, sql.NullInt64{Int64: movement.ExchangeID, Valid: movement.ExchangeID != 0},
+		sql.NullInt64{Int64: movement.ActorID, Valid: movement.ActorID != 0},
+		sql.NullString{String: movement.Reason, Valid: movement.Reason != ""}, dateCreated, hash)
+	if err != nil {
+		return Movement{}, r.saveError(ctx, err)
+	}
+
+	if movement.ID, err = result.LastInsertId(); err != nil {
+		return Movement{}, err
+	}
+	movement.TotalAmount = total
+
+	return movement, nil
+}
+
+// applyMovement returns the balance after the movement
+func applyMovement(balance decimal.Decimal, movement Movement) (decimal.Decimal, error) {
+	switch movement.Type {
+	case DepositMov, TransferInMov, ExchangeInMov, AdjustmentInMov:
+		return balance.Add(movement.Amount), nil
+	case ExtractMov, TransferOutMov, ExchangeOutMov, AdjustmentOutMov:
+		if movement.Amount.GreaterThan(balance) {
+			return decimal.Decimal{}, ErrorInsufficientBalance
+		}
+		return balance.Sub(movement.Amount), nil
+	}
+
+	return decimal.Decimal{}, ErrorWrongOperation
+}
@@ -4,20 +4,29 @@ import (
 	"context"
 	"errors"
 	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
 )
 
 const (
-	DepositMov = "deposit"
-	BTC        = "BTC"
-	ARS        = "ARS"
-	USDT       = "USDT"
+	SortByDate   = "date"
+	SortByAmount = "amount"
+	SortAsc      = "asc"
+	SortDesc     = "desc"
 )
 
-var movementTables = map[string]string{
-	USDT: "movements_usdt",
-	ARS:  "movements_ars",
-	BTC:  "movements_btc",
-}
+const (
+	InitMov          = "init"
+	DepositMov       = "deposit"
+	ExtractMov       = "extract"
+	TransferInMov    = "transfer_in"
+	TransferOutMov   = "transfer_out"
+	ExchangeInMov    = "exchange_in"
+	ExchangeOutMov   = "exchange_out"
+	AdjustmentInMov  = "adjustment_in"
+	AdjustmentOutMov = "adjustment_out"
+)
 
 var (
 	ErrorInsufficientBalance = errors.New("movement: insufficient balance")
@@ -25,54 +34,168 @@ var (
 	ErrorWrongUser           = errors.New("movement: wrong user")
 	ErrorWrongCurrency       = errors.New("movement: wrong currency")
 	ErrorNoMovements         = errors.New("movement: there no movements")
+	ErrorSameUser            = errors.New("movement: sender and receiver are the same user")
+	ErrorSameCurrency        = errors.New("movement: source and target currencies are the same")
+	ErrorAmountTooSmall      = errors.New("movement: converted amount is too small")
+	ErrorInvalidAmount       = errors.New("movement: amount must be greater than zero")
+	ErrorInvalidPrecision    = errors.New("movement: amount has more decimal places than the currency allows")
+	ErrorInvalidCursor       = errors.New("movement: invalid cursor")
+	ErrorInvalidSort         = errors.New("movement: sort must be date or amount and direction asc or desc")
+	ErrorWalletFrozen        = errors.New("movement: wallet is frozen")
+	ErrorReasonRequired      = errors.New("movement: adjustments need a reason")
 )
 
-type AccountExtract map[string]float64
+type AccountExtract map[string]decimal.Decimal
 
 type Repository interface {
-	Save(ctx context.Context, movement Movement) (int64, error)
+	Save(ctx context.Context, movement Movement) (Movement, error)
 	InitSave(ctx context.Context, movement Movement) error
 	GetAccountExtract(ctx context.Context, id int64) (AccountExtract, error)
-	Search(ctx context.Context, userID int64, limit, offset uint64, movType, currencyName string) ([]Row, error)
+	Search(ctx context.Context, filter Filter) (Page, error)
+	Transfer(ctx context.Context, transfer Transfer) (Transfer, error)
+	Exchange(ctx context.Context, exchange Exchange) (Exchange, error)
+	Adjust(ctx context.Context, adjustment Adjustment) (Adjustment, error)
 }
 
 type Movement struct {
-	ID           int64   `json:"id"`
-	Type         string  `json:"type" binding:"required,oneof=deposit extract"`
-	Amount       float64 `json:"amount" binding:"required,gte=0"`
-	CurrencyName string  `json:"currencyname" binding:"required,oneof=usdt btc ars"`
-	UserID       int64   `json:"userid" binding:"required"`
-	TotalAmount  float64 `json:"totalamount"`
+	ID           int64           `json:"id"`
+	Type         string          `json:"type" binding:"required,oneof=deposit extract"`
+	Amount       decimal.Decimal `json:"amount"`
+	CurrencyName string          `json:"currencyname" binding:"required,currency"`
+	UserID       int64           `json:"userid" binding:"required"`
+	TotalAmount  decimal.Decimal `json:"totalamount"`
+	ExchangeID   int64           `json:"-"`
+	ActorID      int64           `json:"-"`
+	Reason       string          `json:"-"`
 }
 
-type Currency struct {
-	ID     int64
-	Name   string
-	Digits float64
+// Balance is the balance of a user in a currency
+type Balance struct {
+	UserID       int64           `json:"userid"`
+	CurrencyName string          `json:"currencyname"`
+	Amount       decimal.Decimal `json:"amount"`
+}
+
+// BalanceBefore returns the balance a saved movement was applied to, the total it left minus its effect
+func (m Movement) BalanceBefore() Balance {
+	balance := Balance{UserID: m.UserID, CurrencyName: m.CurrencyName, Amount: m.TotalAmount.Sub(m.Amount)}
+	switch m.Type {
+	case ExtractMov, TransferOutMov, ExchangeOutMov, AdjustmentOutMov:
+		balance.Amount = m.TotalAmount.Add(m.Amount)
+	}
+
+	return balance
+}
+
+// Transfer moves an amount of a currency from one user to another. The receiver is
+// addressed either by its id or by its alias.
+type Transfer struct {
+	FromUserID       int64           `json:"fromuserid" binding:"required"`
+	ToUserID         int64           `json:"touserid" binding:"required_without=ToAlias,excluded_with=ToAlias"`
+	ToAlias          string          `json:"toalias" binding:"required_without=ToUserID,excluded_with=ToUserID"`
+	Amount           decimal.Decimal `json:"amount"`
+	CurrencyName     string          `json:"currencyname" binding:"required,currency"`
+	DebitMovementID  int64           `json:"debitmovementid"`
+	CreditMovementID int64           `json:"creditmovementid"`
+}
+
+// Exchange converts an amount of one currency into another for the same user. Both legs are
+// linked to the exchange, which records the rate used.
+type Exchange struct {
+	ID               int64           `json:"id"`
+	UserID           int64           `json:"userid" binding:"required"`
+	FromCurrencyName string          `json:"fromcurrencyname" binding:"required,currency"`
+	ToCurrencyName   string          `json:"tocurrencyname" binding:"required,currency"`
+	Amount           decimal.Decimal `json:"amount"`
+	Rate             decimal.Decimal `json:"rate"`
+	ConvertedAmount  decimal.Decimal `json:"convertedamount"`
+	DebitMovementID  int64           `json:"debitmovementid"`
+	CreditMovementID int64           `json:"creditmovementid"`
+}
+
+// Adjustment is a manual correction of a balance made by an admin, the actor. It is the only movement allowed
+// on a frozen wallet
+type Adjustment struct {
+	ID           int64           `json:"id"`
+	Type         string          `json:"type" binding:"required,oneof=adjustment_in adjustment_out"`
+	Amount       decimal.Decimal `json:"amount"`
+	CurrencyName string          `json:"currencyname" binding:"required,currency"`
+	UserID       int64           `json:"userid" binding:"required"`
+	Reason       string          `json:"reason" binding:"required,max=255"`
+	ActorID      int64           `json:"actorid"`
 }
 
 type Row struct {
+	ID           int64
 	CurrencyName string
 	Type         string
 	DateCreated  time.Time
-	Amount       float64
-	TotalAmount  float64
+	Amount       decimal.Decimal
+	TotalAmount  decimal.Decimal
+	ExchangeID   int64
 }
 
-func getCurrencyTable(currency string) string {
-	return movementTables[currency]
+// Filter selects the movements of a search. From is inclusive and To exclusive, the amount range is inclusive and
+// the zero values are not applied. The movements are sorted by date, newest first, unless Sort and Direction say
+// otherwise. A page starts after the movement of the Cursor returned by the previous page, or skipping Offset
+// movements when there is no cursor
+type Filter struct {
+	UserID       int64
+	Type         string
+	CurrencyName string
+	From         time.Time
+	To           time.Time
+	MinAmount    decimal.NullDecimal
+	MaxAmount    decimal.NullDecimal
+	Sort         string
+	Direction    string
+	Limit        uint64
+	Offset       uint64
+	Cursor       string
+}
+
+// order returns the sort and direction of the filter, applying the defaults
+func (f Filter) order() (string, string, error) {
+	sort, direction := f.Sort, f.Direction
+	if sort == "" {
+		sort = SortByDate
+	}
+
+	if direction == "" {
+		direction = SortDesc
+	}
+
+	if (sort != SortByDate && sort != SortByAmount) || (direction != SortAsc && direction != SortDesc) {
+		return "", "", ErrorInvalidSort
+	}
+
+	return sort, direction, nil
 }
 
-func getCurrenciesTables(currency string) []string {
-	var tables = make([]string, 0)
+// Page is a page of the movements of a search in the order of the filter. Total counts the movements matching
+// the filters in all the pages, and is only counted on the pages without a cursor. NextCursor is the cursor of the
+// next page, empty on the last one
+type Page struct {
+	Items      []Row  `json:"items"`
+	Total      int64  `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor"`
+}
 
-	if movementTables[currency] == "" {
-		for _, v := range movementTables {
-			tables = append(tables, v)
-		}
-	} else {
-		tables = append(tables, movementTables[currency])
+// ValidateAmount checks the amount is positive and has no more decimal places than the currency stores
+func ValidateAmount(currency currency.Currency, amount decimal.Decimal) error {
+	if !amount.IsPositive() {
+		return ErrorInvalidAmount
 	}
 
-	return tables
+	if !amount.Equal(amount.Round(currency.Digits)) {
+		return ErrorInvalidPrecision
+	}
+
+	return nil
+}
+
+// ConvertAmount applies the rate to the amount, truncating the result to the decimal places of the target
+// currency so an exchange never credits more than the exact conversion
+func ConvertAmount(amount, rate decimal.Decimal, currency currency.Currency) decimal.Decimal {
+	return amount.Mul(rate).Truncate(currency.Digits)
 }
@@ -0,0 +1,77 @@
+package movement
+
+import "strings"
+
+// query builds a select statement over a table. The values of the conditions, the limit and the offset are always
+// bound parameters; the table, columns, conditions and order are written by the repository and must never come
+// from the request.
+type query struct {
+	table      string
+	conditions []string
+	args       []interface{}
+	order      []string
+	limit      uint64
+	offset     uint64
+}
+
+func newQuery(table string) *query {
+	return &query{table: table}
+}
+
+// where adds a condition joined with AND, with the values of its placeholders
+func (q *query) where(condition string, args ...interface{}) *query {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, args...)
+	return q
+}
+
+// orderBy sets the columns, with their direction, the rows are sorted by
+func (q *query) orderBy(columns ...string) *query {
+	q.order = columns
+	return q
+}
+
+// page limits the rows returned, a zero limit returns all of them after the offset
+func (q *query) page(limit, offset uint64) *query {
+	q.limit, q.offset = limit, offset
+	return q
+}
+
+// count returns the statement that counts the rows matching the conditions
+func (q *query) count() (string, []interface{}) {
+	return "SELECT COUNT(*) FROM " + q.table + q.whereClause() + ";", q.args
+}
+
+// selectColumns returns the statement that reads the columns of the rows matching the conditions, sorted and paged
+func (q *query) selectColumns(columns ...string) (string, []interface{}) {
+	var sql strings.Builder
+	var args = append([]interface{}(nil), q.args...)
+	sql.WriteString("SELECT " + strings.Join(columns, ", ") + " FROM " + q.table + q.whereClause())
+	if len(q.order) > 0 {
+		sql.WriteString(" ORDER BY " + strings.Join(q.order, ", "))
+	}
+
+	switch {
+	case q.limit > 0:
+		sql.WriteString(" LIMIT ?")
+		args = append(args, q.limit)
+	case q.offset > 0:
+		// MySQL has no OFFSET without a LIMIT, the largest one reads all the rows after the offset
+		sql.WriteString(" LIMIT 18446744073709551615")
+	}
+
+	if q.offset > 0 {
+		sql.WriteString(" OFFSET ?")
+		args = append(args, q.offset)
+	}
+
+	return sql.String() + ";", args
+}
+
+func (q *query) whereClause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
@@ -0,0 +1,53 @@
+package movement
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery_Count(t *testing.T) {
+	sql, args := newQuery("movements").where("user_id = ?", int64(1)).where("mov_type = ?", DepositMov).
+		orderBy("id DESC").page(10, 20).count()
+
+	require.Equal(t, "SELECT COUNT(*) FROM movements WHERE user_id = ? AND mov_type = ?;", sql)
+	require.Equal(t, []interface{}{int64(1), DepositMov}, args)
+}
+
+func TestQuery_SelectColumns(t *testing.T) {
+	tt := []struct {
+		TestName     string
+		Query        *query
+		ExpectedSQL  string
+		ExpectedArgs []interface{}
+	}{
+		{"NoConditions", newQuery("movements"), "SELECT id, mov_type FROM movements;", nil},
+		{"Conditions", newQuery("movements").where("user_id = ?", int64(1)).where("(id < ? OR id = ?)", int64(5), int64(6)),
+			"SELECT id, mov_type FROM movements WHERE user_id = ? AND (id < ? OR id = ?);", []interface{}{int64(1), int64(5), int64(6)}},
+		{"Order", newQuery("movements").orderBy("date_created DESC", "id DESC"),
+			"SELECT id, mov_type FROM movements ORDER BY date_created DESC, id DESC;", nil},
+		{"Limit", newQuery("movements").where("user_id = ?", int64(1)).page(10, 0),
+			"SELECT id, mov_type FROM movements WHERE user_id = ? LIMIT ?;", []interface{}{int64(1), uint64(10)}},
+		{"LimitOffset", newQuery("movements").page(10, 20),
+			"SELECT id, mov_type FROM movements LIMIT ? OFFSET ?;", []interface{}{uint64(10), uint64(20)}},
+		{"OffsetWithoutLimit", newQuery("movements").page(0, 20),
+			"SELECT id, mov_type FROM movements LIMIT 18446744073709551615 OFFSET ?;", []interface{}{uint64(20)}},
+	}
+
+	for _, tc := range tt {
+		sql, args := tc.Query.selectColumns("id", "mov_type")
+
+		require.Equal(t, tc.ExpectedSQL, sql, tc.TestName)
+		require.Equal(t, tc.ExpectedArgs, args, tc.TestName)
+	}
+}
+
+func TestQuery_SelectDoesNotChangeConditions(t *testing.T) {
+	q := newQuery("movements").where("user_id = ?", int64(1)).page(10, 0)
+
+	_, _ = q.selectColumns("id")
+	sql, args := q.count()
+
+	require.Equal(t, "SELECT COUNT(*) FROM movements WHERE user_id = ?;", sql)
+	require.Equal(t, []interface{}{int64(1)}, args)
+}
@@ -4,127 +4,366 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 
-	"github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
 )
 
 type repository struct {
-	db *sql.DB
+	db         *sql.DB
+	currencies *currency.Registry
+	logger     *slog.Logger
+	now        func() time.Time
 }
 
-func New(db *sql.DB) *repository {
-	return &repository{db: db}
+func New(db *sql.DB, currencies *currency.Registry, logger *slog.Logger) *repository {
+	return &repository{db: db, currencies: currencies, logger: logger, now: time.Now}
 }
 
-// Save inserts a new movement in the database
-func (r repository) Save(ctx context.Context, movement Movement) (int64, error) {
-	var table string
-	if table = getCurrencyTable(movement.CurrencyName); table == "" {
-		return 0, ErrorWrongCurrency
+// Save inserts a new movement in the database updating the user balance, and returns it with its id and the
+// resulting balance as its total
+func (r repository) Save(ctx context.Context, movement Movement) (Movement, error) {
+	if _, err := r.currencies.Get(movement.CurrencyName); err != nil {
+		return Movement{}, ErrorWrongCurrency
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s(mov_type,currency_name,tx_amount,user_id)VALUES (?,?,?,?);", table)
-	result, err := r.db.ExecContext(ctx, query, movement.Type, movement.CurrencyName, movement.Amount, movement.UserID)
+	tx, err := txn.BeginTx(ctx, r.db)
 	if err != nil {
-		// when tx_amount - total_amount is less than 0
-		if err.(*mysql.MySQLError).Number == 1264 || err.(*mysql.MySQLError).Number == 1690 {
-			return 0, ErrorInsufficientBalance
-		}
-		// wrong type
-		if err.(*mysql.MySQLError).Number == 1265 {
-			return 0, ErrorWrongOperation
-		}
+		return Movement{}, dberror.Classify(err)
+	}
+	defer tx.Rollback()
+
+	saved, err := r.saveEntries(ctx, tx.Tx, movement)
+	if err != nil {
+		return Movement{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Movement{}, dberror.Classify(err)
+	}
+
+	return saved[0], nil
+}
+
+// Transfer debits the sender and credits the receiver in a single transaction
+func (r repository) Transfer(ctx context.Context, transfer Transfer) (Transfer, error) {
+	if _, err := r.currencies.Get(transfer.CurrencyName); err != nil {
+		return Transfer{}, ErrorWrongCurrency
+	}
 
-		if err.(*mysql.MySQLError).Number == 1048 {
-			return 0, ErrorWrongUser
+	tx, err := txn.BeginTx(ctx, r.db)
+	if err != nil {
+		return Transfer{}, dberror.Classify(err)
+	}
+	defer tx.Rollback()
+
+	saved, err := r.saveEntries(ctx, tx.Tx,
+		Movement{Type: TransferOutMov, Amount: transfer.Amount, CurrencyName: transfer.CurrencyName, UserID: transfer.FromUserID},
+		Movement{Type: TransferInMov, Amount: transfer.Amount, CurrencyName: transfer.CurrencyName, UserID: transfer.ToUserID})
+	if err != nil {
+		return Transfer{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Transfer{}, dberror.Classify(err)
+	}
+
+	transfer.DebitMovementID, transfer.CreditMovementID = saved[0].ID, saved[1].ID
+
+	return transfer, nil
+}
+
+// Exchange records the exchange and its debit and credit movements in a single transaction
+func (r repository) Exchange(ctx context.Context, exchange Exchange) (Exchange, error) {
+	for _, v := range []string{exchange.FromCurrencyName, exchange.ToCurrencyName} {
+		if _, err := r.currencies.Get(v); err != nil {
+			return Exchange{}, ErrorWrongCurrency
 		}
+	}
 
-		return 0, err
+	tx, err := txn.BeginTx(ctx, r.db)
+	if err != nil {
+		return Exchange{}, dberror.Classify(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO exchanges(user_id,from_currency,to_currency,from_amount,to_amount,rate)VALUES (?,?,?,?,?,?);",
+		exchange.UserID, exchange.FromCurrencyName, exchange.ToCurrencyName, exchange.Amount, exchange.ConvertedAmount, exchange.Rate)
+	if err != nil {
+		return Exchange{}, r.saveError(ctx, err)
+	}
+
+	if exchange.ID, err = result.LastInsertId(); err != nil {
+		return Exchange{}, err
+	}
+
+	saved, err := r.saveEntries(ctx, tx.Tx,
+		Movement{Type: ExchangeOutMov, Amount: exchange.Amount, CurrencyName: exchange.FromCurrencyName, UserID: exchange.UserID,
+			ExchangeID: exchange.ID},
+		Movement{Type: ExchangeInMov, Amount: exchange.ConvertedAmount, CurrencyName: exchange.ToCurrencyName, UserID: exchange.UserID,
+			ExchangeID: exchange.ID})
+	if err != nil {
+		return Exchange{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Exchange{}, dberror.Classify(err)
+	}
+
+	exchange.DebitMovementID, exchange.CreditMovementID = saved[0].ID, saved[1].ID
+
+	return exchange, nil
+}
+
+// Adjust saves an adjustment movement updating the user balance, even when the wallet is frozen
+func (r repository) Adjust(ctx context.Context, adjustment Adjustment) (Adjustment, error) {
+	if _, err := r.currencies.Get(adjustment.CurrencyName); err != nil {
+		return Adjustment{}, ErrorWrongCurrency
+	}
+
+	tx, err := txn.BeginTx(ctx, r.db)
+	if err != nil {
+		return Adjustment{}, dberror.Classify(err)
 	}
+	defer tx.Rollback()
 
-	movID, err := result.LastInsertId()
+	saved, err := r.saveEntries(ctx, tx.Tx, Movement{Type: adjustment.Type, Amount: adjustment.Amount, CurrencyName: adjustment.CurrencyName,
+		UserID: adjustment.UserID, ActorID: adjustment.ActorID, Reason: adjustment.Reason})
 	if err != nil {
-		return 0, err
+		return Adjustment{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Adjustment{}, dberror.Classify(err)
 	}
 
-	return movID, nil
+	adjustment.ID = saved[0].ID
+
+	return adjustment, nil
 }
 
-// InitSave saves initials movements for a new user
+// InitSave saves initials movements and balances for a new user
 func (r repository) InitSave(ctx context.Context, movement Movement) error {
-	tx, err := r.db.BeginTx(ctx, nil)
+	tx, err := txn.BeginTx(ctx, r.db)
 	if err != nil {
-		return err
+		return dberror.Classify(err)
 	}
 	defer tx.Rollback()
-	for _, v := range movementTables {
-		query := fmt.Sprintf("INSERT INTO %s(mov_type,tx_amount,total_amount,user_id)VALUES (?,?,?,?);", v)
+	dateCreated := r.now().UTC().Truncate(time.Second)
+	for _, v := range r.currencies.List() {
+		movement.CurrencyName = v.Name
+		// the init movement starts the chain of the balance
+		hash := chainHash("", movement, movement.TotalAmount, dateCreated)
+		if _, err = tx.ExecContext(ctx, "INSERT INTO balances(user_id,currency_name,amount,last_hash)VALUES (?,?,?,?);",
+			movement.UserID, v.Name, movement.TotalAmount, hash); err != nil {
+			return r.saveError(ctx, err)
+		}
 
-		if _, err = tx.ExecContext(ctx, query, movement.Type, movement.Amount, movement.TotalAmount, movement.UserID); err != nil {
-			return err
+		if _, err = tx.ExecContext(ctx, "INSERT INTO movements(mov_type,currency_name,tx_amount,total_amount,user_id,date_created,hash)"+
+			"VALUES (?,?,?,?,?,?,?);", movement.Type, v.Name, movement.Amount, movement.TotalAmount, movement.UserID,
+			dateCreated, hash); err != nil {
+			return r.saveError(ctx, err)
 		}
 	}
 
 	if err = tx.Commit(); err != nil {
-		return err
+		return dberror.Classify(err)
 	}
 
 	return nil
 }
 
-// GetAccountExtract given an id returns the last movements for each currency
+// GetAccountExtract given an id returns the balance for each currency, as seen by the transaction of the context if any
 func (r repository) GetAccountExtract(ctx context.Context, id int64) (AccountExtract, error) {
-	var accountExtract = make(AccountExtract, 0)
-	for k, v := range movementTables {
-		var queryResult struct {
-			totalAmount float64
-		}
+	rows, err := txn.Conn(ctx, r.db).QueryContext(ctx, "SELECT currency_name, amount FROM balances WHERE user_id = ?;", id)
+	if err != nil {
+		return AccountExtract{}, dberror.Classify(err)
+	}
+	defer rows.Close()
 
-		row := r.db.QueryRowContext(ctx, fmt.Sprintf("SELECT total_amount FROM %s WHERE date_created = (SELECT MAX(date_created) "+
-			"FROM %s WHERE user_id = ?)", v, v), id)
-		if err := row.Scan(&queryResult.totalAmount); err != nil {
+	var accountExtract = make(AccountExtract, 0)
+	for rows.Next() {
+		var currencyName string
+		var amount decimal.Decimal
+		if err = rows.Scan(&currencyName, &amount); err != nil {
 			return AccountExtract{}, err
 		}
+		accountExtract[currencyName] = amount
+	}
 
-		accountExtract[k] = queryResult.totalAmount
+	if err = rows.Err(); err != nil {
+		return AccountExtract{}, dberror.Classify(err)
 	}
 
 	return accountExtract, nil
 }
 
-// Search searches the movements for an user applying different filters
-func (r repository) Search(ctx context.Context, userID int64, limit, offset uint64, movType, currencyName string) ([]Row, error) {
-	var tables = getCurrenciesTables(currencyName)
-	var movements []Row
-	for _, v := range tables {
-		sqlQuery := fmt.Sprintf("SELECT mov_type, currency_name, date_created, tx_amount, total_amount "+
-			"FROM %s WHERE user_id = ?", v)
-		if movType != "" {
-			sqlQuery = fmt.Sprintf("%s AND mov_type = '%s'", sqlQuery, movType)
+// Search searches the movements for an user applying different filters. The movements of all the currencies
+// are sorted together and the page applies to the whole result. Pages after a cursor are read with the
+// (user_id, date_created, id) and (user_id, tx_amount, id) indexes, so they do not slow down nor shift when
+// new movements are saved
+func (r repository) Search(ctx context.Context, filter Filter) (Page, error) {
+	sort, direction, err := filter.order()
+	if err != nil {
+		return Page{}, err
+	}
+
+	var after cursor
+	if filter.Cursor != "" {
+		if after, err = decodeCursor(filter.Cursor, sort, direction); err != nil {
+			return Page{}, err
+		}
+	}
+
+	q, err := r.searchQuery(filter)
+	if err != nil {
+		return Page{}, err
+	}
+
+	// the movements are counted on the first page only, counting them again on every cursor page would scan the
+	// whole history the cursor avoids
+	var page = Page{Items: make([]Row, 0)}
+	if filter.Cursor == "" {
+		sqlQuery, args := q.count()
+		if err = r.db.QueryRowContext(ctx, sqlQuery, args...).Scan(&page.Total); err != nil {
+			return Page{}, dberror.Classify(err)
 		}
 
-		if limit > 0 {
-			sqlQuery = fmt.Sprintf("%s LIMIT %v OFFSET %v;", sqlQuery, limit, offset)
+		if page.Total == 0 {
+			return Page{}, ErrorNoMovements
 		}
+	}
+
+	column, operator := "date_created", "<"
+	if sort == SortByAmount {
+		column = "tx_amount"
+	}
+	if direction == SortAsc {
+		operator = ">"
+	}
+
+	// one more movement than the limit is read to know if there is a next page
+	var limit, offset uint64 = 0, filter.Offset
+	if filter.Limit > 0 {
+		limit = filter.Limit + 1
+	}
 
-		rows, err := r.db.QueryContext(ctx, sqlQuery, userID)
-		if err != nil || rows.Err() != nil {
-			return []Row{}, err
+	if filter.Cursor != "" {
+		var value interface{} = after.DateCreated
+		if sort == SortByAmount {
+			value = after.Amount
 		}
+		q.where(fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, operator), value, value, after.ID)
+		offset = 0
+	}
 
-		for rows.Next() {
-			var result Row
-			err = rows.Scan(&result.Type, &result.CurrencyName, &result.DateCreated, &result.Amount, &result.TotalAmount)
-			if err != nil {
-				return []Row{}, err
-			}
-			movements = append(movements, result)
+	order := strings.ToUpper(direction)
+	sqlQuery, args := q.orderBy(column+" "+order, "id "+order).page(limit, offset).
+		selectColumns("id", "mov_type", "currency_name", "date_created", "tx_amount", "total_amount", "exchange_id")
+	rows, err := r.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return Page{}, dberror.Classify(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result Row
+		var exchangeID sql.NullInt64
+		err = rows.Scan(&result.ID, &result.Type, &result.CurrencyName, &result.DateCreated, &result.Amount, &result.TotalAmount,
+			&exchangeID)
+		if err != nil {
+			return Page{}, err
 		}
+		result.ExchangeID = exchangeID.Int64
+		page.Items = append(page.Items, result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return Page{}, dberror.Classify(err)
 	}
 
-	if len(movements) == 0 {
-		return movements, ErrorNoMovements
+	if len(page.Items) == 0 {
+		return Page{}, ErrorNoMovements
+	}
+
+	if filter.Limit > 0 && uint64(len(page.Items)) > filter.Limit {
+		page.Items = page.Items[:filter.Limit]
+		page.NextCursor = encodeCursor(page.Items[len(page.Items)-1], sort, direction)
+	}
+
+	return page, nil
+}
+
+// searchQuery returns the query of the movements matching the filters, or ErrorWrongCurrency when the currency of
+// the filter is not supported
+func (r repository) searchQuery(filter Filter) (*query, error) {
+	q := newQuery("movements").where("user_id = ?", filter.UserID)
+	if filter.CurrencyName != "" {
+		currency, err := r.currencies.Get(filter.CurrencyName)
+		if err != nil {
+			return nil, ErrorWrongCurrency
+		}
+		q.where("currency_name = ?", currency.Name)
+	}
+
+	if filter.Type != "" {
+		q.where("mov_type = ?", filter.Type)
+	}
+
+	if !filter.From.IsZero() {
+		q.where("date_created >= ?", filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		q.where("date_created < ?", filter.To)
+	}
+
+	if filter.MinAmount.Valid {
+		q.where("tx_amount >= ?", filter.MinAmount.Decimal)
+	}
+
+	if filter.MaxAmount.Valid {
+		q.where("tx_amount <= ?", filter.MaxAmount.Decimal)
+	}
+
+	return q, nil
+}
+
+// saveError translates the errors raised by the movements constraints, and logs the ones it cannot translate. The
+// other classified errors, e.g. a deadlock, are returned classified so the handlers can answer them
+func (r repository) saveError(ctx context.Context, err error) error {
+	number, ok := dberror.Number(err)
+	if !ok {
+		r.logger.ErrorContext(ctx, "movement: save failed", "error", err)
+		return err
+	}
+
+	switch number {
+	// wrong type
+	case 1265:
+		return ErrorWrongOperation
+	// the user does not exist
+	case 1048:
+		return ErrorWrongUser
+	}
+
+	classified, ok := dberror.As(err)
+	if ok {
+		switch classified.Class {
+		// the amount columns are unsigned, so a negative total is out of range
+		case dberror.ErrorOutOfRange:
+			return ErrorInsufficientBalance
+		// the user does not exist
+		case dberror.ErrorForeignKey:
+			return ErrorWrongUser
+		}
 	}
 
-	return movements, nil
+	r.logger.ErrorContext(ctx, "movement: save failed", "error", err, "mysql_error", number)
+	return dberror.Classify(err)
 }
@@ -0,0 +1,205 @@
+//go:build integration
+// +build integration
+
+package movement
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests need a MySQL server with the wallet scheme loaded, e.g.
+// WALLET_TEST_DSN="root:rootroot@tcp(127.0.0.1:3306)/wallet?parseTime=true" go test -tags integration ./...
+
+func TestSave_ConcurrentExtracts_DoNotOverdraw(t *testing.T) {
+	// Given
+	db := openTestDB(t)
+	ctx := context.Background()
+	currencies, err := currency.Load(ctx, currency.New(db))
+	require.NoError(t, err)
+	repository := New(db, currencies, logging.Discard())
+	userID := createTestUser(t, db, repository)
+
+	_, err = repository.Save(ctx, Movement{Type: DepositMov, Amount: decimal.NewFromInt(10), CurrencyName: ARS, UserID: userID})
+	require.NoError(t, err)
+
+	// When
+	var succeeded, rejected int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repository.Save(ctx, Movement{Type: ExtractMov, Amount: decimal.NewFromInt(1), CurrencyName: ARS, UserID: userID})
+			switch err {
+			case nil:
+				atomic.AddInt64(&succeeded, 1)
+			case ErrorInsufficientBalance:
+				atomic.AddInt64(&rejected, 1)
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Then
+	require.Equal(t, int64(10), succeeded)
+	require.Equal(t, int64(40), rejected)
+
+	accountExtract, err := repository.GetAccountExtract(ctx, userID)
+	require.NoError(t, err)
+	require.True(t, accountExtract[ARS].IsZero())
+
+	var lastTotal decimal.Decimal
+	err = db.QueryRowContext(ctx, "SELECT total_amount FROM movements WHERE user_id = ? AND currency_name = 'ARS' ORDER BY id DESC LIMIT 1;", userID).
+		Scan(&lastTotal)
+	require.NoError(t, err)
+	require.True(t, lastTotal.IsZero())
+}
+
+func TestTransfer_ConcurrentOppositeTransfers_DoNotDeadlock(t *testing.T) {
+	// Given
+	db := openTestDB(t)
+	ctx := context.Background()
+	currencies, err := currency.Load(ctx, currency.New(db))
+	require.NoError(t, err)
+	repository := New(db, currencies, logging.Discard())
+	firstUserID := createTestUser(t, db, repository)
+	secondUserID := createTestUser(t, db, repository)
+
+	for _, v := range []int64{firstUserID, secondUserID} {
+		_, err := repository.Save(ctx, Movement{Type: DepositMov, Amount: decimal.NewFromInt(100), CurrencyName: USDT, UserID: v})
+		require.NoError(t, err)
+	}
+
+	// When
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		for _, v := range []Transfer{
+			{FromUserID: firstUserID, ToUserID: secondUserID, Amount: decimal.NewFromInt(1), CurrencyName: USDT},
+			{FromUserID: secondUserID, ToUserID: firstUserID, Amount: decimal.NewFromInt(1), CurrencyName: USDT},
+		} {
+			wg.Add(1)
+			go func(transfer Transfer) {
+				defer wg.Done()
+				if _, err := repository.Transfer(ctx, transfer); err != nil {
+					t.Error(err)
+				}
+			}(v)
+		}
+	}
+	wg.Wait()
+
+	// Then
+	for _, v := range []int64{firstUserID, secondUserID} {
+		accountExtract, err := repository.GetAccountExtract(ctx, v)
+		require.NoError(t, err)
+		require.True(t, decimal.NewFromInt(100).Equal(accountExtract[USDT]))
+	}
+}
+
+func TestExchange_ConcurrentExchanges_DoNotDeadlock(t *testing.T) {
+	// Given
+	db := openTestDB(t)
+	ctx := context.Background()
+	currencies, err := currency.Load(ctx, currency.New(db))
+	require.NoError(t, err)
+	repository := New(db, currencies, logging.Discard())
+	userID := createTestUser(t, db, repository)
+
+	_, err = repository.Save(ctx, Movement{Type: DepositMov, Amount: decimal.NewFromInt(100), CurrencyName: USDT, UserID: userID})
+	require.NoError(t, err)
+
+	// When
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repository.Exchange(ctx, Exchange{UserID: userID, FromCurrencyName: USDT, ToCurrencyName: ARS,
+				Amount: decimal.NewFromInt(1), ConvertedAmount: decimal.NewFromInt(100), Rate: decimal.NewFromInt(100)})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Then
+	accountExtract, err := repository.GetAccountExtract(ctx, userID)
+	require.NoError(t, err)
+	require.True(t, decimal.NewFromInt(80).Equal(accountExtract[USDT]))
+	require.True(t, decimal.NewFromInt(2000).Equal(accountExtract[ARS]))
+}
+
+func TestVerify_ConcurrentMovements_KeepTheChain(t *testing.T) {
+	// Given
+	db := openTestDB(t)
+	ctx := context.Background()
+	currencies, err := currency.Load(ctx, currency.New(db))
+	require.NoError(t, err)
+	repository := New(db, currencies, logging.Discard())
+	userID := createTestUser(t, db, repository)
+
+	// When
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repository.Save(ctx, Movement{Type: DepositMov, Amount: decimal.RequireFromString("1.25"), CurrencyName: ARS,
+				UserID: userID})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Then
+	report, err := repository.Verify(ctx)
+	require.NoError(t, err)
+	for _, v := range report.Issues {
+		require.NotEqual(t, userID, v.UserID, v.Problem)
+	}
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("WALLET_TEST_DSN")
+	if dsn == "" {
+		t.Skip("WALLET_TEST_DSN is not set")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func createTestUser(t *testing.T, db *sql.DB, repository *repository) int64 {
+	alias := fmt.Sprintf("ledger-%d", time.Now().UnixNano())
+	result, err := db.Exec("INSERT INTO users(first_name,last_name,alias,email)VALUES (?,?,?,?);",
+		"ledger", "test", alias, alias+"@test.com")
+	require.NoError(t, err)
+
+	userID, err := result.LastInsertId()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = ?;", userID) })
+
+	require.NoError(t, repository.InitSave(context.Background(), Movement{Type: "init", UserID: userID}))
+
+	return userID
+}
@@ -1,80 +1,234 @@
 package movement
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/spolia/lemon-wallet/internal/requestid"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
 	"github.com/stretchr/testify/require"
 )
 
+const (
+	ARS  = "ARS"
+	BTC  = "BTC"
+	USDT = "USDT"
+)
+
+const (
+	selectBalance  = "SELECT b.amount, b.last_hash, u.frozen FROM balances b JOIN users u ON u.id = b.user_id WHERE b.user_id = ? AND b.currency_name = ? FOR UPDATE OF b FOR SHARE OF u;"
+	updateBalance  = "UPDATE balances SET amount = ?, last_hash = ? WHERE user_id = ? AND currency_name = ?;"
+	insertMovement = "INSERT INTO movements(mov_type,currency_name,tx_amount,total_amount,user_id,exchange_id,actor_id,reason,date_created,hash)VALUES (?,?,?,?,?,?,?,?,?,?);"
+)
+
+var searchColumns = []string{"id", "mov_type", "currency_name", "date_created", "tx_amount", "total_amount", "exchange_id"}
+
+var testCurrencies = currency.MustNewRegistry([]currency.Currency{
+	{ID: 1, Name: ARS, Digits: 2},
+	{ID: 2, Name: BTC, Digits: 8},
+	{ID: 3, Name: USDT, Digits: 2},
+})
+
 func TestSaveMovement_ok(t *testing.T) {
 	// Given
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		require.NoError(t, err)
 	}
-	repository := New(db)
+	repository := New(db, testCurrencies, logging.Discard())
 	defer db.Close()
 
 	movement := Movement{
 		Type:         DepositMov,
-		Amount:       100.2,
+		Amount:       decimal.RequireFromString("100.2"),
 		CurrencyName: USDT,
 		UserID:       1,
 	}
 	// When
-	query := "INSERT INTO movements_usdt(mov_type,currency_name,tx_amount,user_id)VALUES (?,?,?,?);"
-	mock.ExpectExec(query).
-		WithArgs(movement.Type, movement.CurrencyName, movement.Amount, movement.UserID).
+	mock.ExpectBegin()
+	expectBalance(mock, movement.UserID, movement.CurrencyName, "50")
+	mock.ExpectExec(updateBalance).
+		WithArgs(decimal.RequireFromString("150.2"), sqlmock.AnyArg(), movement.UserID, movement.CurrencyName).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertMovement).
+		WithArgs(movement.Type, movement.CurrencyName, movement.Amount, decimal.RequireFromString("150.2"), movement.UserID, nil, nil, nil,
+			sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	// then
-	movementID, err := repository.Save(context.Background(), movement)
+	saved, err := repository.Save(context.Background(), movement)
 	require.NoError(t, err)
-	require.Equal(t, int64(1), movementID)
+	require.Equal(t, int64(1), saved.ID)
+	require.Equal(t, "150.2", saved.TotalAmount.String())
+	require.Equal(t, "50", saved.BalanceBefore().Amount.String())
+	require.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestSaveMovement_Error(t *testing.T) {
+func TestSaveMovement_ChainsHash(t *testing.T) {
 	// Given
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		require.NoError(t, err)
 	}
-	repository := New(db)
+	repository := New(db, testCurrencies, logging.Discard())
 	defer db.Close()
 
-	movement := Movement{
+	dateCreated := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	repository.now = func() time.Time { return dateCreated.Add(300 * time.Millisecond) }
+	movement := Movement{Type: DepositMov, Amount: decimal.RequireFromString("100.2"), CurrencyName: USDT, UserID: 1}
+	hash := chainHash("previous", movement, decimal.RequireFromString("150.2"), dateCreated)
+	// When
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectBalance).WithArgs(int64(1), USDT).
+		WillReturnRows(sqlmock.NewRows([]string{"amount", "last_hash", "frozen"}).AddRow("50", "previous", false))
+	mock.ExpectExec(updateBalance).WithArgs(decimal.RequireFromString("150.2"), hash, int64(1), USDT).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertMovement).
+		WithArgs(DepositMov, USDT, movement.Amount, decimal.RequireFromString("150.2"), int64(1), nil, nil, nil, dateCreated, hash).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	// then
+	_, err = repository.Save(context.Background(), movement)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveMovement_ErrorWalletFrozen(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	// When
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectBalance).
+		WithArgs(int64(1), USDT).WillReturnRows(sqlmock.NewRows([]string{"amount", "last_hash", "frozen"}).AddRow("50", nil, true))
+	mock.ExpectRollback()
+
+	// then
+	saved, err := repository.Save(context.Background(), Movement{
 		Type:         DepositMov,
-		Amount:       100.2,
+		Amount:       decimal.RequireFromString("100.2"),
 		CurrencyName: USDT,
 		UserID:       1,
+	})
+	require.EqualError(t, err, ErrorWalletFrozen.Error())
+	require.Empty(t, saved)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdjust_FrozenWallet_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
 	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
 
+	adjustment := Adjustment{
+		Type:         AdjustmentOutMov,
+		Amount:       decimal.RequireFromString("20"),
+		CurrencyName: USDT,
+		UserID:       1,
+		Reason:       "duplicated deposit",
+		ActorID:      3,
+	}
 	// When
-	query := "INSERT INTO movements_usdt(mov_type,currency_name,tx_amount,user_id)VALUES (?,?,?,?);"
-	mock.ExpectExec(query).
-		WithArgs(movement.Type, movement.CurrencyName, movement.Amount, movement.UserID).WillReturnError(&mysql.MySQLError{
-		Number: 1264,
-	})
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectBalance).
+		WithArgs(adjustment.UserID, USDT).WillReturnRows(sqlmock.NewRows([]string{"amount", "last_hash", "frozen"}).AddRow("50", nil, true))
+	mock.ExpectExec(updateBalance).
+		WithArgs(decimal.RequireFromString("30"), sqlmock.AnyArg(), adjustment.UserID, USDT).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertMovement).
+		WithArgs(AdjustmentOutMov, USDT, adjustment.Amount, decimal.RequireFromString("30"), adjustment.UserID, nil, int64(3),
+			"duplicated deposit", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectCommit()
 
 	// then
-	movementID, err := repository.Save(context.Background(), movement)
+	result, err := repository.Adjust(context.Background(), adjustment)
+	require.NoError(t, err)
+	require.Equal(t, int64(9), result.ID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveMovement_ErrorInsufficientBalance(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	movement := Movement{
+		Type:         ExtractMov,
+		Amount:       decimal.RequireFromString("100.2"),
+		CurrencyName: USDT,
+		UserID:       1,
+	}
+
+	// When
+	mock.ExpectBegin()
+	expectBalance(mock, movement.UserID, movement.CurrencyName, "100.1")
+	mock.ExpectRollback()
+
+	// then
+	saved, err := repository.Save(context.Background(), movement)
 	require.Error(t, err)
 	require.EqualError(t, ErrorInsufficientBalance, err.Error())
-	require.Equal(t, int64(0), movementID)
+	require.Empty(t, saved)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveMovement_ErrorWrongUser(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	// When
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectBalance).
+		WithArgs(int64(1), USDT).WillReturnRows(sqlmock.NewRows([]string{"amount", "last_hash", "frozen"}))
+	mock.ExpectRollback()
+
+	// then
+	saved, err := repository.Save(context.Background(), Movement{
+		Type:         DepositMov,
+		Amount:       decimal.RequireFromString("100.2"),
+		CurrencyName: USDT,
+		UserID:       1,
+	})
+	require.EqualError(t, err, ErrorWrongUser.Error())
+	require.Empty(t, saved)
 }
 
 func TestSaveMovement_ErrorWrongCurrency(t *testing.T) {
 	// Given
-	repository := New(nil)
+	repository := New(nil, testCurrencies, logging.Discard())
 
 	// When
-	movementID, err := repository.Save(context.Background(), Movement{
+	saved, err := repository.Save(context.Background(), Movement{
 		Type:         DepositMov,
-		Amount:       100.2,
+		Amount:       decimal.RequireFromString("100.2"),
 		CurrencyName: "wrong",
 		UserID:       1,
 	})
@@ -82,7 +236,123 @@ func TestSaveMovement_ErrorWrongCurrency(t *testing.T) {
 	// Then
 	require.Error(t, err)
 	require.EqualError(t, ErrorWrongCurrency, err.Error())
-	require.Equal(t, int64(0), movementID)
+	require.Empty(t, saved)
+}
+
+func TestSaveMovement_LogsDatabaseError(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	var out bytes.Buffer
+	logger, err := logging.New(&out, "info")
+	require.NoError(t, err)
+	repository := New(db, testCurrencies, logger)
+	defer db.Close()
+
+	movement := Movement{
+		Type:         DepositMov,
+		Amount:       decimal.RequireFromString("100.2"),
+		CurrencyName: USDT,
+		UserID:       1,
+	}
+
+	// When
+	mock.ExpectBegin()
+	expectBalance(mock, movement.UserID, movement.CurrencyName, "50")
+	mock.ExpectExec(updateBalance).
+		WithArgs(decimal.RequireFromString("150.2"), sqlmock.AnyArg(), movement.UserID, movement.CurrencyName).
+		WillReturnError(&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"})
+	mock.ExpectRollback()
+
+	// then
+	_, err = repository.Save(requestid.NewContext(context.Background(), "req-1"), movement)
+	require.True(t, errors.Is(err, dberror.ErrorTimeout))
+	require.Contains(t, out.String(), `"request_id":"req-1"`)
+	require.Contains(t, out.String(), `"mysql_error":1205`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_ClassifiesDatabaseErrors(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	deposit := Movement{Type: DepositMov, Amount: decimal.RequireFromString("10"), CurrencyName: USDT, UserID: 1}
+	tt := []struct {
+		TestName string
+		Expect   func(mock sqlmock.Sqlmock)
+		Call     func(repository *repository) error
+	}{
+		{"SaveLock", func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(selectBalance).WithArgs(int64(1), USDT).WillReturnError(deadlock)
+			mock.ExpectRollback()
+		}, func(repository *repository) error {
+			_, err := repository.Save(context.Background(), deposit)
+			return err
+		}},
+		{"SaveCommit", func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectBalance(mock, 1, USDT, "50")
+			mock.ExpectExec(updateBalance).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(insertMovement).WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit().WillReturnError(deadlock)
+		}, func(repository *repository) error {
+			_, err := repository.Save(context.Background(), deposit)
+			return err
+		}},
+		{"TransferLock", func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(selectBalance).WithArgs(int64(1), USDT).WillReturnError(deadlock)
+			mock.ExpectRollback()
+		}, func(repository *repository) error {
+			_, err := repository.Transfer(context.Background(), Transfer{FromUserID: 1, ToUserID: 2, Amount: deposit.Amount,
+				CurrencyName: USDT})
+			return err
+		}},
+		{"ExchangeLock", func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			mock.ExpectExec("INSERT INTO exchanges(user_id,from_currency,to_currency,from_amount,to_amount,rate)VALUES (?,?,?,?,?,?);").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectQuery(selectBalance).WithArgs(int64(1), ARS).WillReturnError(deadlock)
+			mock.ExpectRollback()
+		}, func(repository *repository) error {
+			_, err := repository.Exchange(context.Background(), Exchange{UserID: 1, FromCurrencyName: USDT, ToCurrencyName: ARS,
+				Amount: deposit.Amount, ConvertedAmount: deposit.Amount, Rate: decimal.NewFromInt(1)})
+			return err
+		}},
+		{"AdjustLock", func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(selectBalance).WithArgs(int64(1), USDT).WillReturnError(deadlock)
+			mock.ExpectRollback()
+		}, func(repository *repository) error {
+			_, err := repository.Adjust(context.Background(), Adjustment{Type: AdjustmentInMov, Amount: deposit.Amount,
+				CurrencyName: USDT, UserID: 1, ActorID: 2, Reason: "fix"})
+			return err
+		}},
+		{"InitSaveInsert", func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			mock.ExpectExec("INSERT INTO balances(user_id,currency_name,amount,last_hash)VALUES (?,?,?,?);").WillReturnError(deadlock)
+			mock.ExpectRollback()
+		}, func(repository *repository) error {
+			return repository.InitSave(context.Background(), Movement{Type: InitMov, UserID: 1})
+		}},
+	}
+
+	for _, tc := range tt {
+		// Given
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		require.NoError(t, err)
+		repository := New(db, testCurrencies, logging.Discard())
+
+		// When
+		tc.Expect(mock)
+
+		// then
+		err = tc.Call(repository)
+		require.True(t, errors.Is(err, dberror.ErrorDeadlock), tc.TestName)
+		require.NoError(t, mock.ExpectationsWereMet(), tc.TestName)
+		db.Close()
+	}
 }
 
 func TestInitSave_ok(t *testing.T) {
@@ -91,33 +361,54 @@ func TestInitSave_ok(t *testing.T) {
 	if err != nil {
 		require.NoError(t, err)
 	}
-	repository := New(db)
+	repository := New(db, testCurrencies, logging.Discard())
 	defer db.Close()
 
 	movement := Movement{
-		Type:   DepositMov,
+		Type:   "init",
 		UserID: 1,
 	}
 	// When
 	mock.ExpectBegin()
 
-	mock.ExpectExec("INSERT INTO movements_usdt(mov_type,tx_amount,total_amount,user_id)VALUES (?,?,?,?);").
-		WithArgs(movement.Type, movement.Amount, movement.TotalAmount, movement.UserID).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
-	mock.ExpectExec("INSERT INTO movements_ars(mov_type,tx_amount,total_amount,user_id)VALUES (?,?,?,?);").
-		WithArgs(movement.Type, movement.Amount, movement.TotalAmount, movement.UserID).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	for _, v := range testCurrencies.List() {
+		mock.ExpectExec("INSERT INTO balances(user_id,currency_name,amount,last_hash)VALUES (?,?,?,?);").
+			WithArgs(movement.UserID, v.Name, movement.TotalAmount, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
 
-	mock.ExpectExec("INSERT INTO movements_btc(mov_type,tx_amount,total_amount,user_id)VALUES (?,?,?,?);").
-		WithArgs(movement.Type, movement.Amount, movement.TotalAmount, movement.UserID).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO movements(mov_type,currency_name,tx_amount,total_amount,user_id,date_created,hash)VALUES (?,?,?,?,?,?,?);").
+			WithArgs(movement.Type, v.Name, movement.Amount, movement.TotalAmount, movement.UserID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
 
 	mock.ExpectCommit()
 
 	// then
 	err = repository.InitSave(context.Background(), movement)
 	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAccountExtract_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT currency_name, amount FROM balances WHERE user_id = ?;").
+		WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"currency_name", "amount"}).
+		AddRow(ARS, "100.50").AddRow(BTC, "0.00000001").AddRow(USDT, "0.00"))
+
+	// then
+	accountExtract, err := repository.GetAccountExtract(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, "100.5", accountExtract[ARS].String())
+	require.Equal(t, "0.00000001", accountExtract[BTC].String())
+	require.True(t, accountExtract[USDT].IsZero())
 }
 
 func TestSearch_ok(t *testing.T) {
@@ -126,7 +417,7 @@ func TestSearch_ok(t *testing.T) {
 	if err != nil {
 		require.NoError(t, err)
 	}
-	repository := New(db)
+	repository := New(db, testCurrencies, logging.Discard())
 	defer db.Close()
 
 	movement := Movement{
@@ -135,14 +426,501 @@ func TestSearch_ok(t *testing.T) {
 		CurrencyName: ARS,
 	}
 	// When
+	mock.ExpectQuery("SELECT COUNT(*) FROM movements WHERE user_id = ? AND currency_name = ? AND mov_type = ?;").
+		WithArgs(movement.UserID, ARS, DepositMov).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("SELECT id, mov_type, currency_name, date_created, tx_amount, total_amount, exchange_id FROM movements "+
+		"WHERE user_id = ? AND currency_name = ? AND mov_type = ? ORDER BY date_created DESC, id DESC;").
+		WithArgs(movement.UserID, ARS, DepositMov).WillReturnRows(sqlmock.NewRows(searchColumns).
+		AddRow(2, "deposit", "ARS", time.Now(), 300, 2000, nil).
+		AddRow(1, "deposit", "ARS", time.Now(), 200, 1000, nil))
+
+	// then
+	page, err := repository.Search(context.Background(), Filter{UserID: movement.UserID, Type: movement.Type,
+		CurrencyName: movement.CurrencyName})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), page.Total)
+	require.Len(t, page.Items, 2)
+	require.Equal(t, int64(2), page.Items[0].ID)
+	require.Empty(t, page.NextCursor)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearch_AllCurrenciesPaginated(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT COUNT(*) FROM movements WHERE user_id = ?;").
+		WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+	mock.ExpectQuery("SELECT id, mov_type, currency_name, date_created, tx_amount, total_amount, exchange_id FROM movements "+
+		"WHERE user_id = ? ORDER BY date_created DESC, id DESC LIMIT ? OFFSET ?;").
+		WithArgs(int64(1), uint64(3), uint64(4)).WillReturnRows(sqlmock.NewRows(searchColumns).
+		AddRow(9, "exchange_in", "BTC", time.Now(), "0.001", "0.001", 3).
+		AddRow(8, "deposit", "ARS", time.Now(), 200, 1000, nil).
+		AddRow(7, "deposit", "ARS", time.Now(), 100, 800, nil))
+
+	// then
+	page, err := repository.Search(context.Background(), Filter{UserID: 1, Limit: 2, Offset: 4})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), page.Total)
+	require.Len(t, page.Items, 2)
+	require.Equal(t, BTC, page.Items[0].CurrencyName)
+	require.Equal(t, int64(3), page.Items[0].ExchangeID)
+	require.Equal(t, encodeCursor(page.Items[1], SortByDate, SortDesc), page.NextCursor)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearch_LastPage(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT COUNT(*) FROM movements WHERE user_id = ?;").
+		WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectQuery("SELECT id, mov_type, currency_name, date_created, tx_amount, total_amount, exchange_id FROM movements "+
+		"WHERE user_id = ? ORDER BY date_created DESC, id DESC LIMIT ? OFFSET ?;").
+		WithArgs(int64(1), uint64(3), uint64(4)).WillReturnRows(sqlmock.NewRows(searchColumns).
+		AddRow(1, "init", "ARS", time.Now(), 0, 0, nil))
+
+	// then
+	page, err := repository.Search(context.Background(), Filter{UserID: 1, Limit: 2, Offset: 4})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	require.Empty(t, page.NextCursor)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearch_AfterCursor(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	dateCreated := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	after := encodeCursor(Row{ID: 8, DateCreated: dateCreated}, SortByDate, SortDesc)
+
+	// When
+	mock.ExpectQuery("SELECT id, mov_type, currency_name, date_created, tx_amount, total_amount, exchange_id FROM movements "+
+		"WHERE user_id = ? AND (date_created < ? OR (date_created = ? AND id < ?)) ORDER BY date_created DESC, id DESC LIMIT ?;").
+		WithArgs(int64(1), dateCreated, dateCreated, int64(8), uint64(3)).WillReturnRows(sqlmock.NewRows(searchColumns).
+		AddRow(7, "deposit", "ARS", dateCreated, 100, 800, nil).
+		AddRow(5, "deposit", "ARS", dateCreated.Add(-time.Hour), 100, 700, nil))
+
+	// then
+	page, err := repository.Search(context.Background(), Filter{UserID: 1, Limit: 2, Offset: 4, Cursor: after})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	require.Equal(t, int64(7), page.Items[0].ID)
+	require.Zero(t, page.Total)
+	require.Empty(t, page.NextCursor)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearch_OffsetWithoutLimit(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT COUNT(*) FROM movements WHERE user_id = ?;").
+		WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(21))
+	mock.ExpectQuery("SELECT id, mov_type, currency_name, date_created, tx_amount, total_amount, exchange_id FROM movements "+
+		"WHERE user_id = ? ORDER BY date_created DESC, id DESC LIMIT 18446744073709551615 OFFSET ?;").
+		WithArgs(int64(1), uint64(20)).WillReturnRows(sqlmock.NewRows(searchColumns).
+		AddRow(1, "deposit", "ARS", time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC), 100, 100, nil))
+
+	// then
+	page, err := repository.Search(context.Background(), Filter{UserID: 1, Offset: 20})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearch_TypeIsBound(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	movType := "deposit' OR '1'='1"
+
+	// When
+	mock.ExpectQuery("SELECT COUNT(*) FROM movements WHERE user_id = ? AND mov_type = ?;").
+		WithArgs(int64(1), movType).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	// then
+	_, err = repository.Search(context.Background(), Filter{UserID: 1, Type: movType})
+	require.EqualError(t, err, ErrorNoMovements.Error())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearch_ErrorInvalidCursor(t *testing.T) {
+	// Given
+	repository := New(nil, testCurrencies, logging.Discard())
+
+	for _, v := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+		// When
+		_, err := repository.Search(context.Background(), Filter{UserID: 1, Cursor: v})
+
+		// Then
+		require.EqualError(t, err, ErrorInvalidCursor.Error(), v)
+	}
+}
+
+func TestSearch_ErrorWrongCurrency(t *testing.T) {
+	// Given
+	repository := New(nil, testCurrencies, logging.Discard())
+
+	// When
+	_, err := repository.Search(context.Background(), Filter{UserID: 1, CurrencyName: "eth"})
+
+	// Then
+	require.EqualError(t, err, ErrorWrongCurrency.Error())
+}
+
+func TestSearch_EmptyPageAfterCursor(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	dateCreated := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	after := encodeCursor(Row{ID: 8, DateCreated: dateCreated}, SortByDate, SortDesc)
+
+	// When
+	mock.ExpectQuery("SELECT id, mov_type, currency_name, date_created, tx_amount, total_amount, exchange_id FROM movements "+
+		"WHERE user_id = ? AND (date_created < ? OR (date_created = ? AND id < ?)) ORDER BY date_created DESC, id DESC;").
+		WithArgs(int64(1), dateCreated, dateCreated, int64(8)).WillReturnRows(sqlmock.NewRows(searchColumns))
+
+	// then
+	_, err = repository.Search(context.Background(), Filter{UserID: 1, Cursor: after})
+	require.EqualError(t, err, ErrorNoMovements.Error())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCursor_RoundTrip(t *testing.T) {
+	row := Row{ID: 42, DateCreated: time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC), Amount: decimal.RequireFromString("1000.50")}
+
+	result, err := decodeCursor(encodeCursor(row, SortByAmount, SortAsc), SortByAmount, SortAsc)
+
+	require.NoError(t, err)
+	require.Equal(t, int64(42), result.ID)
+	require.True(t, row.DateCreated.Equal(result.DateCreated))
+	require.True(t, row.Amount.Equal(result.Amount))
+}
+
+func TestCursor_OtherOrder(t *testing.T) {
+	token := encodeCursor(Row{ID: 42}, SortByAmount, SortAsc)
+
+	_, err := decodeCursor(token, SortByDate, SortDesc)
+
+	require.EqualError(t, err, ErrorInvalidCursor.Error())
+}
+
+func TestSearch_RangesSortedByAmount(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	from := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	minAmount := decimal.RequireFromString("1000")
+	maxAmount := decimal.RequireFromString("5000")
+	after := encodeCursor(Row{ID: 8, Amount: decimal.RequireFromString("1200")}, SortByAmount, SortAsc)
+	where := "WHERE user_id = ? AND currency_name = ? AND date_created >= ? AND date_created < ? AND tx_amount >= ? AND tx_amount <= ?"
+
+	// When
+	mock.ExpectQuery("SELECT id, mov_type, currency_name, date_created, tx_amount, total_amount, exchange_id FROM movements "+
+		where+" AND (tx_amount > ? OR (tx_amount = ? AND id > ?)) ORDER BY tx_amount ASC, id ASC LIMIT ?;").
+		WithArgs(int64(1), ARS, from, to, minAmount, maxAmount, decimal.RequireFromString("1200"),
+			decimal.RequireFromString("1200"), int64(8), uint64(2)).
+		WillReturnRows(sqlmock.NewRows(searchColumns).
+			AddRow(9, "extract", "ARS", from.Add(time.Hour), 1500, 100, nil).
+			AddRow(3, "extract", "ARS", from.Add(2*time.Hour), 3000, 100, nil))
+
+	// then
+	page, err := repository.Search(context.Background(), Filter{UserID: 1, CurrencyName: ARS, From: from, To: to,
+		MinAmount: decimal.NullDecimal{Decimal: minAmount, Valid: true}, MaxAmount: decimal.NullDecimal{Decimal: maxAmount, Valid: true},
+		Sort: SortByAmount, Direction: SortAsc, Limit: 1, Cursor: after})
+	require.NoError(t, err)
+	require.Zero(t, page.Total)
+	require.Len(t, page.Items, 1)
+	require.Equal(t, encodeCursor(page.Items[0], SortByAmount, SortAsc), page.NextCursor)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearch_ErrorInvalidSort(t *testing.T) {
+	// Given
+	repository := New(nil, testCurrencies, logging.Discard())
+
+	for _, v := range []Filter{{UserID: 1, Sort: "type"}, {UserID: 1, Direction: "up"}} {
+		// When
+		_, err := repository.Search(context.Background(), v)
+
+		// Then
+		require.EqualError(t, err, ErrorInvalidSort.Error())
+	}
+}
+
+func TestSearch_ErrorNoMovements(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT COUNT(*) FROM movements WHERE user_id = ?;").
+		WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	// then
+	_, err = repository.Search(context.Background(), Filter{UserID: 1})
+	require.EqualError(t, err, ErrorNoMovements.Error())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransfer_ErrorWrongCurrency(t *testing.T) {
+	// Given
+	repository := New(nil, testCurrencies, logging.Discard())
+
+	// When
+	result, err := repository.Transfer(context.Background(), Transfer{
+		FromUserID:   1,
+		ToUserID:     2,
+		Amount:       decimal.RequireFromString("100.2"),
+		CurrencyName: "wrong",
+	})
+
+	// Then
+	require.EqualError(t, err, ErrorWrongCurrency.Error())
+	require.Empty(t, result)
+}
+
+func TestConvertAmount(t *testing.T) {
+	btc := currency.Currency{Name: BTC, Digits: 8}
+	ars := currency.Currency{Name: ARS, Digits: 2}
+	require.Equal(t, "0.00499999", ConvertAmount(decimal.RequireFromString("100"), decimal.RequireFromString("0.0000499999999"), btc).String())
+	require.Equal(t, "3037.5", ConvertAmount(decimal.RequireFromString("10.125"), decimal.RequireFromString("300"), ars).String())
+}
+
+func TestTransfer_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	transfer := Transfer{
+		FromUserID:   2,
+		ToUserID:     1,
+		Amount:       decimal.RequireFromString("100.2"),
+		CurrencyName: ARS,
+	}
+	// When
+	mock.ExpectBegin()
+	// the receiver balance is locked first because it has the lowest id
+	expectBalance(mock, transfer.ToUserID, transfer.CurrencyName, "0")
+	mock.ExpectExec(updateBalance).WithArgs(decimal.RequireFromString("100.2"), sqlmock.AnyArg(), transfer.ToUserID, transfer.CurrencyName).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertMovement).WithArgs(TransferInMov, transfer.CurrencyName, transfer.Amount, decimal.RequireFromString("100.2"), transfer.ToUserID, nil, nil, nil,
+		sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(11, 1))
+	expectBalance(mock, transfer.FromUserID, transfer.CurrencyName, "200")
+	mock.ExpectExec(updateBalance).WithArgs(decimal.RequireFromString("99.8"), sqlmock.AnyArg(), transfer.FromUserID, transfer.CurrencyName).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertMovement).WithArgs(TransferOutMov, transfer.CurrencyName, transfer.Amount, decimal.RequireFromString("99.8"), transfer.FromUserID, nil, nil, nil,
+		sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectCommit()
 
-	mock.ExpectQuery("SELECT mov_type, currency_name, date_created, tx_amount, total_amount FROM movements_ars WHERE user_id = ? AND mov_type = 'deposit'").
-		WithArgs(movement.UserID).WillReturnRows(sqlmock.NewRows([]string{"mov_type", "currency_name", "date_created", "tx_amount", "total_amount"}).
-		AddRow("deposit", "ars", time.Now(), 200, 1000)).WillReturnRows(sqlmock.NewRows([]string{"mov_type", "currency_name", "date_created", "tx_amount", "total_amount"}).
-		AddRow("deposit", "ars", time.Now(), 300, 2000))
+	// then
+	result, err := repository.Transfer(context.Background(), transfer)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), result.DebitMovementID)
+	require.Equal(t, int64(11), result.CreditMovementID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransfer_ErrorInsufficientBalance(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	transfer := Transfer{
+		FromUserID:   1,
+		ToUserID:     2,
+		Amount:       decimal.RequireFromString("100.2"),
+		CurrencyName: ARS,
+	}
+	// When
+	mock.ExpectBegin()
+	expectBalance(mock, transfer.FromUserID, transfer.CurrencyName, "100")
+	mock.ExpectRollback()
 
 	// then
-	rows, err := repository.Search(context.Background(), movement.UserID, 0, 0, movement.Type, movement.CurrencyName)
+	result, err := repository.Transfer(context.Background(), transfer)
+	require.EqualError(t, err, ErrorInsufficientBalance.Error())
+	require.Empty(t, result)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExchange_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	exchange := Exchange{
+		UserID:           1,
+		FromCurrencyName: USDT,
+		ToCurrencyName:   ARS,
+		Amount:           decimal.RequireFromString("10"),
+		Rate:             decimal.RequireFromString("300"),
+		ConvertedAmount:  decimal.RequireFromString("3000"),
+	}
+	// When
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO exchanges(user_id,from_currency,to_currency,from_amount,to_amount,rate)VALUES (?,?,?,?,?,?);").
+		WithArgs(exchange.UserID, exchange.FromCurrencyName, exchange.ToCurrencyName, exchange.Amount, exchange.ConvertedAmount, exchange.Rate).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	// balances of the same user are locked ordered by currency
+	expectBalance(mock, exchange.UserID, ARS, "0")
+	mock.ExpectExec(updateBalance).WithArgs(decimal.RequireFromString("3000"), sqlmock.AnyArg(), exchange.UserID, ARS).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertMovement).
+		WithArgs(ExchangeInMov, exchange.ToCurrencyName, exchange.ConvertedAmount, decimal.RequireFromString("3000"), exchange.UserID, int64(5), nil, nil,
+			sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(11, 1))
+	expectBalance(mock, exchange.UserID, USDT, "10")
+	mock.ExpectExec(updateBalance).WithArgs(decimal.Zero, sqlmock.AnyArg(), exchange.UserID, USDT).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertMovement).
+		WithArgs(ExchangeOutMov, exchange.FromCurrencyName, exchange.Amount, decimal.Zero, exchange.UserID, int64(5), nil, nil,
+			sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectCommit()
+
+	// then
+	result, err := repository.Exchange(context.Background(), exchange)
 	require.NoError(t, err)
-	require.True(t, true, len(rows) > 0)
+	require.Equal(t, int64(5), result.ID)
+	require.Equal(t, int64(10), result.DebitMovementID)
+	require.Equal(t, int64(11), result.CreditMovementID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyMovement(t *testing.T) {
+	tt := []struct {
+		TestName                         string
+		Balance, Amount, ExpectedBalance string
+		Type, CurrencyName               string
+		ExpectedError                    error
+	}{
+		{"Deposit", "10", "0.1", "10.1", DepositMov, ARS, nil},
+		{"Extract", "10", "10", "0", ExtractMov, ARS, nil},
+		{"TransferIn", "0.1", "0.2", "0.3", TransferInMov, BTC, nil},
+		{"ExchangeOut", "1", "0.99999999", "0.00000001", ExchangeOutMov, BTC, nil},
+		{"InsufficientBalance", "10", "10.01", "0", TransferOutMov, ARS, ErrorInsufficientBalance},
+		{"WrongOperation", "10", "1", "0", "init", ARS, ErrorWrongOperation},
+	}
+
+	for _, tc := range tt {
+		balance, err := applyMovement(decimal.RequireFromString(tc.Balance), Movement{
+			Type:         tc.Type,
+			Amount:       decimal.RequireFromString(tc.Amount),
+			CurrencyName: tc.CurrencyName,
+		})
+		require.Equal(t, tc.ExpectedError, err, tc.TestName)
+		require.Equal(t, tc.ExpectedBalance, balance.String(), tc.TestName)
+	}
+}
+
+func TestValidateAmount(t *testing.T) {
+	tt := []struct {
+		TestName, CurrencyName, Amount string
+		ExpectedError                  error
+	}{
+		{"Ok", ARS, "100.50", nil},
+		{"OkTrailingZeros", USDT, "1.5000", nil},
+		{"OkBTC", BTC, "0.00000001", nil},
+		{"InvalidPrecision", ARS, "100.505", ErrorInvalidPrecision},
+		{"InvalidPrecisionBTC", BTC, "0.000000001", ErrorInvalidPrecision},
+		{"Zero", USDT, "0", ErrorInvalidAmount},
+		{"Negative", USDT, "-1", ErrorInvalidAmount},
+	}
+
+	for _, tc := range tt {
+		currency, err := testCurrencies.Get(tc.CurrencyName)
+		require.NoError(t, err)
+
+		err = ValidateAmount(currency, decimal.RequireFromString(tc.Amount))
+		require.Equal(t, tc.ExpectedError, err, tc.TestName)
+	}
+}
+
+func expectBalance(mock sqlmock.Sqlmock, userID int64, currencyName string, amount string) {
+	mock.ExpectQuery(selectBalance).
+		WithArgs(userID, currencyName).WillReturnRows(sqlmock.NewRows([]string{"amount", "last_hash", "frozen"}).AddRow(amount, nil, false))
+}
+
+func TestExchange_ErrorWrongUser(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	exchange := Exchange{
+		UserID:           1,
+		FromCurrencyName: USDT,
+		ToCurrencyName:   ARS,
+		Amount:           decimal.RequireFromString("10"),
+		Rate:             decimal.RequireFromString("300"),
+		ConvertedAmount:  decimal.RequireFromString("3000"),
+	}
+	// When
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO exchanges(user_id,from_currency,to_currency,from_amount,to_amount,rate)VALUES (?,?,?,?,?,?);").
+		WithArgs(exchange.UserID, exchange.FromCurrencyName, exchange.ToCurrencyName, exchange.Amount, exchange.ConvertedAmount, exchange.Rate).
+		WillReturnError(&mysql.MySQLError{Number: 1452})
+	mock.ExpectRollback()
+
+	// then
+	result, err := repository.Exchange(context.Background(), exchange)
+	require.EqualError(t, err, ErrorWrongUser.Error())
+	require.Empty(t, result)
 }
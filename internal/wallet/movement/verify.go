@@ -0,0 +1,169 @@
+package movement
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	ProblemBrokenHash      = "hash does not match the movement and the previous hash"
+	ProblemUnsealed        = "movement without hash after hashed movements"
+	ProblemWrongTotal      = "total does not follow from the previous total"
+	ProblemBalanceMismatch = "balance does not match the total of the last movement"
+	ProblemChainTip        = "last hash of the balance does not match the last movement"
+)
+
+// Issue is a problem found in the chain of movements of a user in a currency. MovementID is zero for the problems
+// of the balance
+type Issue struct {
+	UserID       int64
+	CurrencyName string
+	MovementID   int64
+	Problem      string
+}
+
+// Report is the outcome of a verification. Unsealed counts the movements saved before the chain was introduced,
+// whose totals are verified but which have no hash
+type Report struct {
+	Chains    int
+	Movements int
+	Unsealed  int
+	Issues    []Issue
+}
+
+type chainKey struct {
+	userID       int64
+	currencyName string
+}
+
+// chainTip is the state of a chain after its last movement
+type chainTip struct {
+	hash  string
+	total decimal.Decimal
+}
+
+// Verify walks the chain of movements of every balance checking each hash against the previous one and each total
+// against the previous total, and compares the last movement of each chain with its balance. It reads a consistent
+// snapshot, so it can run while movements are being saved
+func (r repository) Verify(ctx context.Context) (Report, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback()
+
+	var report Report
+	tips, err := verifyMovements(ctx, tx, &report)
+	if err != nil {
+		return Report{}, err
+	}
+
+	if err = verifyBalances(ctx, tx, tips, &report); err != nil {
+		return Report{}, err
+	}
+
+	return report, tx.Commit()
+}
+
+// verifyMovements checks the chains and returns their tips
+func verifyMovements(ctx context.Context, tx *sql.Tx, report *Report) (map[chainKey]chainTip, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id, user_id, currency_name, mov_type, tx_amount, total_amount, exchange_id, "+
+		"actor_id, reason, date_created, hash FROM movements ORDER BY user_id, currency_name, id;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tips = make(map[chainKey]chainTip)
+	var key chainKey
+	var tip chainTip
+	var sealed bool
+	for rows.Next() {
+		var id int64
+		var movement Movement
+		var total decimal.Decimal
+		var exchangeID, actorID sql.NullInt64
+		var reason, hash sql.NullString
+		var dateCreated time.Time
+		err = rows.Scan(&id, &movement.UserID, &movement.CurrencyName, &movement.Type, &movement.Amount, &total, &exchangeID,
+			&actorID, &reason, &dateCreated, &hash)
+		if err != nil {
+			return nil, err
+		}
+		movement.ExchangeID, movement.ActorID, movement.Reason = exchangeID.Int64, actorID.Int64, reason.String
+
+		if current := (chainKey{movement.UserID, movement.CurrencyName}); current != key || report.Movements == 0 {
+			key, tip, sealed = current, chainTip{}, false
+			report.Chains++
+		}
+		report.Movements++
+
+		issue := Issue{UserID: movement.UserID, CurrencyName: movement.CurrencyName, MovementID: id}
+		if movement.Type != InitMov {
+			if expected, err := applyMovement(tip.total, movement); err != nil || !expected.Equal(total) {
+				issue.Problem = ProblemWrongTotal
+				report.Issues = append(report.Issues, issue)
+			}
+		}
+
+		switch {
+		case hash.Valid:
+			if chainHash(tip.hash, movement, total, dateCreated) != hash.String {
+				issue.Problem = ProblemBrokenHash
+				report.Issues = append(report.Issues, issue)
+			}
+			sealed = true
+			tip.hash = hash.String
+		case sealed:
+			issue.Problem = ProblemUnsealed
+			report.Issues = append(report.Issues, issue)
+		default:
+			report.Unsealed++
+		}
+
+		// the chain goes on from the saved total, so a wrong total is reported once
+		tip.total = total
+		tips[key] = tip
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tips, nil
+}
+
+// verifyBalances compares the balances with the tips of their chains
+func verifyBalances(ctx context.Context, tx *sql.Tx, tips map[chainKey]chainTip, report *Report) error {
+	rows, err := tx.QueryContext(ctx, "SELECT user_id, currency_name, amount, last_hash FROM balances ORDER BY user_id, currency_name;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key chainKey
+		var amount decimal.Decimal
+		var lastHash sql.NullString
+		if err = rows.Scan(&key.userID, &key.currencyName, &amount, &lastHash); err != nil {
+			return err
+		}
+
+		tip := tips[key]
+		issue := Issue{UserID: key.userID, CurrencyName: key.currencyName}
+		if !amount.Equal(tip.total) {
+			issue.Problem = ProblemBalanceMismatch
+			report.Issues = append(report.Issues, issue)
+		}
+
+		if lastHash.String != tip.hash {
+			issue.Problem = ProblemChainTip
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+
+	return rows.Err()
+}
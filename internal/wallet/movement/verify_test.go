@@ -0,0 +1,146 @@
+package movement
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	selectChains   = "SELECT id, user_id, currency_name, mov_type, tx_amount, total_amount, exchange_id, actor_id, reason, date_created, hash FROM movements ORDER BY user_id, currency_name, id;"
+	selectBalances = "SELECT user_id, currency_name, amount, last_hash FROM balances ORDER BY user_id, currency_name;"
+)
+
+var (
+	chainColumns   = []string{"id", "user_id", "currency_name", "mov_type", "tx_amount", "total_amount", "exchange_id", "actor_id", "reason", "date_created", "hash"}
+	balanceColumns = []string{"user_id", "currency_name", "amount", "last_hash"}
+)
+
+// testChain is the chain of the ARS balance of the user 1: init, a deposit of 100 and an extract of 30
+func testChain() (*sqlmock.Rows, string) {
+	date := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	init := chainHash("", Movement{Type: InitMov, UserID: 1, CurrencyName: ARS}, decimal.Zero, date)
+	deposit := chainHash(init, Movement{Type: DepositMov, UserID: 1, CurrencyName: ARS, Amount: decimal.RequireFromString("100")},
+		decimal.RequireFromString("100"), date)
+	extract := chainHash(deposit, Movement{Type: ExtractMov, UserID: 1, CurrencyName: ARS, Amount: decimal.RequireFromString("30")},
+		decimal.RequireFromString("70"), date)
+
+	// the database returns the amounts with the scale of their columns
+	return sqlmock.NewRows(chainColumns).
+		AddRow(1, 1, ARS, InitMov, "0.00000000", "0.00000000", nil, nil, nil, date, init).
+		AddRow(2, 1, ARS, DepositMov, "100.00000000", "100.00000000", nil, nil, nil, date, deposit).
+		AddRow(3, 1, ARS, ExtractMov, "30.00000000", "70.00000000", nil, nil, nil, date, extract), extract
+}
+
+func TestVerify_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	chain, tip := testChain()
+	// When
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectChains).WillReturnRows(chain)
+	mock.ExpectQuery(selectBalances).WillReturnRows(sqlmock.NewRows(balanceColumns).AddRow(1, ARS, "70.00000000", tip))
+	mock.ExpectCommit()
+
+	// then
+	report, err := repository.Verify(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Report{Chains: 1, Movements: 3}, report)
+}
+
+func TestVerify_TamperedMovement(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	date := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	init := chainHash("", Movement{Type: InitMov, UserID: 1, CurrencyName: ARS}, decimal.Zero, date)
+	deposit := chainHash(init, Movement{Type: DepositMov, UserID: 1, CurrencyName: ARS, Amount: decimal.RequireFromString("100")},
+		decimal.RequireFromString("100"), date)
+	// When
+	mock.ExpectBegin()
+	// the deposit was edited to 1000 along with its total and the balance
+	mock.ExpectQuery(selectChains).WillReturnRows(sqlmock.NewRows(chainColumns).
+		AddRow(1, 1, ARS, InitMov, "0", "0", nil, nil, nil, date, init).
+		AddRow(2, 1, ARS, DepositMov, "1000", "1000", nil, nil, nil, date, deposit))
+	mock.ExpectQuery(selectBalances).WillReturnRows(sqlmock.NewRows(balanceColumns).AddRow(1, ARS, "1000", deposit))
+	mock.ExpectCommit()
+
+	// then
+	report, err := repository.Verify(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []Issue{{UserID: 1, CurrencyName: ARS, MovementID: 2, Problem: ProblemBrokenHash}}, report.Issues)
+}
+
+func TestVerify_WrongTotals(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	date := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	// When
+	mock.ExpectBegin()
+	// movements saved before the chain have no hash, their totals are still verified
+	mock.ExpectQuery(selectChains).WillReturnRows(sqlmock.NewRows(chainColumns).
+		AddRow(1, 1, ARS, InitMov, "0", "0", nil, nil, nil, date, nil).
+		AddRow(2, 1, ARS, DepositMov, "100", "90", nil, nil, nil, date, nil).
+		AddRow(3, 2, BTC, InitMov, "0", "0", nil, nil, nil, date, nil))
+	mock.ExpectQuery(selectBalances).WillReturnRows(sqlmock.NewRows(balanceColumns).
+		AddRow(1, ARS, "90", nil).
+		AddRow(2, BTC, "1", nil).
+		AddRow(2, USDT, "0", "hash"))
+	mock.ExpectCommit()
+
+	// then
+	report, err := repository.Verify(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Report{Chains: 2, Movements: 3, Unsealed: 3, Issues: []Issue{
+		{UserID: 1, CurrencyName: ARS, MovementID: 2, Problem: ProblemWrongTotal},
+		{UserID: 2, CurrencyName: BTC, Problem: ProblemBalanceMismatch},
+		{UserID: 2, CurrencyName: USDT, Problem: ProblemChainTip},
+	}}, report)
+}
+
+func TestVerify_UnsealedAfterSealed(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, testCurrencies, logging.Discard())
+	defer db.Close()
+
+	date := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	init := chainHash("", Movement{Type: InitMov, UserID: 1, CurrencyName: ARS}, decimal.Zero, date)
+	// When
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectChains).WillReturnRows(sqlmock.NewRows(chainColumns).
+		AddRow(1, 1, ARS, InitMov, "0", "0", nil, nil, nil, date, init).
+		AddRow(2, 1, ARS, DepositMov, "100", "100", nil, nil, nil, date, nil))
+	mock.ExpectQuery(selectBalances).WillReturnRows(sqlmock.NewRows(balanceColumns).AddRow(1, ARS, "100", init))
+	mock.ExpectCommit()
+
+	// then
+	report, err := repository.Verify(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []Issue{{UserID: 1, CurrencyName: ARS, MovementID: 2, Problem: ProblemUnsealed}}, report.Issues)
+}
@@ -0,0 +1,68 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	TypeUserCreated     = "UserCreated"
+	TypeMovementCreated = "MovementCreated"
+	TypeBalanceChanged  = "BalanceChanged"
+)
+
+type Repository interface {
+	Save(ctx context.Context, event Event) (int64, error)
+	LockPending(ctx context.Context, limit uint64) ([]Event, error)
+	MarkPublished(ctx context.Context, id int64) error
+}
+
+// Publisher delivers the events to the downstream consumers
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Event is a domain event of the wallet of a user. Payload is the JSON of the UserCreated, MovementCreated or
+// BalanceChanged of its type
+type Event struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	UserID      int64           `json:"userid"`
+	Payload     json.RawMessage `json:"payload"`
+	DateCreated time.Time       `json:"datecreated"`
+}
+
+type UserCreated struct {
+	UserID    int64  `json:"userid"`
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	Alias     string `json:"alias"`
+	Email     string `json:"email"`
+}
+
+type MovementCreated struct {
+	MovementID   int64           `json:"movementid"`
+	UserID       int64           `json:"userid"`
+	Type         string          `json:"type"`
+	CurrencyName string          `json:"currencyname"`
+	Amount       decimal.Decimal `json:"amount"`
+}
+
+type BalanceChanged struct {
+	UserID       int64           `json:"userid"`
+	CurrencyName string          `json:"currencyname"`
+	Amount       decimal.Decimal `json:"amount"`
+}
+
+// NewEvent returns the event of the payload
+func NewEvent(eventType string, userID int64, payload interface{}) (Event, error) {
+	content, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{Type: eventType, UserID: userID, Payload: content}, nil
+}
@@ -0,0 +1,65 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// writer publishes the events as JSON lines, e.g. to the standard output or a file
+type writer struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewWriterPublisher(w io.Writer) *writer {
+	return &writer{encoder: json.NewEncoder(w)}
+}
+
+// Publish writes the event in a line
+func (w *writer) Publish(ctx context.Context, event Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.encoder.Encode(event)
+}
+
+// Memory keeps the published events, for tests and local runs
+type Memory struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Publish keeps the event
+func (m *Memory) Publish(ctx context.Context, event Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+// Events returns the events published so far
+func (m *Memory) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Event(nil), m.events...)
+}
+
+// fanout publishes the events to several publishers in order
+type fanout []Publisher
+
+func NewFanout(publishers ...Publisher) fanout {
+	return publishers
+}
+
+// Publish publishes the event to each publisher, stopping at the first one that rejects it. The event is published
+// again to all of them when it is retried, so the publishers must tolerate duplicates
+func (f fanout) Publish(ctx context.Context, event Event) error {
+	for _, v := range f {
+		if err := v.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
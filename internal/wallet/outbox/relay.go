@@ -0,0 +1,81 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
+)
+
+// Relay publishes the events of the outbox in batches. An event is marked as published after the publisher accepts
+// it, so it is delivered at least once: it is published again when the relay stops before marking it. Several
+// relays can run at the same time, each one takes the events the others have not locked
+type Relay struct {
+	events     Repository
+	transactor txn.Transactor
+	publisher  Publisher
+	batchSize  uint64
+	interval   time.Duration
+	logger     *slog.Logger
+}
+
+func NewRelay(events Repository, transactor txn.Transactor, publisher Publisher, batchSize uint64, interval time.Duration,
+	logger *slog.Logger) *Relay {
+	return &Relay{events: events, transactor: transactor, publisher: publisher, batchSize: batchSize, interval: interval,
+		logger: logger}
+}
+
+// Run publishes the pending events every interval until the context is done. A full batch is followed by the next
+// one without waiting
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		published, err := r.RunOnce(ctx)
+		if err != nil {
+			r.logger.ErrorContext(ctx, "outbox relay failed", "error", err)
+		}
+
+		if err == nil && uint64(published) == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce publishes a batch of pending events and returns how many were published. It stops at the first event the
+// publisher rejects, keeping the events published before it
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	var published int
+	var publishErr error
+	err := r.transactor.Run(ctx, func(ctx context.Context) error {
+		events, err := r.events.LockPending(ctx, r.batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range events {
+			if publishErr = r.publisher.Publish(ctx, v); publishErr != nil {
+				break
+			}
+
+			if err = r.events.MarkPublished(ctx, v.ID); err != nil {
+				return err
+			}
+			published++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return published, publishErr
+}
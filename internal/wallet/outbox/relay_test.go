@@ -0,0 +1,107 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelay_RunOnce_PublishesAndMarks(t *testing.T) {
+	// Given
+	var events repositoryMock
+	events.On("LockPending", uint64(10)).Return([]Event{{ID: 1}, {ID: 2}}, nil).Once()
+	events.On("MarkPublished", mock.Anything).Return(nil)
+	var publisher Memory
+	relay := NewRelay(&events, transactorMock{}, &publisher, 10, time.Second, logging.Discard())
+
+	// When
+	published, err := relay.RunOnce(context.Background())
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, 2, published)
+	require.Equal(t, []Event{{ID: 1}, {ID: 2}}, publisher.Events())
+	events.AssertCalled(t, "MarkPublished", int64(1))
+	events.AssertCalled(t, "MarkPublished", int64(2))
+}
+
+func TestRelay_RunOnce_StopsAtRejectedEvent(t *testing.T) {
+	// Given
+	var events repositoryMock
+	events.On("LockPending", uint64(10)).Return([]Event{{ID: 1}, {ID: 2}, {ID: 3}}, nil).Once()
+	events.On("MarkPublished", int64(1)).Return(nil).Once()
+	relay := NewRelay(&events, transactorMock{}, &failingPublisher{failID: 2}, 10, time.Second, logging.Discard())
+
+	// When
+	published, err := relay.RunOnce(context.Background())
+
+	// Then
+	require.EqualError(t, err, "unavailable")
+	require.Equal(t, 1, published)
+	events.AssertNotCalled(t, "MarkPublished", int64(2))
+	events.AssertNotCalled(t, "MarkPublished", int64(3))
+}
+
+func TestWriterPublisher_WritesJSONLines(t *testing.T) {
+	// Given
+	var out bytes.Buffer
+	publisher := NewWriterPublisher(&out)
+	event, err := NewEvent(TypeUserCreated, 1, UserCreated{UserID: 1, Alias: "alias"})
+	require.NoError(t, err)
+
+	// When
+	require.NoError(t, publisher.Publish(context.Background(), event))
+	require.NoError(t, publisher.Publish(context.Background(), event))
+
+	// Then
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var decoded Event
+	require.NoError(t, json.Unmarshal(lines[0], &decoded))
+	require.Equal(t, TypeUserCreated, decoded.Type)
+	require.JSONEq(t, `{"userid":1,"firstname":"","lastname":"","alias":"alias","email":""}`, string(decoded.Payload))
+}
+
+type repositoryMock struct {
+	mock.Mock
+}
+
+func (r *repositoryMock) Save(ctx context.Context, event Event) (int64, error) {
+	args := r.Called(event)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (r *repositoryMock) LockPending(ctx context.Context, limit uint64) ([]Event, error) {
+	args := r.Called(limit)
+	return args.Get(0).([]Event), args.Error(1)
+}
+
+func (r *repositoryMock) MarkPublished(ctx context.Context, id int64) error {
+	args := r.Called(id)
+	return args.Error(0)
+}
+
+type transactorMock struct{}
+
+func (transactorMock) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// failingPublisher rejects the event with the failID
+type failingPublisher struct {
+	failID int64
+}
+
+func (f *failingPublisher) Publish(ctx context.Context, event Event) error {
+	if event.ID == f.failID {
+		return errors.New("unavailable")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *repository {
+	return &repository{db: db}
+}
+
+// Save adds an event to the outbox. It joins the transaction of the context, so the event is only published when
+// the change that raised it is committed
+func (r repository) Save(ctx context.Context, event Event) (int64, error) {
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, "INSERT INTO outbox(event_type,user_id,payload)VALUES (?,?,?);",
+		event.Type, event.UserID, string(event.Payload))
+	if err != nil {
+		return 0, dberror.Classify(err)
+	}
+
+	return result.LastInsertId()
+}
+
+// LockPending returns the oldest events not published yet, locked until the transaction of the context ends.
+// Events locked by another relay are skipped
+func (r repository) LockPending(ctx context.Context, limit uint64) ([]Event, error) {
+	rows, err := txn.Conn(ctx, r.db).QueryContext(ctx, "SELECT id, event_type, user_id, payload, date_created FROM outbox "+
+		"WHERE published_at IS NULL ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED;", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var payload []byte
+		if err = rows.Scan(&event.ID, &event.Type, &event.UserID, &payload, &event.DateCreated); err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// MarkPublished records that an event was published
+func (r repository) MarkPublished(ctx context.Context, id int64) error {
+	_, err := txn.Conn(ctx, r.db).ExecContext(ctx, "UPDATE outbox SET published_at = CURRENT_TIMESTAMP(6) WHERE id = ?;", id)
+	return err
+}
@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSave_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectExec("INSERT INTO outbox(event_type,user_id,payload)VALUES (?,?,?);").
+		WithArgs(TypeBalanceChanged, int64(1), `{"userid":1,"currencyname":"ARS","amount":"10.5"}`).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+
+	// then
+	id, err := repository.Save(context.Background(), Event{Type: TypeBalanceChanged, UserID: 1,
+		Payload: json.RawMessage(`{"userid":1,"currencyname":"ARS","amount":"10.5"}`)})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), id)
+}
+
+func TestLockPending_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	dateCreated := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	// When
+	mock.ExpectQuery("SELECT id, event_type, user_id, payload, date_created FROM outbox WHERE published_at IS NULL " +
+		"ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED;").
+		WithArgs(uint64(10)).WillReturnRows(sqlmock.NewRows([]string{"id", "event_type", "user_id", "payload", "date_created"}).
+		AddRow(7, TypeUserCreated, 1, `{"userid":1}`, dateCreated))
+
+	// then
+	events, err := repository.LockPending(context.Background(), 10)
+	require.NoError(t, err)
+	require.Equal(t, []Event{{ID: 7, Type: TypeUserCreated, UserID: 1, Payload: json.RawMessage(`{"userid":1}`),
+		DateCreated: dateCreated}}, events)
+}
+
+func TestMarkPublished_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectExec("UPDATE outbox SET published_at = CURRENT_TIMESTAMP(6) WHERE id = ?;").
+		WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// then
+	require.NoError(t, repository.MarkPublished(context.Background(), 7))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
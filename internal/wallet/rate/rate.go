@@ -0,0 +1,15 @@
+package rate
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrorRateNotFound = errors.New("rate: not found")
+
+// Provider returns how many units of the "to" currency are paid for one unit of the "from" currency.
+type Provider interface {
+	Rate(ctx context.Context, from, to string) (decimal.Decimal, error)
+}
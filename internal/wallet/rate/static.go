@@ -0,0 +1,62 @@
+package rate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// inverseDigits is the scale of the rates column, used when a rate is derived from the opposite pair
+const inverseDigits = 12
+
+type static struct {
+	rates map[string]decimal.Decimal
+}
+
+// NewStatic creates a Provider from a fixed set of rates keyed by pair, e.g. "BTC/USDT".
+// The inverse of every pair is derived, so only one direction needs to be configured.
+func NewStatic(rates map[string]decimal.Decimal) *static {
+	var pairs = make(map[string]decimal.Decimal, len(rates))
+	for k, v := range rates {
+		pairs[strings.ToUpper(k)] = v
+	}
+
+	return &static{rates: pairs}
+}
+
+// NewFromFile creates a static Provider reading the rates from a json file like {"BTC/USDT": 20000}
+func NewFromFile(path string) (*static, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rates map[string]decimal.Decimal
+	if err = json.Unmarshal(content, &rates); err != nil {
+		return nil, fmt.Errorf("rate: reading %s: %w", path, err)
+	}
+
+	return NewStatic(rates), nil
+}
+
+// Rate returns the configured rate for the pair or the inverse of the opposite pair
+func (s static) Rate(ctx context.Context, from, to string) (decimal.Decimal, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if rate, ok := s.rates[pair(from, to)]; ok && rate.IsPositive() {
+		return rate, nil
+	}
+
+	if rate, ok := s.rates[pair(to, from)]; ok && rate.IsPositive() {
+		return decimal.NewFromInt(1).DivRound(rate, inverseDigits), nil
+	}
+
+	return decimal.Decimal{}, ErrorRateNotFound
+}
+
+func pair(from, to string) string {
+	return from + "/" + to
+}
@@ -0,0 +1,67 @@
+package rate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatic_Rate_ok(t *testing.T) {
+	// Given
+	provider := NewStatic(map[string]decimal.Decimal{"BTC/USDT": decimal.NewFromInt(20000)})
+
+	// When
+	rate, err := provider.Rate(context.Background(), "btc", "usdt")
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, "20000", rate.String())
+}
+
+func TestStatic_Rate_Inverse(t *testing.T) {
+	// Given
+	provider := NewStatic(map[string]decimal.Decimal{"BTC/USDT": decimal.NewFromInt(20000)})
+
+	// When
+	rate, err := provider.Rate(context.Background(), "USDT", "BTC")
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, "0.00005", rate.String())
+}
+
+func TestStatic_Rate_NotFound(t *testing.T) {
+	// Given
+	provider := NewStatic(map[string]decimal.Decimal{"BTC/USDT": decimal.NewFromInt(20000)})
+
+	// When
+	rate, err := provider.Rate(context.Background(), "BTC", "ARS")
+
+	// Then
+	require.EqualError(t, err, ErrorRateNotFound.Error())
+	require.True(t, rate.IsZero())
+}
+
+func TestNewFromFile_ok(t *testing.T) {
+	// Given
+	provider, err := NewFromFile("testdata/rates.json")
+	require.NoError(t, err)
+
+	// When
+	rate, err := provider.Rate(context.Background(), "USDT", "ARS")
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, "300", rate.String())
+}
+
+func TestNewFromFile_Fail(t *testing.T) {
+	// When
+	provider, err := NewFromFile("testdata/missing.json")
+
+	// Then
+	require.Error(t, err)
+	require.Nil(t, provider)
+}
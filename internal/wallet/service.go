@@ -2,46 +2,164 @@ package wallet
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"net"
 	"strings"
+	"time"
 
+	"github.com/shopspring/decimal"
+	"github.com/spolia/lemon-wallet/internal/metrics"
+	"github.com/spolia/lemon-wallet/internal/requestid"
+	"github.com/spolia/lemon-wallet/internal/tracing"
+	"github.com/spolia/lemon-wallet/internal/wallet/audit"
+	"github.com/spolia/lemon-wallet/internal/wallet/auth"
+	"github.com/spolia/lemon-wallet/internal/wallet/broadcast"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
 	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+	"github.com/spolia/lemon-wallet/internal/wallet/outbox"
+	"github.com/spolia/lemon-wallet/internal/wallet/rate"
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
 	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/spolia/lemon-wallet/internal/wallet/webhook"
 )
 
+var (
+	ErrorExchangeUnavailable = errors.New("wallet: exchange rates unavailable")
+	ErrorAuditUnavailable    = errors.New("wallet: audit log unavailable")
+	ErrorWebhooksUnavailable = errors.New("wallet: webhooks unavailable")
+	ErrorAPIKeysUnavailable  = errors.New("wallet: api keys unavailable")
+	ErrorStreamUnavailable   = errors.New("wallet: streaming unavailable")
+)
+
+// pageSize is the default and maximum number of users, movements, audit events or webhook deliveries of a search page
+const pageSize = 50
+
 type Service struct {
 	userRepo     user.Repository
 	movementRepo movement.Repository
+	currencies   *currency.Registry
+	rates        rate.Provider
+	transactor   txn.Transactor
+	events       audit.Repository
+	outboxRepo   outbox.Repository
+	webhooks     webhook.Repository
+	apiKeys      auth.Repository
+	resolver     webhook.Resolver
+	broadcaster  *broadcast.Broadcaster
+	logger       *slog.Logger
+	operations   *metrics.Counter
+	latency      *metrics.Histogram
+	tracer       *tracing.Tracer
 }
 
-// New creates a Service implementation.
-func New(userRepo user.Repository, movRepo movement.Repository) *Service {
-	return &Service{userRepo: userRepo, movementRepo: movRepo}
+// Option configures optional dependencies of the Service
+type Option func(*Service)
+
+// WithRateProvider sets the provider used to quote exchanges
+func WithRateProvider(rates rate.Provider) Option {
+	return func(s *Service) {
+		s.rates = rates
+	}
 }
 
-// CreateUser saves a new user
-func (s *Service) CreateUser(ctx context.Context, name, lastName, alias, email string) (int64, error) {
-	userID, err := s.userRepo.Save(ctx, name, lastName, alias, email)
-	if err != nil {
-		println(err.Error())
-		return 0, err
+// WithAuditLog sets the repository the state-changing operations are recorded in
+func WithAuditLog(events audit.Repository) Option {
+	return func(s *Service) {
+		s.events = events
 	}
+}
+
+// WithOutbox sets the outbox the domain events are appended to, within the transaction of the operation
+func WithOutbox(outboxRepo outbox.Repository) Option {
+	return func(s *Service) {
+		s.outboxRepo = outboxRepo
+	}
+}
+
+// WithWebhooks sets the repository of the webhooks notified of the movements
+func WithWebhooks(webhooks webhook.Repository) Option {
+	return func(s *Service) {
+		s.webhooks = webhooks
+	}
+}
+
+// WithAPIKeys sets the repository of the API keys of the users
+func WithAPIKeys(apiKeys auth.Repository) Option {
+	return func(s *Service) {
+		s.apiKeys = apiKeys
+	}
+}
+
+// WithBroadcaster sets the broadcaster the committed movements and balances are pushed to
+func WithBroadcaster(broadcaster *broadcast.Broadcaster) Option {
+	return func(s *Service) {
+		s.broadcaster = broadcaster
+	}
+}
+
+// WithLogger sets the logger of the committed operations
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = logger
+	}
+}
+
+// New creates a Service implementation. The transactor makes each operation, its audit event and its domain
+// events atomic, so a user is never saved without its balances
+func New(userRepo user.Repository, movRepo movement.Repository, currencies *currency.Registry, transactor txn.Transactor,
+	opts ...Option) *Service {
+	service := &Service{userRepo: userRepo, movementRepo: movRepo, currencies: currencies, transactor: transactor,
+		resolver: net.DefaultResolver, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(service)
+	}
+
+	return service
+}
 
-	// every time that a new user is saved is necessary init movements
-	err = s.movementRepo.InitSave(ctx, movement.Movement{
-		Type:   "init",
-		UserID: userID,
+// CreateUser saves a new user with its initial balances in a single transaction
+func (s *Service) CreateUser(ctx context.Context, name, lastName, alias, email string) (_ int64, err error) {
+	defer s.observe("create_user", time.Now(), &err)
+	ctx, end := s.trace(ctx, "CreateUser")
+	defer end(&err)
+	var userID int64
+	err = s.transactor.Run(ctx, func(ctx context.Context) error {
+		var err error
+		if userID, err = s.userRepo.Save(ctx, name, lastName, alias, email); err != nil {
+			return err
+		}
+
+		// every time that a new user is saved is necessary init movements
+		err = s.movementRepo.InitSave(ctx, movement.Movement{
+			Type:   movement.InitMov,
+			UserID: userID,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = s.record(ctx, audit.ActionUserCreated, audit.TargetUser, userID, nil,
+			user.User{ID: userID, FirstName: name, LastName: lastName, Alias: alias, Email: email})
+		if err != nil {
+			return err
+		}
+
+		return s.emit(ctx, outbox.TypeUserCreated, userID,
+			outbox.UserCreated{UserID: userID, FirstName: name, LastName: lastName, Alias: alias, Email: email})
 	})
 	if err != nil {
-		// delete the created user
-		println("Delete", err.Error())
-		return 0, s.userRepo.Delete(ctx, userID)
+		return 0, err
 	}
 
+	s.logger.InfoContext(ctx, "user created", "user_id", userID)
 	return userID, nil
 }
 
 // GetUser returns an user
-func (s *Service) GetUser(ctx context.Context, id int64) (user.User, error) {
+func (s *Service) GetUser(ctx context.Context, id int64) (_ user.User, err error) {
+	ctx, end := s.trace(ctx, "GetUser")
+	defer end(&err)
 	userResult, err := s.userRepo.Get(ctx, id)
 	if err != nil {
 		return user.User{}, err
@@ -59,22 +177,532 @@ func (s *Service) GetUser(ctx context.Context, id int64) (user.User, error) {
 }
 
 // CreateMovement saves a movement
-func (s *Service) CreateMovement(ctx context.Context, movement movement.Movement) (int64, error) {
-	movement.CurrencyName = strings.ToUpper(movement.CurrencyName)
-	movementID, err := s.movementRepo.Save(ctx, movement)
+func (s *Service) CreateMovement(ctx context.Context, mov movement.Movement) (_ int64, err error) {
+	defer s.observe(mov.Type, time.Now(), &err)
+	ctx, end := s.trace(ctx, "CreateMovement")
+	defer end(&err)
+	mov.CurrencyName = strings.ToUpper(mov.CurrencyName)
+	if err = s.validateAmount(mov.CurrencyName, mov.Amount); err != nil {
+		return 0, err
+	}
+
+	err = s.transactor.Run(ctx, func(ctx context.Context) error {
+		var err error
+		if mov, err = s.movementRepo.Save(ctx, mov); err != nil {
+			return err
+		}
+
+		// the event keeps the balance before the movement and the saved movement, whose total is the balance after
+		if err = s.record(ctx, audit.ActionMovementCreated, audit.TargetMovement, mov.ID, mov.BalanceBefore(), mov); err != nil {
+			return err
+		}
+
+		return s.emitMovements(ctx, mov)
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	return movementID, nil
+	s.logger.InfoContext(ctx, "movement created", "movement_id", mov.ID, "user_id", mov.UserID, "type", mov.Type,
+		"currency", mov.CurrencyName, "amount", mov.Amount)
+	s.notify(ctx, mov)
+	return mov.ID, nil
+}
+
+// Transfer moves an amount of a currency from one user to another, resolving the receiver by alias when
+// no id is given
+func (s *Service) Transfer(ctx context.Context, transfer movement.Transfer) (_ movement.Transfer, err error) {
+	defer s.observe("transfer", time.Now(), &err)
+	ctx, end := s.trace(ctx, "Transfer")
+	defer end(&err)
+	transfer.CurrencyName = strings.ToUpper(transfer.CurrencyName)
+	if err = s.validateAmount(transfer.CurrencyName, transfer.Amount); err != nil {
+		return movement.Transfer{}, err
+	}
+
+	if transfer.ToUserID == 0 {
+		receiver, err := s.userRepo.GetByAlias(ctx, transfer.ToAlias)
+		if err != nil {
+			return movement.Transfer{}, err
+		}
+		transfer.ToUserID = receiver.ID
+	}
+
+	if transfer.FromUserID == transfer.ToUserID {
+		return movement.Transfer{}, movement.ErrorSameUser
+	}
+
+	err = s.transactor.Run(ctx, func(ctx context.Context) error {
+		var err error
+		if transfer, err = s.movementRepo.Transfer(ctx, transfer); err != nil {
+			return err
+		}
+
+		err = s.record(ctx, audit.ActionTransferCreated, audit.TargetMovement, transfer.DebitMovementID, nil, transfer)
+		if err != nil {
+			return err
+		}
+
+		return s.emitMovements(ctx, transferLegs(transfer)...)
+	})
+	if err != nil {
+		return movement.Transfer{}, err
+	}
+
+	s.logger.InfoContext(ctx, "transfer created", "debit_movement_id", transfer.DebitMovementID,
+		"credit_movement_id", transfer.CreditMovementID, "from_user_id", transfer.FromUserID, "to_user_id", transfer.ToUserID,
+		"currency", transfer.CurrencyName, "amount", transfer.Amount)
+	s.notify(ctx, transferLegs(transfer)...)
+	return transfer, nil
+}
+
+// Exchange converts an amount from one currency to another for the same user at the current rate
+func (s *Service) Exchange(ctx context.Context, exchange movement.Exchange) (_ movement.Exchange, err error) {
+	defer s.observe("exchange", time.Now(), &err)
+	ctx, end := s.trace(ctx, "Exchange")
+	defer end(&err)
+	if s.rates == nil {
+		return movement.Exchange{}, ErrorExchangeUnavailable
+	}
+
+	exchange.FromCurrencyName = strings.ToUpper(exchange.FromCurrencyName)
+	exchange.ToCurrencyName = strings.ToUpper(exchange.ToCurrencyName)
+	if exchange.FromCurrencyName == exchange.ToCurrencyName {
+		return movement.Exchange{}, movement.ErrorSameCurrency
+	}
+
+	if err = s.validateAmount(exchange.FromCurrencyName, exchange.Amount); err != nil {
+		return movement.Exchange{}, err
+	}
+
+	target, err := s.currencies.Get(exchange.ToCurrencyName)
+	if err != nil {
+		return movement.Exchange{}, movement.ErrorWrongCurrency
+	}
+
+	exchangeRate, err := s.rates.Rate(ctx, exchange.FromCurrencyName, exchange.ToCurrencyName)
+	if err != nil {
+		return movement.Exchange{}, err
+	}
+
+	exchange.Rate = exchangeRate
+	exchange.ConvertedAmount = movement.ConvertAmount(exchange.Amount, exchangeRate, target)
+	if !exchange.ConvertedAmount.IsPositive() {
+		return movement.Exchange{}, movement.ErrorAmountTooSmall
+	}
+
+	err = s.transactor.Run(ctx, func(ctx context.Context) error {
+		var err error
+		if exchange, err = s.movementRepo.Exchange(ctx, exchange); err != nil {
+			return err
+		}
+
+		if err = s.record(ctx, audit.ActionExchangeCreated, audit.TargetExchange, exchange.ID, nil, exchange); err != nil {
+			return err
+		}
+
+		return s.emitMovements(ctx, exchangeLegs(exchange)...)
+	})
+	if err != nil {
+		return movement.Exchange{}, err
+	}
+
+	s.logger.InfoContext(ctx, "exchange created", "exchange_id", exchange.ID, "user_id", exchange.UserID,
+		"from_currency", exchange.FromCurrencyName, "to_currency", exchange.ToCurrencyName, "amount", exchange.Amount,
+		"rate", exchange.Rate)
+	s.notify(ctx, exchangeLegs(exchange)...)
+	return exchange, nil
 }
 
 // SearchMovement returns the user movements given certain filters
-func (s *Service) SearchMovement(ctx context.Context, userID int64, limit, offset uint64, movType, currencyName string) ([]movement.Row, error) {
-	movements, err := s.movementRepo.Search(ctx, userID, limit, offset, movType, strings.ToUpper(currencyName))
+func (s *Service) SearchMovement(ctx context.Context, filter movement.Filter) (_ movement.Page, err error) {
+	ctx, end := s.trace(ctx, "SearchMovement")
+	defer end(&err)
+	filter.CurrencyName = strings.ToUpper(filter.CurrencyName)
+	if filter.Limit == 0 || filter.Limit > pageSize {
+		filter.Limit = pageSize
+	}
+
+	page, err := s.movementRepo.Search(ctx, filter)
+	if err != nil {
+		return movement.Page{}, err
+	}
+
+	return page, nil
+}
+
+// SearchUsers returns a page of the users whose alias, email or name contain the text
+func (s *Service) SearchUsers(ctx context.Context, text string, limit, offset uint64) (_ []user.User, err error) {
+	ctx, end := s.trace(ctx, "SearchUsers")
+	defer end(&err)
+	if limit == 0 || limit > pageSize {
+		limit = pageSize
+	}
+
+	return s.userRepo.Search(ctx, strings.TrimSpace(text), limit, offset)
+}
+
+// FreezeUser freezes the wallet of a user, which rejects every movement but the adjustments
+func (s *Service) FreezeUser(ctx context.Context, id int64) error {
+	return s.setFrozen(ctx, id, true, audit.ActionWalletFrozen)
+}
+
+// UnfreezeUser unfreezes the wallet of a user
+func (s *Service) UnfreezeUser(ctx context.Context, id int64) error {
+	return s.setFrozen(ctx, id, false, audit.ActionWalletUnfrozen)
+}
+
+func (s *Service) setFrozen(ctx context.Context, id int64, frozen bool, action string) (err error) {
+	operation, method := "unfreeze", "UnfreezeUser"
+	if frozen {
+		operation, method = "freeze", "FreezeUser"
+	}
+	defer s.observe(operation, time.Now(), &err)
+	ctx, end := s.trace(ctx, method)
+	defer end(&err)
+
+	err = s.transactor.Run(ctx, func(ctx context.Context) error {
+		before, err := s.userRepo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err = s.userRepo.SetFrozen(ctx, id, frozen); err != nil {
+			return err
+		}
+
+		after := before
+		after.Frozen = frozen
+
+		return s.record(ctx, action, audit.TargetUser, id, before, after)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.InfoContext(ctx, "wallet frozen changed", "user_id", id, "frozen", frozen)
+	return nil
+}
+
+// Adjust corrects the balance of a user with an adjustment movement made by the actor
+func (s *Service) Adjust(ctx context.Context, adjustment movement.Adjustment) (_ movement.Adjustment, err error) {
+	defer s.observe("adjustment", time.Now(), &err)
+	ctx, end := s.trace(ctx, "Adjust")
+	defer end(&err)
+	adjustment.CurrencyName = strings.ToUpper(adjustment.CurrencyName)
+	adjustment.Reason = strings.TrimSpace(adjustment.Reason)
+	if adjustment.Reason == "" {
+		return movement.Adjustment{}, movement.ErrorReasonRequired
+	}
+
+	if err = s.validateAmount(adjustment.CurrencyName, adjustment.Amount); err != nil {
+		return movement.Adjustment{}, err
+	}
+
+	err = s.transactor.Run(ctx, func(ctx context.Context) error {
+		var err error
+		if adjustment, err = s.movementRepo.Adjust(ctx, adjustment); err != nil {
+			return err
+		}
+
+		if err = s.record(ctx, audit.ActionAdjustmentCreated, audit.TargetMovement, adjustment.ID, nil, adjustment); err != nil {
+			return err
+		}
+
+		return s.emitMovements(ctx, adjustmentMovement(adjustment))
+	})
+	if err != nil {
+		return movement.Adjustment{}, err
+	}
+
+	s.logger.InfoContext(ctx, "adjustment created", "movement_id", adjustment.ID, "user_id", adjustment.UserID,
+		"type", adjustment.Type, "currency", adjustment.CurrencyName, "amount", adjustment.Amount)
+	s.notify(ctx, adjustmentMovement(adjustment))
+	return adjustment, nil
+}
+
+// AuditEvents returns a page of the audit events matching the filter, newest first
+func (s *Service) AuditEvents(ctx context.Context, filter audit.Filter) (_ []audit.Event, err error) {
+	ctx, end := s.trace(ctx, "AuditEvents")
+	defer end(&err)
+	if s.events == nil {
+		return nil, ErrorAuditUnavailable
+	}
+
+	if filter.Limit == 0 || filter.Limit > pageSize {
+		filter.Limit = pageSize
+	}
+
+	return s.events.Search(ctx, filter)
+}
+
+// CreateAPIKey saves a new API key of the user with the scopes and returns it. Only its hash is stored, so the key
+// can not be read again afterwards, and the audit event records the user and the scopes without the key
+func (s *Service) CreateAPIKey(ctx context.Context, userID int64, scopes []string) (_ string, err error) {
+	defer s.observe("create_api_key", time.Now(), &err)
+	ctx, end := s.trace(ctx, "CreateAPIKey")
+	defer end(&err)
+	if s.apiKeys == nil {
+		return "", ErrorAPIKeysUnavailable
+	}
+
+	if _, err = s.userRepo.Get(ctx, userID); err != nil {
+		return "", err
+	}
+
+	key, err := auth.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+
+	if scopes == nil {
+		scopes = []string{}
+	}
+	apiKey := auth.APIKey{UserID: userID, Hash: auth.HashKey(key), Scopes: scopes}
+	err = s.transactor.Run(ctx, func(ctx context.Context) error {
+		var err error
+		if apiKey.ID, err = s.apiKeys.Save(ctx, apiKey); err != nil {
+			return err
+		}
+
+		return s.record(ctx, audit.ActionAPIKeyCreated, audit.TargetAPIKey, apiKey.ID, nil, apiKey)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.InfoContext(ctx, "api key created", "api_key_id", apiKey.ID, "user_id", userID, "scopes", scopes)
+	return key, nil
+}
+
+// CreateWebhook registers an url to be notified of the movements of the wallet of a user, and returns the webhook
+// with the secret that signs the notifications
+func (s *Service) CreateWebhook(ctx context.Context, hook webhook.Webhook) (_ webhook.Webhook, err error) {
+	defer s.observe("create_webhook", time.Now(), &err)
+	ctx, end := s.trace(ctx, "CreateWebhook")
+	defer end(&err)
+	if s.webhooks == nil {
+		return webhook.Webhook{}, ErrorWebhooksUnavailable
+	}
+
+	if err = webhook.ValidateURL(ctx, s.resolver, hook.URL); err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	if _, err = s.userRepo.Get(ctx, hook.UserID); err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	err = s.transactor.Run(ctx, func(ctx context.Context) error {
+		id, err := s.webhooks.Save(ctx, webhook.Webhook{UserID: hook.UserID, URL: hook.URL, Secret: secret})
+		if err != nil {
+			return err
+		}
+
+		// read back for the date created, without the secret that is left out of the snapshot too
+		if hook, err = s.webhooks.Get(ctx, id); err != nil {
+			return err
+		}
+
+		return s.record(ctx, audit.ActionWebhookCreated, audit.TargetWebhook, hook.ID, nil, hook)
+	})
+	if err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	s.logger.InfoContext(ctx, "webhook created", "webhook_id", hook.ID, "user_id", hook.UserID)
+	hook.Secret = secret
+	return hook, nil
+}
+
+// GetWebhook returns a webhook without its secret
+func (s *Service) GetWebhook(ctx context.Context, id int64) (_ webhook.Webhook, err error) {
+	ctx, end := s.trace(ctx, "GetWebhook")
+	defer end(&err)
+	if s.webhooks == nil {
+		return webhook.Webhook{}, ErrorWebhooksUnavailable
+	}
+
+	return s.webhooks.Get(ctx, id)
+}
+
+// WebhookDeliveries returns a page of the deliveries of a webhook, newest first
+func (s *Service) WebhookDeliveries(ctx context.Context, webhookID int64, limit, offset uint64) (_ []webhook.Delivery,
+	err error) {
+	ctx, end := s.trace(ctx, "WebhookDeliveries")
+	defer end(&err)
+	if s.webhooks == nil {
+		return nil, ErrorWebhooksUnavailable
+	}
+
+	if limit == 0 || limit > pageSize {
+		limit = pageSize
+	}
+
+	return s.webhooks.Deliveries(ctx, webhookID, limit, offset)
+}
+
+// record appends the audit event of an action made by the caller of the context. It runs within the transaction
+// of the action, so both are saved or none
+func (s *Service) record(ctx context.Context, action, targetType string, targetID int64, before, after interface{}) error {
+	if s.events == nil {
+		return nil
+	}
+
+	identity, _ := auth.FromContext(ctx)
+	event := audit.Event{
+		ActorID:    identity.UserID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RequestID:  requestid.FromContext(ctx),
+	}
+
+	var err error
+	if event.Before, err = audit.Snapshot(before); err != nil {
+		return err
+	}
+
+	if event.After, err = audit.Snapshot(after); err != nil {
+		return err
+	}
+
+	_, err = s.events.Save(ctx, event)
+	return err
+}
+
+// emit appends a domain event to the outbox. It runs within the transaction of the operation, so the event is
+// published only if the operation is committed
+func (s *Service) emit(ctx context.Context, eventType string, userID int64, payload interface{}) error {
+	if s.outboxRepo == nil {
+		return nil
+	}
+
+	event, err := outbox.NewEvent(eventType, userID, payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.outboxRepo.Save(ctx, event)
+	return err
+}
+
+// emitMovements appends the MovementCreated event of each saved movement and the BalanceChanged event with the
+// balance it left, read within the transaction
+func (s *Service) emitMovements(ctx context.Context, movements ...movement.Movement) error {
+	if s.outboxRepo == nil {
+		return nil
+	}
+
+	for _, v := range movements {
+		err := s.emit(ctx, outbox.TypeMovementCreated, v.UserID, outbox.MovementCreated{MovementID: v.ID, UserID: v.UserID,
+			Type: v.Type, CurrencyName: v.CurrencyName, Amount: v.Amount})
+		if err != nil {
+			return err
+		}
+
+		accountExtract, err := s.movementRepo.GetAccountExtract(ctx, v.UserID)
+		if err != nil {
+			return err
+		}
+
+		err = s.emit(ctx, outbox.TypeBalanceChanged, v.UserID, outbox.BalanceChanged{UserID: v.UserID,
+			CurrencyName: v.CurrencyName, Amount: accountExtract[v.CurrencyName]})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Subscribe returns the channel of the movements and balances of a user as they are committed, and the function
+// that ends the subscription
+func (s *Service) Subscribe(ctx context.Context, userID int64) (<-chan broadcast.Event, func(), error) {
+	if s.broadcaster == nil {
+		return nil, nil, ErrorStreamUnavailable
+	}
+
+	events, cancel := s.broadcaster.Subscribe(userID)
+	return events, cancel, nil
+}
+
+// notify pushes the committed movements and the balances they left to the subscribers of their users. The balance is
+// read after the commit, so it may include later movements too; it is the latest one either way
+func (s *Service) notify(ctx context.Context, movements ...movement.Movement) {
+	if s.broadcaster == nil {
+		return
+	}
+
+	var notified = make(map[int64]bool)
+	for _, v := range movements {
+		if !s.broadcaster.HasSubscribers(v.UserID) {
+			continue
+		}
+
+		s.broadcaster.Publish(broadcast.Event{Type: broadcast.EventMovement, UserID: v.UserID, Data: outbox.MovementCreated{
+			MovementID: v.ID, UserID: v.UserID, Type: v.Type, CurrencyName: v.CurrencyName, Amount: v.Amount}})
+		notified[v.UserID] = true
+	}
+
+	for userID := range notified {
+		accountExtract, err := s.movementRepo.GetAccountExtract(ctx, userID)
+		if err != nil {
+			// the subscribers still got the movement, and get the balance with the next one
+			s.logger.WarnContext(ctx, "balance not broadcast", "user_id", userID, "error", err)
+			continue
+		}
+
+		s.broadcaster.Publish(broadcast.Event{Type: broadcast.EventBalance, UserID: userID, Data: accountExtract})
+	}
+}
+
+// transferLegs returns the movements of a saved transfer
+func transferLegs(transfer movement.Transfer) []movement.Movement {
+	return []movement.Movement{
+		{ID: transfer.DebitMovementID, Type: movement.TransferOutMov, Amount: transfer.Amount,
+			CurrencyName: transfer.CurrencyName, UserID: transfer.FromUserID},
+		{ID: transfer.CreditMovementID, Type: movement.TransferInMov, Amount: transfer.Amount,
+			CurrencyName: transfer.CurrencyName, UserID: transfer.ToUserID},
+	}
+}
+
+// exchangeLegs returns the movements of a saved exchange
+func exchangeLegs(exchange movement.Exchange) []movement.Movement {
+	return []movement.Movement{
+		{ID: exchange.DebitMovementID, Type: movement.ExchangeOutMov, Amount: exchange.Amount,
+			CurrencyName: exchange.FromCurrencyName, UserID: exchange.UserID},
+		{ID: exchange.CreditMovementID, Type: movement.ExchangeInMov, Amount: exchange.ConvertedAmount,
+			CurrencyName: exchange.ToCurrencyName, UserID: exchange.UserID},
+	}
+}
+
+// adjustmentMovement returns the movement of a saved adjustment
+func adjustmentMovement(adjustment movement.Adjustment) movement.Movement {
+	return movement.Movement{ID: adjustment.ID, Type: adjustment.Type, Amount: adjustment.Amount,
+		CurrencyName: adjustment.CurrencyName, UserID: adjustment.UserID}
+}
+
+// Currencies returns the supported currencies
+func (s *Service) Currencies(ctx context.Context) []currency.Currency {
+	return s.currencies.List()
+}
+
+// GetCurrency returns a supported currency by its name
+func (s *Service) GetCurrency(ctx context.Context, name string) (currency.Currency, error) {
+	return s.currencies.Get(name)
+}
+
+func (s *Service) validateAmount(currencyName string, amount decimal.Decimal) error {
+	currency, err := s.currencies.Get(currencyName)
 	if err != nil {
-		return []movement.Row{}, err
+		return movement.ErrorWrongCurrency
 	}
 
-	return movements, nil
+	return movement.ValidateAmount(currency, amount)
 }
@@ -2,16 +2,38 @@ package wallet
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
+	"github.com/spolia/lemon-wallet/internal/metrics"
+	"github.com/spolia/lemon-wallet/internal/requestid"
+	"github.com/spolia/lemon-wallet/internal/tracing"
+	"github.com/spolia/lemon-wallet/internal/wallet/audit"
+	"github.com/spolia/lemon-wallet/internal/wallet/auth"
+	"github.com/spolia/lemon-wallet/internal/wallet/broadcast"
+	"github.com/spolia/lemon-wallet/internal/wallet/currency"
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
 	"github.com/spolia/lemon-wallet/internal/wallet/movement"
+	"github.com/spolia/lemon-wallet/internal/wallet/outbox"
+	"github.com/spolia/lemon-wallet/internal/wallet/rate"
 	"github.com/spolia/lemon-wallet/internal/wallet/user"
+	"github.com/spolia/lemon-wallet/internal/wallet/webhook"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
+var testCurrencies = currency.MustNewRegistry([]currency.Currency{
+	{ID: 1, Name: "ARS", Digits: 2},
+	{ID: 2, Name: "BTC", Digits: 8},
+	{ID: 3, Name: "USDT", Digits: 2},
+})
+
 func TestService_CreateUser_ok(t *testing.T) {
 	// Given
 	input := user.User{
@@ -25,7 +47,7 @@ func TestService_CreateUser_ok(t *testing.T) {
 	userMock.On("Save").Return(int64(1), nil).Once()
 	var movementsMock movementRepositoryMock
 	movementsMock.On("InitSave").Return(nil).Once()
-	service := New(&userMock, &movementsMock)
+	service := New(&userMock, &movementsMock, testCurrencies, &transactorMock{})
 
 	// Then
 	userID, err := service.CreateUser(context.Background(), input.FirstName, input.LastName, input.Alias, input.Email)
@@ -45,7 +67,7 @@ func TestService_CreateUser_Fail(t *testing.T) {
 	var userMock userRepositoryMock
 	userMock.On("Save").Return(int64(0), errors.New("user: fail")).Once()
 
-	service := New(&userMock, nil)
+	service := New(&userMock, nil, testCurrencies, &transactorMock{})
 
 	// Then
 	userID, err := service.CreateUser(context.Background(), input.FirstName, input.LastName, input.Alias, input.Email)
@@ -53,7 +75,7 @@ func TestService_CreateUser_Fail(t *testing.T) {
 	require.Equal(t, int64(0), userID)
 }
 
-func TestService_CreateUser_When_InitSaveFails_DeletesUserSaved(t *testing.T) {
+func TestService_CreateUser_When_InitSaveFails_Then_RollsBack(t *testing.T) {
 	// Given
 	input := user.User{
 		FirstName: "name",
@@ -64,16 +86,59 @@ func TestService_CreateUser_When_InitSaveFails_DeletesUserSaved(t *testing.T) {
 	// When
 	var userMock userRepositoryMock
 	userMock.On("Save").Return(int64(1), nil).Once()
-	userMock.On("Delete").Return(nil).Once()
 
 	var movementsMock movementRepositoryMock
 	movementsMock.On("InitSave").Return(errors.New("movement: fail")).Once()
-	service := New(&userMock, &movementsMock)
+	var transactor transactorMock
+	service := New(&userMock, &movementsMock, testCurrencies, &transactor)
 
 	// Then
 	userID, err := service.CreateUser(context.Background(), input.FirstName, input.LastName, input.Alias, input.Email)
-	require.NoError(t, err)
+	require.EqualError(t, err, "movement: fail")
 	require.Equal(t, int64(0), userID)
+	require.Equal(t, 1, transactor.rolledBack)
+}
+
+func TestService_CreateUser_RecordsAuditEvent(t *testing.T) {
+	// Given
+	var userMock userRepositoryMock
+	userMock.On("Save").Return(int64(1), nil).Once()
+	var movementsMock movementRepositoryMock
+	movementsMock.On("InitSave").Return(nil).Once()
+	var events auditRepositoryMock
+	events.On("Save", audit.Event{Action: audit.ActionUserCreated, TargetType: audit.TargetUser, TargetID: 1, RequestID: "req",
+		After: json.RawMessage(`{"id":1,"firstname":"name","lastname":"lastname","alias":"alias","email":"email","frozen":false,"walletstatement":null}`),
+	}).Return(int64(1), nil).Once()
+	var transactor transactorMock
+	service := New(&userMock, &movementsMock, testCurrencies, &transactor, WithAuditLog(&events))
+
+	// When
+	userID, err := service.CreateUser(requestid.NewContext(context.Background(), "req"), "name", "lastname", "alias", "email")
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, int64(1), userID)
+	require.Equal(t, 1, transactor.committed)
+	events.AssertExpectations(t)
+}
+
+func TestService_CreateUser_When_AuditFails_Then_RollsBack(t *testing.T) {
+	// Given
+	var userMock userRepositoryMock
+	userMock.On("Save").Return(int64(1), nil).Once()
+	var movementsMock movementRepositoryMock
+	movementsMock.On("InitSave").Return(nil).Once()
+	var events auditRepositoryMock
+	events.On("Save", mock.Anything).Return(int64(0), errors.New("audit: fail")).Once()
+	var transactor transactorMock
+	service := New(&userMock, &movementsMock, testCurrencies, &transactor, WithAuditLog(&events))
+
+	// When
+	_, err := service.CreateUser(context.Background(), "name", "lastname", "alias", "email")
+
+	// Then
+	require.EqualError(t, err, "audit: fail")
+	require.Equal(t, 1, transactor.rolledBack)
 }
 
 func TestService_GetUser_When_GetAccountExtractFail_Then_ReturnsError(t *testing.T) {
@@ -85,11 +150,10 @@ func TestService_GetUser_When_GetAccountExtractFail_Then_ReturnsError(t *testing
 		Alias:     "alias",
 		Email:     "email",
 	}, nil).Once()
-	userMock.On("Delete").Return(nil).Once()
 
 	var movementsMock movementRepositoryMock
 	movementsMock.On("GetAccountExtract").Return(movement.AccountExtract{}, errors.New("mov fail")).Once()
-	service := New(&userMock, &movementsMock)
+	service := New(&userMock, &movementsMock, testCurrencies, &transactorMock{})
 
 	// Then
 	userResult, err := service.GetUser(context.Background(), 1)
@@ -97,19 +161,48 @@ func TestService_GetUser_When_GetAccountExtractFail_Then_ReturnsError(t *testing
 	require.Empty(t, userResult)
 }
 
+func TestService_GetUser_Traces(t *testing.T) {
+	// Given
+	var userMock userRepositoryMock
+	userMock.On("Get").Return(user.User{ID: 1}, nil).Once()
+	var movementsMock movementRepositoryMock
+	movementsMock.On("GetAccountExtract").Return(movement.AccountExtract{}, errors.New("mov fail")).Once()
+	var exporter tracing.Memory
+	tracer := tracing.New(&exporter)
+	service := New(user.Instrument(&userMock, nil, tracer), movement.Instrument(&movementsMock, nil, tracer),
+		testCurrencies, &transactorMock{}, WithTracer(tracer))
+
+	// When
+	_, err := service.GetUser(context.Background(), 1)
+
+	// Then
+	require.Error(t, err)
+	spans := exporter.Spans()
+	require.Len(t, spans, 3)
+	require.Equal(t, "user.Repository/Get", spans[0].Name)
+	require.Equal(t, "movement.Repository/GetAccountExtract", spans[1].Name)
+	require.Equal(t, "mov fail", spans[1].Error)
+	require.Equal(t, "wallet.Service/GetUser", spans[2].Name)
+	require.Equal(t, "mov fail", spans[2].Error)
+	require.Equal(t, spans[2].SpanID, spans[0].ParentID)
+	require.Equal(t, spans[2].SpanID, spans[1].ParentID)
+	require.Equal(t, spans[2].TraceID, spans[0].TraceID)
+}
+
 func TestService_CreateMovement_ok(t *testing.T) {
 	// Given
 	input := movement.Movement{
 		Type:         "deposit",
-		Amount:       100,
+		Amount:       decimal.RequireFromString("100"),
 		CurrencyName: "ARS",
 		UserID:       1,
 	}
 	// When
 	var userMock userRepositoryMock
 	var movementsMock movementRepositoryMock
-	movementsMock.On("Save").Return(int64(1), nil).Once()
-	service := New(&userMock, &movementsMock)
+	movementsMock.On("Save").Return(movement.Movement{ID: 1, Type: movement.DepositMov, Amount: decimal.RequireFromString("100"),
+		CurrencyName: "ARS", UserID: 1, TotalAmount: decimal.RequireFromString("100")}, nil).Once()
+	service := New(&userMock, &movementsMock, testCurrencies, &transactorMock{})
 
 	// Then
 	id, err := service.CreateMovement(context.Background(), input)
@@ -117,19 +210,90 @@ func TestService_CreateMovement_ok(t *testing.T) {
 	require.Equal(t, int64(1), id)
 }
 
+func TestService_CreateMovement_NotifiesSubscribers(t *testing.T) {
+	// Given
+	var movementsMock movementRepositoryMock
+	movementsMock.On("Save").Return(movement.Movement{ID: 1, Type: movement.DepositMov, Amount: decimal.RequireFromString("100"),
+		CurrencyName: "ARS", UserID: 1, TotalAmount: decimal.RequireFromString("100")}, nil).Once()
+	movementsMock.On("GetAccountExtract").Return(movement.AccountExtract{"ARS": decimal.RequireFromString("100")}, nil).Once()
+	broadcaster := broadcast.New(2)
+	service := New(&userRepositoryMock{}, &movementsMock, testCurrencies, &transactorMock{}, WithBroadcaster(broadcaster))
+	events, cancel, err := service.Subscribe(context.Background(), 1)
+	require.NoError(t, err)
+	defer cancel()
+
+	// When
+	_, err = service.CreateMovement(context.Background(), movement.Movement{Type: movement.DepositMov,
+		Amount: decimal.RequireFromString("100"), CurrencyName: "ars", UserID: 1})
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, broadcast.Event{Type: broadcast.EventMovement, UserID: 1, Data: outbox.MovementCreated{MovementID: 1,
+		UserID: 1, Type: movement.DepositMov, CurrencyName: "ARS", Amount: decimal.RequireFromString("100")}}, <-events)
+	require.Equal(t, broadcast.Event{Type: broadcast.EventBalance, UserID: 1,
+		Data: movement.AccountExtract{"ARS": decimal.RequireFromString("100")}}, <-events)
+}
+
+func TestService_CreateMovement_When_Fails_Then_NotifiesNothing(t *testing.T) {
+	// Given
+	var movementsMock movementRepositoryMock
+	movementsMock.On("Save").Return(movement.Movement{}, movement.ErrorInsufficientBalance).Once()
+	broadcaster := broadcast.New(2)
+	service := New(&userRepositoryMock{}, &movementsMock, testCurrencies, &transactorMock{}, WithBroadcaster(broadcaster))
+	events, cancel, err := service.Subscribe(context.Background(), 1)
+	require.NoError(t, err)
+	defer cancel()
+
+	// When
+	_, err = service.CreateMovement(context.Background(), movement.Movement{Type: movement.ExtractMov,
+		Amount: decimal.RequireFromString("100"), CurrencyName: "ARS", UserID: 1})
+
+	// Then
+	require.EqualError(t, err, movement.ErrorInsufficientBalance.Error())
+	require.Len(t, events, 0)
+}
+
+func TestService_CreateMovement_CountsResults(t *testing.T) {
+	// Given
+	var movementsMock movementRepositoryMock
+	movementsMock.On("Save").Return(movement.Movement{ID: 1, Type: movement.DepositMov, Amount: decimal.RequireFromString("100"),
+		CurrencyName: "ARS", UserID: 1, TotalAmount: decimal.RequireFromString("100")}, nil).Once()
+	movementsMock.On("Save").Return(movement.Movement{}, movement.ErrorInsufficientBalance).Once()
+	movementsMock.On("Save").Return(movement.Movement{}, errors.New("fail")).Once()
+	movementsMock.On("Save").Return(movement.Movement{}, dberror.Classify(&mysql.MySQLError{Number: 1213})).Once()
+	registry := metrics.New()
+	service := New(&userRepositoryMock{}, &movementsMock, testCurrencies, &transactorMock{}, WithMetrics(registry))
+
+	// When
+	for _, movementType := range []string{movement.DepositMov, movement.ExtractMov, movement.ExtractMov, movement.DepositMov} {
+		_, _ = service.CreateMovement(context.Background(), movement.Movement{Type: movementType,
+			Amount: decimal.RequireFromString("100"), CurrencyName: "ARS", UserID: 1})
+	}
+
+	// Then
+	var out strings.Builder
+	_, err := registry.WriteTo(&out)
+	require.NoError(t, err)
+	require.Contains(t, out.String(), `wallet_operations_total{operation="deposit",result="ok"} 1`)
+	require.Contains(t, out.String(), `wallet_operations_total{operation="extract",result="error"} 1`)
+	require.Contains(t, out.String(), `wallet_operations_total{operation="extract",result="insufficient_balance"} 1`)
+	require.Contains(t, out.String(), `wallet_operations_total{operation="deposit",result="deadlock"} 1`)
+	require.Contains(t, out.String(), `wallet_operation_duration_seconds_count{operation="extract"} 2`)
+}
+
 func TestService_CreateMovement_Fail(t *testing.T) {
 	// Given
 	input := movement.Movement{
 		Type:         "deposit",
-		Amount:       100,
+		Amount:       decimal.RequireFromString("100"),
 		CurrencyName: "ARS",
 		UserID:       1,
 	}
 	// When
 	var userMock userRepositoryMock
 	var movementsMock movementRepositoryMock
-	movementsMock.On("Save").Return(int64(0), errors.New("movement:fail")).Once()
-	service := New(&userMock, &movementsMock)
+	movementsMock.On("Save").Return(movement.Movement{}, errors.New("movement:fail")).Once()
+	service := New(&userMock, &movementsMock, testCurrencies, &transactorMock{})
 
 	// Then
 	id, err := service.CreateMovement(context.Background(), input)
@@ -137,48 +301,439 @@ func TestService_CreateMovement_Fail(t *testing.T) {
 	require.Equal(t, int64(0), id)
 }
 
+func TestService_CreateMovement_When_AmountExceedsPrecision_Then_ReturnsError(t *testing.T) {
+	// Given
+	input := movement.Movement{
+		Type:         "deposit",
+		Amount:       decimal.RequireFromString("100.001"),
+		CurrencyName: "ars",
+		UserID:       1,
+	}
+	// When
+	service := New(&userRepositoryMock{}, &movementRepositoryMock{}, testCurrencies, &transactorMock{})
+
+	// Then
+	id, err := service.CreateMovement(context.Background(), input)
+	require.EqualError(t, err, movement.ErrorInvalidPrecision.Error())
+	require.Equal(t, int64(0), id)
+}
+
 func TestService_SearchMovement_Ok(t *testing.T) {
 	// When
 	var userMock userRepositoryMock
 	var movementsMock movementRepositoryMock
-	movementsMock.On("Search").Return([]movement.Row{
+	movementsMock.On("Search", movement.Filter{UserID: 1, Limit: 10, Type: "deposit", CurrencyName: "USDT"}).Return(movement.Page{Total: 2, Items: []movement.Row{
 		{
 			CurrencyName: "USDT",
 			Type:         "deposut",
 			DateCreated:  time.Now(),
-			Amount:       100.00,
-			TotalAmount:  200.00,
+			Amount:       decimal.RequireFromString("100.00"),
+			TotalAmount:  decimal.RequireFromString("200.00"),
 		},
 		{
 			CurrencyName: "USDT",
 			Type:         "deposut",
 			DateCreated:  time.Now(),
-			Amount:       100.00,
-			TotalAmount:  300.00,
+			Amount:       decimal.RequireFromString("100.00"),
+			TotalAmount:  decimal.RequireFromString("300.00"),
 		},
-	}, nil).Once()
-	service := New(&userMock, &movementsMock)
+	}}, nil).Once()
+	service := New(&userMock, &movementsMock, testCurrencies, &transactorMock{})
 
 	// Then
-	movements, err := service.SearchMovement(context.Background(), 1, uint64(10), uint64(0), "deposit",
-		"usdt")
+	page, err := service.SearchMovement(context.Background(), movement.Filter{UserID: 1, Limit: 10, Type: "deposit",
+		CurrencyName: "usdt"})
 	require.NoError(t, err)
-	require.Equal(t, 2, len(movements))
-	require.Equal(t, 200.00, movements[0].TotalAmount)
+	require.Equal(t, int64(2), page.Total)
+	require.Equal(t, 2, len(page.Items))
+	require.Equal(t, "200", page.Items[0].TotalAmount.String())
 }
 
 func TestService_SearchMovement_Fail(t *testing.T) {
 	// When
 	var userMock userRepositoryMock
 	var movementsMock movementRepositoryMock
-	movementsMock.On("Search").Return([]movement.Row{}, errors.New("fail")).Once()
-	service := New(&userMock, &movementsMock)
+	movementsMock.On("Search", mock.Anything).Return(movement.Page{}, errors.New("fail")).Once()
+	service := New(&userMock, &movementsMock, testCurrencies, &transactorMock{})
 
 	// Then
-	movements, err := service.SearchMovement(context.Background(), 1, uint64(10), uint64(0), "deposit",
-		"usdt")
+	page, err := service.SearchMovement(context.Background(), movement.Filter{UserID: 1, Limit: 10, Type: "deposit",
+		CurrencyName: "usdt"})
 	require.Error(t, err)
-	require.Equal(t, 0, len(movements))
+	require.Equal(t, 0, len(page.Items))
+}
+
+func TestService_Transfer_ByAlias_ok(t *testing.T) {
+	// Given
+	input := movement.Transfer{
+		FromUserID:   1,
+		ToAlias:      "alias",
+		Amount:       decimal.RequireFromString("100"),
+		CurrencyName: "ars",
+	}
+	// When
+	var userMock userRepositoryMock
+	userMock.On("GetByAlias").Return(user.User{ID: 2, Alias: "alias"}, nil).Once()
+	var movementsMock movementRepositoryMock
+	movementsMock.On("Transfer").Return(movement.Transfer{
+		FromUserID:       1,
+		ToUserID:         2,
+		Amount:           decimal.RequireFromString("100"),
+		CurrencyName:     "ARS",
+		DebitMovementID:  10,
+		CreditMovementID: 11,
+	}, nil).Once()
+	service := New(&userMock, &movementsMock, testCurrencies, &transactorMock{})
+
+	// Then
+	result, err := service.Transfer(context.Background(), input)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), result.ToUserID)
+	require.Equal(t, int64(10), result.DebitMovementID)
+	require.Equal(t, int64(11), result.CreditMovementID)
+}
+
+func TestService_Transfer_EmitsEventsOfBothLegs(t *testing.T) {
+	// Given
+	var movementsMock movementRepositoryMock
+	movementsMock.On("Transfer").Return(movement.Transfer{FromUserID: 1, ToUserID: 2, Amount: decimal.RequireFromString("100"),
+		CurrencyName: "ARS", DebitMovementID: 10, CreditMovementID: 11}, nil).Once()
+	movementsMock.On("GetAccountExtract").Return(movement.AccountExtract{"ARS": decimal.RequireFromString("50")}, nil)
+	var events outboxRepositoryMock
+	events.On("Save", mock.Anything).Return(int64(1), nil)
+	var transactor transactorMock
+	service := New(&userRepositoryMock{}, &movementsMock, testCurrencies, &transactor, WithOutbox(&events))
+
+	// When
+	_, err := service.Transfer(context.Background(), movement.Transfer{FromUserID: 1, ToUserID: 2,
+		Amount: decimal.RequireFromString("100"), CurrencyName: "ARS"})
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, 1, transactor.committed)
+	require.Equal(t, []string{outbox.TypeMovementCreated, outbox.TypeBalanceChanged, outbox.TypeMovementCreated,
+		outbox.TypeBalanceChanged}, events.types())
+	require.JSONEq(t, `{"movementid":11,"userid":2,"type":"transfer_in","currencyname":"ARS","amount":"100"}`,
+		string(events.saved[2].Payload))
+	require.JSONEq(t, `{"userid":2,"currencyname":"ARS","amount":"50"}`, string(events.saved[3].Payload))
+}
+
+func TestService_CreateUser_When_OutboxFails_Then_RollsBack(t *testing.T) {
+	// Given
+	var userMock userRepositoryMock
+	userMock.On("Save").Return(int64(1), nil).Once()
+	var movementsMock movementRepositoryMock
+	movementsMock.On("InitSave").Return(nil).Once()
+	var events outboxRepositoryMock
+	events.On("Save", mock.Anything).Return(int64(0), errors.New("outbox: fail")).Once()
+	var transactor transactorMock
+	service := New(&userMock, &movementsMock, testCurrencies, &transactor, WithOutbox(&events))
+
+	// When
+	_, err := service.CreateUser(context.Background(), "name", "lastname", "alias", "email")
+
+	// Then
+	require.EqualError(t, err, "outbox: fail")
+	require.Equal(t, 1, transactor.rolledBack)
+	require.Equal(t, []string{outbox.TypeUserCreated}, events.types())
+}
+
+func TestService_Transfer_When_AliasNotFound_Then_ReturnsError(t *testing.T) {
+	// Given
+	input := movement.Transfer{
+		FromUserID:   1,
+		ToAlias:      "alias",
+		Amount:       decimal.RequireFromString("100"),
+		CurrencyName: "ars",
+	}
+	// When
+	var userMock userRepositoryMock
+	userMock.On("GetByAlias").Return(user.User{}, user.ErrorUserNotFound).Once()
+	service := New(&userMock, nil, testCurrencies, &transactorMock{})
+
+	// Then
+	result, err := service.Transfer(context.Background(), input)
+	require.EqualError(t, err, user.ErrorUserNotFound.Error())
+	require.Empty(t, result)
+}
+
+func TestService_Transfer_When_SameUser_Then_ReturnsError(t *testing.T) {
+	// Given
+	input := movement.Transfer{
+		FromUserID:   1,
+		ToUserID:     1,
+		Amount:       decimal.RequireFromString("100"),
+		CurrencyName: "ars",
+	}
+	// When
+	service := New(&userRepositoryMock{}, &movementRepositoryMock{}, testCurrencies, &transactorMock{})
+
+	// Then
+	result, err := service.Transfer(context.Background(), input)
+	require.EqualError(t, err, movement.ErrorSameUser.Error())
+	require.Empty(t, result)
+}
+
+func TestService_Exchange_ok(t *testing.T) {
+	// Given
+	input := movement.Exchange{
+		UserID:           1,
+		FromCurrencyName: "usdt",
+		ToCurrencyName:   "btc",
+		Amount:           decimal.RequireFromString("100"),
+	}
+	// When
+	var movementsMock movementRepositoryMock
+	movementsMock.On("Exchange", mock.MatchedBy(func(exchange movement.Exchange) bool {
+		return exchange.FromCurrencyName == "USDT" && exchange.ToCurrencyName == "BTC" &&
+			exchange.Rate.Equal(decimal.RequireFromString("0.00003")) &&
+			exchange.ConvertedAmount.Equal(decimal.RequireFromString("0.003"))
+	})).Return(movement.Exchange{ID: 1, ConvertedAmount: decimal.RequireFromString("0.003")}, nil).Once()
+	service := New(&userRepositoryMock{}, &movementsMock, testCurrencies, &transactorMock{},
+		WithRateProvider(rate.NewStatic(map[string]decimal.Decimal{"USDT/BTC": decimal.RequireFromString("0.00003")})))
+
+	// Then
+	result, err := service.Exchange(context.Background(), input)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), result.ID)
+	require.Equal(t, "0.003", result.ConvertedAmount.String())
+}
+
+func TestService_Exchange_When_SameCurrency_Then_ReturnsError(t *testing.T) {
+	// Given
+	input := movement.Exchange{
+		UserID:           1,
+		FromCurrencyName: "usdt",
+		ToCurrencyName:   "USDT",
+		Amount:           decimal.RequireFromString("100"),
+	}
+	// When
+	service := New(&userRepositoryMock{}, &movementRepositoryMock{}, testCurrencies, &transactorMock{},
+		WithRateProvider(rate.NewStatic(map[string]decimal.Decimal{"USDT/BTC": decimal.RequireFromString("0.00003")})))
+
+	// Then
+	result, err := service.Exchange(context.Background(), input)
+	require.EqualError(t, err, movement.ErrorSameCurrency.Error())
+	require.Empty(t, result)
+}
+
+func TestService_Exchange_When_RateNotFound_Then_ReturnsError(t *testing.T) {
+	// Given
+	input := movement.Exchange{
+		UserID:           1,
+		FromCurrencyName: "ars",
+		ToCurrencyName:   "btc",
+		Amount:           decimal.RequireFromString("100"),
+	}
+	// When
+	service := New(&userRepositoryMock{}, &movementRepositoryMock{}, testCurrencies, &transactorMock{},
+		WithRateProvider(rate.NewStatic(map[string]decimal.Decimal{"USDT/BTC": decimal.RequireFromString("0.00003")})))
+
+	// Then
+	result, err := service.Exchange(context.Background(), input)
+	require.EqualError(t, err, rate.ErrorRateNotFound.Error())
+	require.Empty(t, result)
+}
+
+func TestService_Exchange_When_NoRateProvider_Then_ReturnsError(t *testing.T) {
+	// When
+	service := New(&userRepositoryMock{}, &movementRepositoryMock{}, testCurrencies, &transactorMock{})
+
+	// Then
+	result, err := service.Exchange(context.Background(), movement.Exchange{})
+	require.EqualError(t, err, ErrorExchangeUnavailable.Error())
+	require.Empty(t, result)
+}
+
+func TestService_CreateMovement_When_UnknownCurrency_Then_ReturnsError(t *testing.T) {
+	// Given
+	input := movement.Movement{
+		Type:         "deposit",
+		Amount:       decimal.RequireFromString("1"),
+		CurrencyName: "eth",
+		UserID:       1,
+	}
+	// When
+	service := New(&userRepositoryMock{}, &movementRepositoryMock{}, testCurrencies, &transactorMock{})
+
+	// Then
+	id, err := service.CreateMovement(context.Background(), input)
+	require.EqualError(t, err, movement.ErrorWrongCurrency.Error())
+	require.Equal(t, int64(0), id)
+}
+
+func TestService_Currencies(t *testing.T) {
+	// When
+	service := New(&userRepositoryMock{}, &movementRepositoryMock{}, testCurrencies, &transactorMock{})
+
+	// Then
+	currencies := service.Currencies(context.Background())
+	require.Equal(t, 3, len(currencies))
+	require.Equal(t, "ARS", currencies[0].Name)
+
+	btc, err := service.GetCurrency(context.Background(), "btc")
+	require.NoError(t, err)
+	require.Equal(t, int32(8), btc.Digits)
+}
+
+func TestService_SearchUsers_When_LimitTooLarge_Then_UsesPageSize(t *testing.T) {
+	// Given
+	var userMock userRepositoryMock
+	userMock.On("Search", "maria", uint64(pageSize), uint64(10)).Return([]user.User{{ID: 1}}, nil).Once()
+	service := New(&userMock, nil, testCurrencies, &transactorMock{})
+
+	// When
+	users, err := service.SearchUsers(context.Background(), " maria ", 1000, 10)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+}
+
+func TestService_SearchMovement_When_LimitMissingOrTooLarge_Then_UsesPageSize(t *testing.T) {
+	for _, limit := range []uint64{0, 1000} {
+		// Given
+		var movementsMock movementRepositoryMock
+		movementsMock.On("Search", movement.Filter{UserID: 1, Limit: pageSize, Offset: 20}).
+			Return(movement.Page{Total: 21, Items: []movement.Row{{ID: 1}}}, nil).Once()
+		service := New(&userRepositoryMock{}, &movementsMock, testCurrencies, &transactorMock{})
+
+		// When
+		page, err := service.SearchMovement(context.Background(), movement.Filter{UserID: 1, Limit: limit, Offset: 20})
+
+		// Then
+		require.NoError(t, err, limit)
+		require.Len(t, page.Items, 1, limit)
+	}
+}
+
+func TestService_FreezeUser_ok(t *testing.T) {
+	// Given
+	var userMock userRepositoryMock
+	userMock.On("Get").Return(user.User{ID: 1}, nil).Once()
+	userMock.On("SetFrozen", int64(1), true).Return(nil).Once()
+	service := New(&userMock, nil, testCurrencies, &transactorMock{})
+
+	// When
+	err := service.FreezeUser(context.Background(), 1)
+
+	// Then
+	require.NoError(t, err)
+	userMock.AssertExpectations(t)
+}
+
+func TestService_FreezeUser_RecordsActor(t *testing.T) {
+	// Given
+	var userMock userRepositoryMock
+	userMock.On("Get").Return(user.User{ID: 1, Alias: "alias"}, nil).Once()
+	userMock.On("SetFrozen", int64(1), true).Return(nil).Once()
+	var events auditRepositoryMock
+	events.On("Save", mock.MatchedBy(func(event audit.Event) bool {
+		return event.ActorID == 3 && event.Action == audit.ActionWalletFrozen && event.TargetID == 1 &&
+			strings.Contains(string(event.Before), `"frozen":false`) && strings.Contains(string(event.After), `"frozen":true`)
+	})).Return(int64(1), nil).Once()
+	service := New(&userMock, nil, testCurrencies, &transactorMock{}, WithAuditLog(&events))
+
+	// When
+	err := service.FreezeUser(auth.NewContext(context.Background(), auth.Identity{UserID: 3, Scopes: []string{auth.ScopeAdmin}}), 1)
+
+	// Then
+	require.NoError(t, err)
+	events.AssertExpectations(t)
+}
+
+func TestService_CreateMovement_RecordsSavedBalance(t *testing.T) {
+	// Given
+	var movementsMock movementRepositoryMock
+	movementsMock.On("Save").Return(movement.Movement{ID: 7, Type: movement.ExtractMov, Amount: decimal.RequireFromString("30"),
+		CurrencyName: "ARS", UserID: 1, TotalAmount: decimal.RequireFromString("70")}, nil).Once()
+	var events auditRepositoryMock
+	events.On("Save", mock.MatchedBy(func(event audit.Event) bool {
+		return event.Action == audit.ActionMovementCreated && event.TargetID == 7 &&
+			string(event.Before) == `{"userid":1,"currencyname":"ARS","amount":"100"}` &&
+			strings.Contains(string(event.After), `"totalamount":"70"`)
+	})).Return(int64(1), nil).Once()
+	service := New(&userRepositoryMock{}, &movementsMock, testCurrencies, &transactorMock{}, WithAuditLog(&events))
+
+	// When
+	_, err := service.CreateMovement(context.Background(), movement.Movement{Type: movement.ExtractMov,
+		Amount: decimal.RequireFromString("30"), CurrencyName: "ARS", UserID: 1, TotalAmount: decimal.RequireFromString("1000000")})
+
+	// Then
+	require.NoError(t, err)
+	events.AssertExpectations(t)
+}
+
+func TestService_AuditEvents(t *testing.T) {
+	// Given
+	var events auditRepositoryMock
+	events.On("Search", audit.Filter{TargetType: audit.TargetUser, Limit: pageSize}).Return([]audit.Event{{ID: 1}}, nil).Once()
+	service := New(nil, nil, testCurrencies, &transactorMock{}, WithAuditLog(&events))
+
+	// When
+	result, err := service.AuditEvents(context.Background(), audit.Filter{TargetType: audit.TargetUser})
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+
+	_, err = New(nil, nil, testCurrencies, &transactorMock{}).AuditEvents(context.Background(), audit.Filter{})
+	require.EqualError(t, err, ErrorAuditUnavailable.Error())
+}
+
+func TestService_UnfreezeUser_When_UserNotFound_Then_ReturnsError(t *testing.T) {
+	// Given
+	var userMock userRepositoryMock
+	userMock.On("Get").Return(user.User{}, user.ErrorUserNotFound).Once()
+	service := New(&userMock, nil, testCurrencies, &transactorMock{})
+
+	// When
+	err := service.UnfreezeUser(context.Background(), 1)
+
+	// Then
+	require.EqualError(t, err, user.ErrorUserNotFound.Error())
+	userMock.AssertNotCalled(t, "SetFrozen", mock.Anything, mock.Anything)
+}
+
+func TestService_Adjust_ok(t *testing.T) {
+	// Given
+	var movementsMock movementRepositoryMock
+	movementsMock.On("Adjust", movement.Adjustment{Type: movement.AdjustmentInMov, Amount: decimal.RequireFromString("10.5"),
+		CurrencyName: "ARS", UserID: 1, Reason: "chargeback", ActorID: 3}).Return(movement.Adjustment{ID: 9}, nil).Once()
+	service := New(nil, &movementsMock, testCurrencies, &transactorMock{})
+
+	// When
+	result, err := service.Adjust(context.Background(), movement.Adjustment{Type: movement.AdjustmentInMov,
+		Amount: decimal.RequireFromString("10.5"), CurrencyName: "ars", UserID: 1, Reason: " chargeback ", ActorID: 3})
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, int64(9), result.ID)
+}
+
+func TestService_Adjust_Errors(t *testing.T) {
+	tt := []struct {
+		TestName, Amount, Reason string
+		Expected                 error
+	}{
+		{"NoReason", "10", "  ", movement.ErrorReasonRequired},
+		{"NegativeAmount", "-10", "chargeback", movement.ErrorInvalidAmount},
+		{"InvalidPrecision", "10.001", "chargeback", movement.ErrorInvalidPrecision},
+	}
+
+	for _, tc := range tt {
+		// Given
+		var movementsMock movementRepositoryMock
+		service := New(nil, &movementsMock, testCurrencies, &transactorMock{})
+
+		// When
+		_, err := service.Adjust(context.Background(), movement.Adjustment{Type: movement.AdjustmentInMov,
+			Amount: decimal.RequireFromString(tc.Amount), CurrencyName: "ARS", UserID: 1, Reason: tc.Reason, ActorID: 3})
+
+		// Then
+		require.EqualError(t, err, tc.Expected.Error(), tc.TestName)
+		movementsMock.AssertNotCalled(t, "Adjust", mock.Anything)
+	}
 }
 
 type userRepositoryMock struct {
@@ -199,14 +754,24 @@ func (u *userRepositoryMock) Get(ctx context.Context, id int64) (user.User, erro
 	return args.Get(0).(user.User), args.Error(1)
 }
 
-func (u *userRepositoryMock) Delete(ctx context.Context, id int64) error {
+func (u *userRepositoryMock) GetByAlias(ctx context.Context, alias string) (user.User, error) {
 	args := u.Called()
+	return args.Get(0).(user.User), args.Error(1)
+}
+
+func (u *userRepositoryMock) Search(ctx context.Context, text string, limit, offset uint64) ([]user.User, error) {
+	args := u.Called(text, limit, offset)
+	return args.Get(0).([]user.User), args.Error(1)
+}
+
+func (u *userRepositoryMock) SetFrozen(ctx context.Context, id int64, frozen bool) error {
+	args := u.Called(id, frozen)
 	return args.Error(0)
 }
 
-func (m *movementRepositoryMock) Save(ctx context.Context, movement movement.Movement) (int64, error) {
+func (m *movementRepositoryMock) Save(ctx context.Context, mov movement.Movement) (movement.Movement, error) {
 	args := m.Called()
-	return args.Get(0).(int64), args.Error(1)
+	return args.Get(0).(movement.Movement), args.Error(1)
 }
 
 func (m *movementRepositoryMock) InitSave(ctx context.Context, movement movement.Movement) error {
@@ -214,13 +779,287 @@ func (m *movementRepositoryMock) InitSave(ctx context.Context, movement movement
 	return args.Error(0)
 }
 
-func (m *movementRepositoryMock) Search(ctx context.Context, userID int64, limit, offset uint64, movType,
-	currencyName string) ([]movement.Row, error) {
-	args := m.Called()
-	return args.Get(0).([]movement.Row), args.Error(1)
+func (m *movementRepositoryMock) Search(ctx context.Context, filter movement.Filter) (movement.Page, error) {
+	args := m.Called(filter)
+	return args.Get(0).(movement.Page), args.Error(1)
 }
 
 func (m *movementRepositoryMock) GetAccountExtract(ctx context.Context, id int64) (movement.AccountExtract, error) {
 	args := m.Called()
 	return args.Get(0).(movement.AccountExtract), args.Error(1)
 }
+
+func (m *movementRepositoryMock) Transfer(ctx context.Context, transfer movement.Transfer) (movement.Transfer, error) {
+	args := m.Called()
+	return args.Get(0).(movement.Transfer), args.Error(1)
+}
+
+func (m *movementRepositoryMock) Exchange(ctx context.Context, exchange movement.Exchange) (movement.Exchange, error) {
+	args := m.Called(exchange)
+	return args.Get(0).(movement.Exchange), args.Error(1)
+}
+
+func (m *movementRepositoryMock) Adjust(ctx context.Context, adjustment movement.Adjustment) (movement.Adjustment, error) {
+	args := m.Called(adjustment)
+	return args.Get(0).(movement.Adjustment), args.Error(1)
+}
+
+type auditRepositoryMock struct {
+	mock.Mock
+}
+
+func (a *auditRepositoryMock) Save(ctx context.Context, event audit.Event) (int64, error) {
+	args := a.Called(event)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (a *auditRepositoryMock) Search(ctx context.Context, filter audit.Filter) ([]audit.Event, error) {
+	args := a.Called(filter)
+	return args.Get(0).([]audit.Event), args.Error(1)
+}
+
+func TestService_CreateAPIKey_ok(t *testing.T) {
+	// Given
+	var userMock userRepositoryMock
+	userMock.On("Get").Return(user.User{ID: 7}, nil).Once()
+	var keys apiKeyRepositoryMock
+	var saved auth.APIKey
+	keys.On("Save", mock.MatchedBy(func(key auth.APIKey) bool {
+		saved = key
+		return key.UserID == 7
+	})).Return(int64(5), nil).Once()
+	var events auditRepositoryMock
+	events.On("Save", mock.MatchedBy(func(event audit.Event) bool {
+		return event.ActorID == 3 && event.Action == audit.ActionAPIKeyCreated && event.TargetType == audit.TargetAPIKey &&
+			event.TargetID == 5 && string(event.After) == `{"id":5,"userid":7,"scopes":["admin"]}`
+	})).Return(int64(1), nil).Once()
+	var transactor transactorMock
+	service := New(&userMock, nil, testCurrencies, &transactor, WithAuditLog(&events), WithAPIKeys(&keys))
+	ctx := auth.NewContext(context.Background(), auth.Identity{UserID: 3, Scopes: []string{auth.ScopeAdmin}})
+
+	// When
+	key, err := service.CreateAPIKey(ctx, 7, []string{auth.ScopeAdmin})
+
+	// Then
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(key, "lw_"))
+	require.Equal(t, auth.HashKey(key), saved.Hash)
+	require.Equal(t, 1, transactor.committed)
+	events.AssertExpectations(t)
+}
+
+func TestService_CreateAPIKey_Errors(t *testing.T) {
+	// Given
+	var userMock userRepositoryMock
+	userMock.On("Get").Return(user.User{}, user.ErrorUserNotFound).Once()
+	var keys apiKeyRepositoryMock
+	service := New(&userMock, nil, testCurrencies, &transactorMock{}, WithAPIKeys(&keys))
+
+	// When
+	_, err := service.CreateAPIKey(context.Background(), 7, nil)
+
+	// Then
+	require.EqualError(t, err, user.ErrorUserNotFound.Error())
+	keys.AssertNotCalled(t, "Save", mock.Anything)
+
+	_, err = New(&userMock, nil, testCurrencies, &transactorMock{}).CreateAPIKey(context.Background(), 7, nil)
+	require.EqualError(t, err, ErrorAPIKeysUnavailable.Error())
+}
+
+type apiKeyRepositoryMock struct {
+	mock.Mock
+}
+
+func (k *apiKeyRepositoryMock) Save(ctx context.Context, key auth.APIKey) (int64, error) {
+	args := k.Called(key)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (k *apiKeyRepositoryMock) GetByHash(ctx context.Context, hash string) (auth.APIKey, error) {
+	args := k.Called(hash)
+	return args.Get(0).(auth.APIKey), args.Error(1)
+}
+
+func TestService_CreateWebhook_ok(t *testing.T) {
+	// Given
+	var userMock userRepositoryMock
+	userMock.On("Get").Return(user.User{ID: 1}, nil).Once()
+	var webhooks webhookRepositoryMock
+	var saved webhook.Webhook
+	webhooks.On("Save", mock.MatchedBy(func(hook webhook.Webhook) bool {
+		saved = hook
+		return hook.UserID == 1 && hook.URL == "https://partner.test/hooks"
+	})).Return(int64(4), nil).Once()
+	webhooks.On("Get", int64(4)).Return(webhook.Webhook{ID: 4, UserID: 1, URL: "https://partner.test/hooks"}, nil).Once()
+	var events auditRepositoryMock
+	events.On("Save", mock.MatchedBy(func(event audit.Event) bool {
+		return event.Action == audit.ActionWebhookCreated && !strings.Contains(string(event.After), "whsec_")
+	})).Return(int64(1), nil).Once()
+	var transactor transactorMock
+	service := New(&userMock, &movementRepositoryMock{}, testCurrencies, &transactor, WithAuditLog(&events),
+		WithWebhooks(&webhooks))
+	service.resolver = testResolver
+
+	// When
+	hook, err := service.CreateWebhook(context.Background(), webhook.Webhook{UserID: 1, URL: "https://partner.test/hooks",
+		Secret: "chosen"})
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, int64(4), hook.ID)
+	require.True(t, strings.HasPrefix(hook.Secret, "whsec_"))
+	require.Equal(t, saved.Secret, hook.Secret)
+	require.Equal(t, 1, transactor.committed)
+	events.AssertExpectations(t)
+}
+
+func TestService_CreateWebhook_Errors(t *testing.T) {
+	tt := []struct {
+		TestName, URL string
+		UserError     error
+		Expected      error
+	}{
+		{"NotHTTP", "ftp://partner.test/hooks", nil, webhook.ErrorInvalidURL},
+		{"Relative", "/hooks", nil, webhook.ErrorInvalidURL},
+		{"Unresolvable", "https://unknown.test/hooks", nil, webhook.ErrorUnresolvableHost},
+		{"Loopback", "http://localhost:8080/hooks", nil, webhook.ErrorForbiddenAddress},
+		{"Private", "http://10.0.0.5/hooks", nil, webhook.ErrorForbiddenAddress},
+		{"LinkLocal", "http://169.254.169.254/latest/meta-data", nil, webhook.ErrorForbiddenAddress},
+		{"Unspecified", "http://[::]/hooks", nil, webhook.ErrorForbiddenAddress},
+		{"ResolvesToPrivate", "https://internal.test/hooks", nil, webhook.ErrorForbiddenAddress},
+		{"UserNotFound", "https://partner.test/hooks", user.ErrorUserNotFound, user.ErrorUserNotFound},
+	}
+
+	for _, tc := range tt {
+		// Given
+		var userMock userRepositoryMock
+		userMock.On("Get").Return(user.User{}, tc.UserError)
+		var webhooks webhookRepositoryMock
+		service := New(&userMock, &movementRepositoryMock{}, testCurrencies, &transactorMock{}, WithWebhooks(&webhooks))
+		service.resolver = testResolver
+
+		// When
+		_, err := service.CreateWebhook(context.Background(), webhook.Webhook{UserID: 1, URL: tc.URL})
+
+		// Then
+		require.EqualError(t, err, tc.Expected.Error(), tc.TestName)
+		webhooks.AssertNotCalled(t, "Save", mock.Anything)
+	}
+}
+
+// testResolver resolves the hosts of the webhook tests without a DNS server, the IP addresses to themselves
+var testResolver = resolverMock{
+	"partner.test":  {{IP: net.ParseIP("203.0.113.10")}},
+	"internal.test": {{IP: net.ParseIP("203.0.113.11")}, {IP: net.ParseIP("192.168.1.20")}},
+	"localhost":     {{IP: net.ParseIP("127.0.0.1")}},
+}
+
+type resolverMock map[string][]net.IPAddr
+
+func (r resolverMock) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+
+	addresses, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return addresses, nil
+}
+
+func TestService_WebhookDeliveries_When_NoWebhooks_Then_ReturnsError(t *testing.T) {
+	// Given
+	service := New(&userRepositoryMock{}, &movementRepositoryMock{}, testCurrencies, &transactorMock{})
+
+	// When
+	_, err := service.WebhookDeliveries(context.Background(), 4, 10, 0)
+
+	// Then
+	require.EqualError(t, err, ErrorWebhooksUnavailable.Error())
+}
+
+type webhookRepositoryMock struct {
+	mock.Mock
+}
+
+func (w *webhookRepositoryMock) Save(ctx context.Context, hook webhook.Webhook) (int64, error) {
+	args := w.Called(hook)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (w *webhookRepositoryMock) Get(ctx context.Context, id int64) (webhook.Webhook, error) {
+	args := w.Called(id)
+	return args.Get(0).(webhook.Webhook), args.Error(1)
+}
+
+func (w *webhookRepositoryMock) ListByUser(ctx context.Context, userID int64) ([]webhook.Webhook, error) {
+	args := w.Called(userID)
+	return args.Get(0).([]webhook.Webhook), args.Error(1)
+}
+
+func (w *webhookRepositoryMock) SaveDelivery(ctx context.Context, delivery webhook.Delivery) error {
+	args := w.Called(delivery)
+	return args.Error(0)
+}
+
+func (w *webhookRepositoryMock) ClaimDue(ctx context.Context, now, until time.Time, limit uint64) ([]webhook.Delivery, error) {
+	args := w.Called(now, until, limit)
+	return args.Get(0).([]webhook.Delivery), args.Error(1)
+}
+
+func (w *webhookRepositoryMock) UpdateDelivery(ctx context.Context, delivery webhook.Delivery) error {
+	args := w.Called(delivery)
+	return args.Error(0)
+}
+
+func (w *webhookRepositoryMock) Deliveries(ctx context.Context, webhookID int64, limit, offset uint64) ([]webhook.Delivery, error) {
+	args := w.Called(webhookID, limit, offset)
+	return args.Get(0).([]webhook.Delivery), args.Error(1)
+}
+
+// outboxRepositoryMock keeps the events it is asked to save
+type outboxRepositoryMock struct {
+	mock.Mock
+	saved []outbox.Event
+}
+
+func (o *outboxRepositoryMock) Save(ctx context.Context, event outbox.Event) (int64, error) {
+	o.saved = append(o.saved, event)
+	args := o.Called(event)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (o *outboxRepositoryMock) LockPending(ctx context.Context, limit uint64) ([]outbox.Event, error) {
+	args := o.Called(limit)
+	return args.Get(0).([]outbox.Event), args.Error(1)
+}
+
+func (o *outboxRepositoryMock) MarkPublished(ctx context.Context, id int64) error {
+	args := o.Called(id)
+	return args.Error(0)
+}
+
+func (o *outboxRepositoryMock) types() []string {
+	var types []string
+	for _, v := range o.saved {
+		types = append(types, v.Type)
+	}
+	return types
+}
+
+// transactorMock counts the transactions committed and rolled back
+type transactorMock struct {
+	committed, rolledBack int
+}
+
+func (t *transactorMock) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); err != nil {
+		t.rolledBack++
+		return err
+	}
+
+	t.committed++
+	return nil
+}
@@ -0,0 +1,24 @@
+package wallet
+
+import (
+	"context"
+
+	"github.com/spolia/lemon-wallet/internal/tracing"
+)
+
+// WithTracer sets the tracer of the operations, whose spans are the parents of the spans of the repositories
+func WithTracer(tracer *tracing.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = tracer
+	}
+}
+
+// trace starts the span of an operation. The function it returns ends the span with the error the operation returns,
+// and is deferred with the address of the error
+func (s *Service) trace(ctx context.Context, method string) (context.Context, func(err *error)) {
+	ctx, span := s.tracer.Start(ctx, "wallet.Service/"+method)
+	return ctx, func(err *error) {
+		span.SetError(*err)
+		span.End()
+	}
+}
@@ -0,0 +1,103 @@
+package txn
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+)
+
+type contextKey struct{}
+
+// Executor runs statements on the database or on a transaction
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Tx is a transaction begun by BeginTx. When it joins the transaction of the context, Commit and Rollback are
+// left to the caller that began it
+type Tx struct {
+	*sql.Tx
+	joined bool
+}
+
+// Commit commits the transaction unless it was joined
+func (t Tx) Commit() error {
+	if t.joined {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+// Rollback rolls the transaction back unless it was joined
+func (t Tx) Rollback() error {
+	if t.joined {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
+
+// NewContext returns a copy of the context bound to the transaction
+func NewContext(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, contextKey{}, tx)
+}
+
+// FromContext returns the transaction bound to the context
+func FromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(contextKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// BeginTx joins the transaction of the context or begins a new one
+func BeginTx(ctx context.Context, db *sql.DB) (Tx, error) {
+	if tx, ok := FromContext(ctx); ok {
+		return Tx{Tx: tx, joined: true}, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Tx{}, err
+	}
+
+	return Tx{Tx: tx}, nil
+}
+
+// Conn returns the transaction of the context, or the database when there is none
+func Conn(ctx context.Context, db *sql.DB) Executor {
+	if tx, ok := FromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// Transactor runs a function in a transaction bound to its context
+type Transactor interface {
+	Run(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type transactor struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *transactor {
+	return &transactor{db: db}
+}
+
+// Run calls fn with a context bound to a transaction, which is committed when fn succeeds and rolled back
+// otherwise. The repositories called by fn join the transaction through the context, the errors beginning and
+// committing it are classified like theirs
+func (t transactor) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := BeginTx(ctx, t.db)
+	if err != nil {
+		return dberror.Classify(err)
+	}
+	defer tx.Rollback()
+
+	if err = fn(NewContext(ctx, tx.Tx)); err != nil {
+		return err
+	}
+
+	return dberror.Classify(tx.Commit())
+}
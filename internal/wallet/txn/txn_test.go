@@ -0,0 +1,86 @@
+package txn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_Commit(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	transactor := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users(alias)VALUES (?);").WithArgs("alias").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO balances(user_id)VALUES (?);").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	// then
+	err = transactor.Run(context.Background(), func(ctx context.Context) error {
+		if _, err := Conn(ctx, db).ExecContext(ctx, "INSERT INTO users(alias)VALUES (?);", "alias"); err != nil {
+			return err
+		}
+
+		// a repository beginning its own transaction joins the one of the context
+		tx, err := BeginTx(ctx, db)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err = tx.ExecContext(ctx, "INSERT INTO balances(user_id)VALUES (?);", 1); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRun_Rollback(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	transactor := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	// then
+	err = transactor.Run(context.Background(), func(ctx context.Context) error {
+		return errors.New("fail")
+	})
+	require.EqualError(t, err, "fail")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRun_CommitDeadlock(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	transactor := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"})
+
+	// then
+	err = transactor.Run(context.Background(), func(ctx context.Context) error { return nil })
+	require.True(t, errors.Is(err, dberror.ErrorDeadlock))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
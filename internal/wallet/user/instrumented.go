@@ -0,0 +1,65 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/metrics"
+	"github.com/spolia/lemon-wallet/internal/tracing"
+)
+
+// instrumented observes the latency of each method of a repository and traces its calls
+type instrumented struct {
+	next    Repository
+	latency *metrics.Histogram
+	tracer  *tracing.Tracer
+}
+
+// Instrument returns the repository observing the latency of its methods in the histogram, labeled by repository
+// and method, and tracing each call in a span. Either of them can be nil
+func Instrument(next Repository, latency *metrics.Histogram, tracer *tracing.Tracer) Repository {
+	return instrumented{next: next, latency: latency, tracer: tracer}
+}
+
+// start starts the span of a call. The function it returns ends the span with the error the call returns and
+// observes its latency, and is deferred with the address of the error
+func (i instrumented) start(ctx context.Context, method string) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := i.tracer.Start(ctx, "user.Repository/"+method)
+	span.SetAttribute("db.system", "mysql")
+	return ctx, func(err *error) {
+		span.SetError(*err)
+		span.End()
+		i.latency.Observe(time.Since(start).Seconds(), "user", method)
+	}
+}
+
+func (i instrumented) Save(ctx context.Context, firstName, lastName, alias, email string) (_ int64, err error) {
+	ctx, end := i.start(ctx, "Save")
+	defer end(&err)
+	return i.next.Save(ctx, firstName, lastName, alias, email)
+}
+
+func (i instrumented) Get(ctx context.Context, id int64) (_ User, err error) {
+	ctx, end := i.start(ctx, "Get")
+	defer end(&err)
+	return i.next.Get(ctx, id)
+}
+
+func (i instrumented) GetByAlias(ctx context.Context, alias string) (_ User, err error) {
+	ctx, end := i.start(ctx, "GetByAlias")
+	defer end(&err)
+	return i.next.GetByAlias(ctx, alias)
+}
+
+func (i instrumented) Search(ctx context.Context, text string, limit, offset uint64) (_ []User, err error) {
+	ctx, end := i.start(ctx, "Search")
+	defer end(&err)
+	return i.next.Search(ctx, text, limit, offset)
+}
+
+func (i instrumented) SetFrozen(ctx context.Context, id int64, frozen bool) (err error) {
+	ctx, end := i.start(ctx, "SetFrozen")
+	defer end(&err)
+	return i.next.SetFrozen(ctx, id, frozen)
+}
@@ -3,27 +3,28 @@ package user
 import (
 	"context"
 	"database/sql"
+	"log/slog"
+	"strings"
 
-	"github.com/go-sql-driver/mysql"
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
 )
 
 type repository struct {
-	db *sql.DB
+	db     *sql.DB
+	logger *slog.Logger
 }
 
-func New(db *sql.DB) *repository {
-	return &repository{db: db}
+func New(db *sql.DB, logger *slog.Logger) *repository {
+	return &repository{db: db, logger: logger}
 }
 
 // Save inserts a new user
 func (r repository) Save(ctx context.Context, firstName, lastName, alias, email string) (int64, error) {
-	result, err := r.db.ExecContext(ctx, "INSERT INTO users(first_name,last_name,alias,email)VALUES (?,?,?,?);",
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, "INSERT INTO users(first_name,last_name,alias,email)VALUES (?,?,?,?);",
 		firstName, lastName, alias, email)
 	if err != nil {
-		if err.(*mysql.MySQLError).Number == 1062 {
-			return 0, ErrorAlreadyExist
-		}
-		return 0, err
+		return 0, r.saveError(ctx, err)
 	}
 
 	userID, err := result.LastInsertId()
@@ -34,33 +35,92 @@ func (r repository) Save(ctx context.Context, firstName, lastName, alias, email
 	return userID, nil
 }
 
-// Delete deletest an user
-func (r repository) Delete(ctx context.Context, id int64) error {
-	result, err := r.db.ExecContext(ctx, "DELETE FROM users Where id = ?;", id)
-	if err != nil {
-		return err
+// saveError translates the duplicate alias or email, and logs the errors it cannot translate. The other classified
+// errors, e.g. a deadlock, are returned classified so the handlers can answer them
+func (r repository) saveError(ctx context.Context, err error) error {
+	classified, ok := dberror.As(err)
+	if ok && classified.Class == dberror.ErrorDuplicate {
+		switch classified.Key {
+		case "alias_UNIQUE":
+			return ErrorAliasAlreadyExist
+		case "email_UNIQUE":
+			return ErrorEmailAlreadyExist
+		}
+		return ErrorAlreadyExist
 	}
 
-	if _, err = result.RowsAffected(); err != nil {
+	if !ok {
+		r.logger.ErrorContext(ctx, "user: save failed", "error", err)
 		return err
 	}
 
-	return nil
+	r.logger.ErrorContext(ctx, "user: save failed", "error", err, "mysql_error", classified.Number())
+	return classified
 }
 
 // Get returns a user
 func (r repository) Get(ctx context.Context, id int64) (User, error) {
-	row := r.db.QueryRowContext(ctx, "SELECT * FROM users Where id = ?;", id)
+	return r.getBy(ctx, "SELECT id, first_name, last_name, alias, email, frozen FROM users Where id = ?;", id)
+}
+
+// GetByAlias returns the user registered with the given alias
+func (r repository) GetByAlias(ctx context.Context, alias string) (User, error) {
+	return r.getBy(ctx, "SELECT id, first_name, last_name, alias, email, frozen FROM users Where alias = ?;", alias)
+}
+
+// Search returns a page of the users whose alias, email or name contain the text, all of them when it is empty
+func (r repository) Search(ctx context.Context, text string, limit, offset uint64) ([]User, error) {
+	query := "SELECT id, first_name, last_name, alias, email, frozen FROM users"
+	var args []interface{}
+	if text != "" {
+		pattern := "%" + likeEscaper.Replace(text) + "%"
+		query += " WHERE alias LIKE ? OR email LIKE ? OR first_name LIKE ? OR last_name LIKE ?"
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query+" ORDER BY id LIMIT ? OFFSET ?;", append(args, limit, offset)...)
+	if err != nil {
+		return nil, dberror.Classify(err)
+	}
+	defer rows.Close()
+
+	var users = make([]User, 0)
+	for rows.Next() {
+		var user User
+		if err = rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Alias, &user.Email, &user.Frozen); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dberror.Classify(err)
+	}
+
+	return users, nil
+}
+
+// SetFrozen freezes or unfreezes the wallet of a user
+func (r repository) SetFrozen(ctx context.Context, id int64, frozen bool) error {
+	_, err := txn.Conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET frozen = ? WHERE id = ?;", frozen, id)
+	return dberror.Classify(err)
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, so the searched text matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (r repository) getBy(ctx context.Context, query string, arg interface{}) (User, error) {
+	row := txn.Conn(ctx, r.db).QueryRowContext(ctx, query, arg)
 	if row.Err() != nil {
-		return User{}, row.Err()
+		return User{}, dberror.Classify(row.Err())
 	}
 
 	var user User
-	if err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Alias, &user.Email); err != nil {
+	if err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Alias, &user.Email, &user.Frozen); err != nil {
 		if err == sql.ErrNoRows {
 			return User{}, ErrorUserNotFound
 		}
-		return User{}, err
+		return User{}, dberror.Classify(err)
 	}
 
 	return user, nil
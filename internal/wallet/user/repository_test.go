@@ -5,17 +5,20 @@ import (
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-sql-driver/mysql"
+	"github.com/spolia/lemon-wallet/internal/logging"
 	"github.com/stretchr/testify/require"
 	"testing"
 )
 
+var userColumns = []string{"id", "first_name", "last_name", "alias", "email", "frozen"}
+
 func TestSave_ok(t *testing.T) {
 	// Given
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		require.NoError(t, err)
 	}
-	repository := New(db)
+	repository := New(db, logging.Discard())
 	defer db.Close()
 
 	input := User{
@@ -41,7 +44,7 @@ func TestSave_Fail(t *testing.T) {
 	if err != nil {
 		require.NoError(t, err)
 	}
-	repository := New(db)
+	repository := New(db, logging.Discard())
 	defer db.Close()
 
 	input := User{
@@ -63,58 +66,165 @@ func TestSave_Fail(t *testing.T) {
 	require.Equal(t, int64(0), id)
 }
 
-func TestDelete_Ok(t *testing.T) {
+func TestSave_DuplicateField(t *testing.T) {
+	tt := []struct {
+		TestName, Message string
+		ExpectedError     error
+	}{
+		{"Alias", "Duplicate entry 'alias' for key 'users.alias_UNIQUE'", ErrorAliasAlreadyExist},
+		{"Email", "Duplicate entry 'email' for key 'email_UNIQUE'", ErrorEmailAlreadyExist},
+	}
+
+	for _, tc := range tt {
+		// Given
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		require.NoError(t, err)
+		repository := New(db, logging.Discard())
+
+		// When
+		mock.ExpectExec("INSERT INTO users(first_name,last_name,alias,email)VALUES (?,?,?,?);").
+			WithArgs("name", "lastname", "alias", "email").
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: tc.Message})
+
+		// then
+		_, err = repository.Save(context.Background(), "name", "lastname", "alias", "email")
+		require.Equal(t, tc.ExpectedError, err, tc.TestName)
+		require.True(t, errors.Is(err, ErrorAlreadyExist), tc.TestName)
+		db.Close()
+	}
+}
+
+func TestSave_NotMySQLError(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	repository := New(db, logging.Discard())
+	defer db.Close()
+
+	// When
+	mock.ExpectExec("INSERT INTO users(first_name,last_name,alias,email)VALUES (?,?,?,?);").
+		WithArgs("name", "lastname", "alias", "email").WillReturnError(context.Canceled)
+
+	// then
+	id, err := repository.Save(context.Background(), "name", "lastname", "alias", "email")
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, int64(0), id)
+}
+
+func TestGet_Ok(t *testing.T) {
 	// Given
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		require.NoError(t, err)
 	}
-	repository := New(db)
+	repository := New(db, logging.Discard())
 	defer db.Close()
 
 	// When
-	mock.ExpectExec("DELETE FROM users Where id = ?;").
-		WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT id, first_name, last_name, alias, email, frozen FROM users Where id = ?;").
+		WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows(userColumns).
+		AddRow(1, "maria", "garcia", "alias", "@gmail", false))
 
 	// then
-	err = repository.Delete(context.Background(), 1)
+	userResponse, err := repository.Get(context.Background(), int64(1))
 	require.NoError(t, err)
+	require.NotEmpty(t, userResponse)
 }
 
-func TestDelete_Fail(t *testing.T) {
+func TestGetByAlias_Ok(t *testing.T) {
 	// Given
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		require.NoError(t, err)
 	}
-	repository := New(db)
+	repository := New(db, logging.Discard())
 	defer db.Close()
 
 	// When
-	mock.ExpectExec("DELETE FROM users Where id = ?;").
-		WithArgs(int64(1)).WillReturnError(errors.New("database error"))
+	mock.ExpectQuery("SELECT id, first_name, last_name, alias, email, frozen FROM users Where alias = ?;").
+		WithArgs("alias").WillReturnRows(sqlmock.NewRows(userColumns).
+		AddRow(1, "maria", "garcia", "alias", "@gmail", false))
 
 	// then
-	err = repository.Delete(context.Background(), 1)
-	require.Error(t, err)
+	userResponse, err := repository.GetByAlias(context.Background(), "alias")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), userResponse.ID)
 }
 
-func TestGet_Ok(t *testing.T) {
+func TestGetByAlias_NotFound(t *testing.T) {
 	// Given
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		require.NoError(t, err)
 	}
-	repository := New(db)
+	repository := New(db, logging.Discard())
 	defer db.Close()
 
 	// When
-	mock.ExpectQuery("SELECT * FROM users Where id = ?;").
-		WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"id","first_name","last_name","alias","email"}).
-			AddRow(1,"maria","garcia","alias","@gmail"))
+	mock.ExpectQuery("SELECT id, first_name, last_name, alias, email, frozen FROM users Where alias = ?;").
+		WithArgs("alias").WillReturnRows(sqlmock.NewRows(userColumns))
 
 	// then
-	userResponse, err := repository.Get(context.Background(), int64(1))
+	userResponse, err := repository.GetByAlias(context.Background(), "alias")
+	require.EqualError(t, err, ErrorUserNotFound.Error())
+	require.Empty(t, userResponse)
+}
+
+func TestSearch_Ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, logging.Discard())
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT id, first_name, last_name, alias, email, frozen FROM users "+
+		"WHERE alias LIKE ? OR email LIKE ? OR first_name LIKE ? OR last_name LIKE ? ORDER BY id LIMIT ? OFFSET ?;").
+		WithArgs(`%ma\_ria%`, `%ma\_ria%`, `%ma\_ria%`, `%ma\_ria%`, uint64(10), uint64(20)).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(1, "ma_ria", "garcia", "alias", "@gmail", true))
+
+	// then
+	users, err := repository.Search(context.Background(), "ma_ria", 10, 20)
 	require.NoError(t, err)
-	require.NotEmpty(t, userResponse)
+	require.Equal(t, []User{{ID: 1, FirstName: "ma_ria", LastName: "garcia", Alias: "alias", Email: "@gmail", Frozen: true}}, users)
+}
+
+func TestSearch_All(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, logging.Discard())
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT id, first_name, last_name, alias, email, frozen FROM users ORDER BY id LIMIT ? OFFSET ?;").
+		WithArgs(uint64(10), uint64(0)).WillReturnRows(sqlmock.NewRows(userColumns))
+
+	// then
+	users, err := repository.Search(context.Background(), "", 10, 0)
+	require.NoError(t, err)
+	require.Empty(t, users)
+}
+
+func TestSetFrozen_Ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db, logging.Discard())
+	defer db.Close()
+
+	// When
+	mock.ExpectExec("UPDATE users SET frozen = ? WHERE id = ?;").
+		WithArgs(true, int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// then
+	err = repository.SetFrozen(context.Background(), 1, true)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
 }
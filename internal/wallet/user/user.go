@@ -3,23 +3,34 @@ package user
 import (
 	"context"
 	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
 )
 
 var ErrorUserNotFound = errors.New("user: not found")
 var ErrorAlreadyExist = errors.New("user: already exist")
 
+// ErrorAliasAlreadyExist and ErrorEmailAlreadyExist tell which unique field is taken. Both are ErrorAlreadyExist
+var (
+	ErrorAliasAlreadyExist = fmt.Errorf("%w with the same alias", ErrorAlreadyExist)
+	ErrorEmailAlreadyExist = fmt.Errorf("%w with the same email", ErrorAlreadyExist)
+)
+
 type Repository interface {
 	Save(ctx context.Context, firstName, lastName, alias, email string) (int64, error)
 	Get(ctx context.Context, id int64) (User, error)
-	Delete(ctx context.Context, id int64) error
+	GetByAlias(ctx context.Context, alias string) (User, error)
+	Search(ctx context.Context, text string, limit, offset uint64) ([]User, error)
+	SetFrozen(ctx context.Context, id int64, frozen bool) error
 }
 
 type User struct {
-	ID              int64              `json:"id"`
-	FirstName       string             `json:"firstname" binding:"required"`
-	LastName        string             `json:"lastname" binding:"required"`
-	Alias           string             `json:"alias" binding:"required"`
-	Email           string             `json:"email" binding:"required"`
-	WalletStatement map[string]float64 `json:"walletstatement"`
+	ID              int64                      `json:"id"`
+	FirstName       string                     `json:"firstname" binding:"required"`
+	LastName        string                     `json:"lastname" binding:"required"`
+	Alias           string                     `json:"alias" binding:"required"`
+	Email           string                     `json:"email" binding:"required"`
+	Frozen          bool                       `json:"frozen"`
+	WalletStatement map[string]decimal.Decimal `json:"walletstatement"`
 }
-
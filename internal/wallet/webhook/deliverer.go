@@ -0,0 +1,189 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
+)
+
+const (
+	// maxAttempts is the number of attempts after which a delivery is dead
+	maxAttempts = 8
+	// baseDelay is the wait after the first failed attempt, doubled after each one up to maxDelay
+	baseDelay = 30 * time.Second
+	maxDelay  = 6 * time.Hour
+	// claimTimeout is how long the deliveries of a batch are claimed by a deliverer. It is longer than a batch takes
+	// to be sent, so the deliveries claimed by a deliverer that stopped are attempted again after it
+	claimTimeout = 10 * time.Minute
+)
+
+// Deliverer sends the due deliveries to the webhooks in batches. A failed attempt is retried with an exponential
+// backoff until maxAttempts, when the delivery is dead. The deliveries are claimed before they are sent, so several
+// deliverers can run at the same time without sending one twice and no transaction is held while waiting for the
+// webhooks
+type Deliverer struct {
+	webhooks   Repository
+	transactor txn.Transactor
+	client     *http.Client
+	batchSize  uint64
+	interval   time.Duration
+	logger     *slog.Logger
+	now        func() time.Time
+}
+
+func NewDeliverer(webhooks Repository, transactor txn.Transactor, client *http.Client, batchSize uint64, interval time.Duration,
+	logger *slog.Logger) *Deliverer {
+	return &Deliverer{webhooks: webhooks, transactor: transactor, client: client, batchSize: batchSize, interval: interval,
+		logger: logger, now: time.Now}
+}
+
+// Run sends the due deliveries every interval until the context is done. A full batch is followed by the next one
+// without waiting
+func (d *Deliverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		attempted, err := d.RunOnce(ctx)
+		if err != nil {
+			d.logger.ErrorContext(ctx, "webhook deliverer failed", "error", err)
+		}
+
+		if err == nil && uint64(attempted) == d.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce attempts a batch of due deliveries and returns how many were attempted, delivered or not. The batch is
+// claimed in a transaction, sent, and its outcome recorded in another one
+func (d *Deliverer) RunOnce(ctx context.Context) (int, error) {
+	now := d.now().UTC()
+	var deliveries []Delivery
+	err := d.transactor.Run(ctx, func(ctx context.Context) error {
+		var err error
+		deliveries, err = d.webhooks.ClaimDue(ctx, now, now.Add(claimTimeout), d.batchSize)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var attempted = make([]Delivery, 0, len(deliveries))
+	for _, v := range deliveries {
+		attempted = append(attempted, d.attempt(ctx, v))
+	}
+
+	err = d.transactor.Run(ctx, func(ctx context.Context) error {
+		for _, v := range attempted {
+			if err := d.webhooks.UpdateDelivery(ctx, v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(attempted), nil
+}
+
+// attempt sends the delivery and returns it with the outcome
+func (d *Deliverer) attempt(ctx context.Context, delivery Delivery) Delivery {
+	now := d.now().UTC()
+	delivery.Attempts++
+	delivery.LastAttemptAt = now
+
+	var err error
+	if delivery.ResponseStatus, err = d.send(ctx, delivery, now); err == nil {
+		delivery.Status, delivery.LastError = StatusDelivered, ""
+		return delivery
+	}
+
+	delivery.LastError = lastError(delivery.ResponseStatus, err)
+
+	if delivery.Attempts >= maxAttempts {
+		d.logger.ErrorContext(ctx, "webhook delivery dead", "delivery_id", delivery.ID, "attempts", delivery.Attempts, "error", err)
+		delivery.Status = StatusDead
+		return delivery
+	}
+
+	d.logger.WarnContext(ctx, "webhook delivery failed", "delivery_id", delivery.ID, "attempts", delivery.Attempts, "error", err)
+
+	delivery.NextAttemptAt = now.Add(backoff(delivery.Attempts))
+	return delivery
+}
+
+// send posts the signed payload of the delivery and returns the response status, which must be 2xx
+func (d *Deliverer) send(ctx context.Context, delivery Delivery, now time.Time) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := now.Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderEvent, delivery.EventType)
+	request.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(HeaderSignature, Sign(delivery.secret, timestamp, delivery.Payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return response.StatusCode, fmt.Errorf("webhook: unexpected response status %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+// lastError describes a failed attempt to the owner of the webhook. The error itself is only logged, since it may
+// tell about the network of the wallet
+func lastError(responseStatus int, err error) string {
+	var netError net.Error
+	switch {
+	case responseStatus != 0:
+		return fmt.Sprintf("unexpected response status %d", responseStatus)
+	case errors.Is(err, ErrorForbiddenAddress):
+		return "the url points to a forbidden address"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netError) && netError.Timeout():
+		return "the request timed out"
+	}
+
+	return "the request failed"
+}
+
+// backoff returns the wait before the next attempt of a delivery that failed the given attempts
+func backoff(attempts int) time.Duration {
+	delay := baseDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxDelay {
+		return maxDelay
+	}
+
+	return delay
+}
@@ -0,0 +1,256 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/logging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testNow = time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func TestDeliverer_RunOnce_SendsSignedPayload(t *testing.T) {
+	// Given
+	var received bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		received = Verify("whsec_1", timestamp, body, r.Header.Get(HeaderSignature)) &&
+			r.Header.Get(HeaderEvent) == "MovementCreated" && r.Header.Get(HeaderDelivery) == "9"
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	var webhooks repositoryMock
+	webhooks.On("ClaimDue", testNow, testNow.Add(claimTimeout), uint64(10)).Return([]Delivery{newDelivery(receiver.URL, 0)}, nil).Once()
+	webhooks.On("UpdateDelivery", mock.Anything).Return(nil).Once()
+	deliverer := newTestDeliverer(&webhooks)
+
+	// When
+	attempted, err := deliverer.RunOnce(context.Background())
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, 1, attempted)
+	require.True(t, received)
+	updated := webhooks.updated[0]
+	require.Equal(t, StatusDelivered, updated.Status)
+	require.Equal(t, 1, updated.Attempts)
+	require.Equal(t, http.StatusNoContent, updated.ResponseStatus)
+	require.Equal(t, testNow, updated.LastAttemptAt)
+}
+
+func TestDeliverer_RunOnce_RetriesWithBackoff(t *testing.T) {
+	// Given
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	var webhooks repositoryMock
+	webhooks.On("ClaimDue", testNow, testNow.Add(claimTimeout), uint64(10)).Return([]Delivery{newDelivery(receiver.URL, 2)}, nil).Once()
+	webhooks.On("UpdateDelivery", mock.Anything).Return(nil).Once()
+	deliverer := newTestDeliverer(&webhooks)
+
+	// When
+	_, err := deliverer.RunOnce(context.Background())
+
+	// Then
+	require.NoError(t, err)
+	updated := webhooks.updated[0]
+	require.Equal(t, StatusPending, updated.Status)
+	require.Equal(t, 3, updated.Attempts)
+	require.Equal(t, http.StatusInternalServerError, updated.ResponseStatus)
+	require.Equal(t, "unexpected response status 500", updated.LastError)
+	require.Equal(t, testNow.Add(2*time.Minute), updated.NextAttemptAt)
+}
+
+func TestDeliverer_RunOnce_DeadAfterLastAttempt(t *testing.T) {
+	// Given
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	var webhooks repositoryMock
+	webhooks.On("ClaimDue", testNow, testNow.Add(claimTimeout), uint64(10)).Return([]Delivery{newDelivery(receiver.URL, maxAttempts-1)}, nil).Once()
+	webhooks.On("UpdateDelivery", mock.Anything).Return(nil).Once()
+	deliverer := newTestDeliverer(&webhooks)
+
+	// When
+	_, err := deliverer.RunOnce(context.Background())
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, StatusDead, webhooks.updated[0].Status)
+	require.Equal(t, maxAttempts, webhooks.updated[0].Attempts)
+}
+
+func TestDeliverer_RunOnce_ForbiddenAddress(t *testing.T) {
+	// Given
+	var received bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer receiver.Close()
+
+	var webhooks repositoryMock
+	webhooks.On("ClaimDue", testNow, testNow.Add(claimTimeout), uint64(10)).Return([]Delivery{newDelivery(receiver.URL, 0)}, nil).Once()
+	webhooks.On("UpdateDelivery", mock.Anything).Return(nil).Once()
+	deliverer := newTestDeliverer(&webhooks)
+	deliverer.client = NewClient(time.Second)
+
+	// When
+	_, err := deliverer.RunOnce(context.Background())
+
+	// Then
+	require.NoError(t, err)
+	require.False(t, received)
+	updated := webhooks.updated[0]
+	require.Equal(t, StatusPending, updated.Status)
+	require.Equal(t, 0, updated.ResponseStatus)
+	require.Equal(t, "the url points to a forbidden address", updated.LastError)
+}
+
+func TestDeliverer_RunOnce_RecordsAfterClaimCommitted(t *testing.T) {
+	// Given
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	var webhooks repositoryMock
+	webhooks.On("ClaimDue", testNow, testNow.Add(claimTimeout), uint64(10)).Return([]Delivery{newDelivery(receiver.URL, 0)}, nil).Once()
+	webhooks.On("UpdateDelivery", mock.Anything).Return(nil).Once()
+	var transactor countingTransactor
+	deliverer := NewDeliverer(&webhooks, &transactor, http.DefaultClient, 10, time.Second, logging.Discard())
+	deliverer.now = func() time.Time { return testNow }
+
+	// When
+	_, err := deliverer.RunOnce(context.Background())
+
+	// Then
+	require.NoError(t, err)
+	require.Equal(t, 2, transactor.runs)
+	require.Equal(t, StatusDelivered, webhooks.updated[0].Status)
+}
+
+func TestLastError(t *testing.T) {
+	tt := []struct {
+		TestName       string
+		ResponseStatus int
+		Error          error
+		Expected       string
+	}{
+		{"Status", http.StatusBadGateway, errors.New("webhook: unexpected response status 502"), "unexpected response status 502"},
+		{"Forbidden", 0, &net.OpError{Op: "dial", Err: ErrorForbiddenAddress}, "the url points to a forbidden address"},
+		{"Timeout", 0, context.DeadlineExceeded, "the request timed out"},
+		{"Refused", 0, errors.New("dial tcp 10.0.0.5:443: connect: connection refused"), "the request failed"},
+	}
+
+	for _, tc := range tt {
+		require.Equal(t, tc.Expected, lastError(tc.ResponseStatus, tc.Error), tc.TestName)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tt := []struct {
+		Attempts int
+		Expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{20, maxDelay},
+	}
+
+	for _, tc := range tt {
+		require.Equal(t, tc.Expected, backoff(tc.Attempts), "attempts %d", tc.Attempts)
+	}
+}
+
+func newTestDeliverer(webhooks Repository) *Deliverer {
+	deliverer := NewDeliverer(webhooks, transactorMock{}, http.DefaultClient, 10, time.Second, logging.Discard())
+	deliverer.now = func() time.Time { return testNow }
+	return deliverer
+}
+
+func newDelivery(url string, attempts int) Delivery {
+	return Delivery{ID: 9, WebhookID: 4, EventID: 7, EventType: "MovementCreated", Payload: []byte(`{"id":7}`),
+		Status: StatusPending, Attempts: attempts, NextAttemptAt: testNow, url: url, secret: "whsec_1"}
+}
+
+// repositoryMock keeps the deliveries it is asked to update
+type repositoryMock struct {
+	mock.Mock
+	updated []Delivery
+	saved   []Delivery
+}
+
+func (r *repositoryMock) Save(ctx context.Context, webhook Webhook) (int64, error) {
+	args := r.Called(webhook)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (r *repositoryMock) Get(ctx context.Context, id int64) (Webhook, error) {
+	args := r.Called(id)
+	return args.Get(0).(Webhook), args.Error(1)
+}
+
+func (r *repositoryMock) ListByUser(ctx context.Context, userID int64) ([]Webhook, error) {
+	args := r.Called(userID)
+	return args.Get(0).([]Webhook), args.Error(1)
+}
+
+func (r *repositoryMock) SaveDelivery(ctx context.Context, delivery Delivery) error {
+	r.saved = append(r.saved, delivery)
+	args := r.Called(delivery)
+	return args.Error(0)
+}
+
+func (r *repositoryMock) ClaimDue(ctx context.Context, now, until time.Time, limit uint64) ([]Delivery, error) {
+	args := r.Called(now, until, limit)
+	return args.Get(0).([]Delivery), args.Error(1)
+}
+
+func (r *repositoryMock) UpdateDelivery(ctx context.Context, delivery Delivery) error {
+	r.updated = append(r.updated, delivery)
+	args := r.Called(delivery)
+	return args.Error(0)
+}
+
+func (r *repositoryMock) Deliveries(ctx context.Context, webhookID int64, limit, offset uint64) ([]Delivery, error) {
+	args := r.Called(webhookID, limit, offset)
+	return args.Get(0).([]Delivery), args.Error(1)
+}
+
+// countingTransactor counts the transactions, checking none is run inside another one
+type countingTransactor struct {
+	runs    int
+	running bool
+}
+
+func (c *countingTransactor) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	if c.running {
+		return errors.New("nested transaction")
+	}
+	c.runs++
+	c.running = true
+	defer func() { c.running = false }()
+	return fn(ctx)
+}
+
+type transactorMock struct{}
+
+func (transactorMock) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
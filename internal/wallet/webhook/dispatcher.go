@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/wallet/outbox"
+)
+
+// Dispatcher is the outbox publisher that queues a delivery of each MovementCreated event to the webhooks of its
+// user. It runs within the transaction of the relay, so the deliveries are queued only if the event is marked
+// as published
+type Dispatcher struct {
+	webhooks Repository
+	now      func() time.Time
+}
+
+func NewDispatcher(webhooks Repository) *Dispatcher {
+	return &Dispatcher{webhooks: webhooks, now: time.Now}
+}
+
+// Publish queues the deliveries of the event, due at once
+func (d *Dispatcher) Publish(ctx context.Context, event outbox.Event) error {
+	if event.Type != outbox.TypeMovementCreated {
+		return nil
+	}
+
+	webhooks, err := d.webhooks.ListByUser(ctx, event.UserID)
+	if err != nil {
+		return err
+	}
+
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range webhooks {
+		err = d.webhooks.SaveDelivery(ctx, Delivery{WebhookID: v.ID, EventID: event.ID, EventType: event.Type,
+			Payload: payload, Status: StatusPending, NextAttemptAt: d.now().UTC()})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/wallet/outbox"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcher_Publish_QueuesDeliveryPerWebhook(t *testing.T) {
+	// Given
+	var webhooks repositoryMock
+	webhooks.On("ListByUser", int64(1)).Return([]Webhook{{ID: 4, UserID: 1}, {ID: 5, UserID: 1}}, nil).Once()
+	webhooks.On("SaveDelivery", mock.Anything).Return(nil).Twice()
+	dispatcher := NewDispatcher(&webhooks)
+	dispatcher.now = func() time.Time { return testNow }
+	event := outbox.Event{ID: 7, Type: outbox.TypeMovementCreated, UserID: 1, Payload: json.RawMessage(`{"movementid":10}`)}
+
+	// When
+	err := dispatcher.Publish(context.Background(), event)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, webhooks.saved, 2)
+	require.Equal(t, int64(5), webhooks.saved[1].WebhookID)
+	require.Equal(t, int64(7), webhooks.saved[1].EventID)
+	require.Equal(t, testNow, webhooks.saved[1].NextAttemptAt)
+	require.JSONEq(t, `{"id":7,"type":"MovementCreated","userid":1,"payload":{"movementid":10},"datecreated":"0001-01-01T00:00:00Z"}`,
+		string(webhooks.saved[1].Payload))
+}
+
+func TestDispatcher_Publish_IgnoresOtherEvents(t *testing.T) {
+	// Given
+	var webhooks repositoryMock
+	dispatcher := NewDispatcher(&webhooks)
+
+	// When
+	err := dispatcher.Publish(context.Background(), outbox.Event{ID: 8, Type: outbox.TypeBalanceChanged, UserID: 1})
+
+	// Then
+	require.NoError(t, err)
+	webhooks.AssertNotCalled(t, "ListByUser", mock.Anything)
+}
@@ -0,0 +1,173 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/spolia/lemon-wallet/internal/wallet/dberror"
+	"github.com/spolia/lemon-wallet/internal/wallet/txn"
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *repository {
+	return &repository{db: db}
+}
+
+// Save stores a new webhook with its secret
+func (r repository) Save(ctx context.Context, webhook Webhook) (int64, error) {
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, "INSERT INTO webhooks(user_id,url,secret)VALUES (?,?,?);",
+		webhook.UserID, webhook.URL, webhook.Secret)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// Get returns a webhook without its secret, as seen by the transaction of the context if any
+func (r repository) Get(ctx context.Context, id int64) (Webhook, error) {
+	row := txn.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT id, user_id, url, date_created FROM webhooks WHERE id = ?;", id)
+	if row.Err() != nil {
+		return Webhook{}, row.Err()
+	}
+
+	var webhook Webhook
+	if err := row.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.DateCreated); err != nil {
+		if err == sql.ErrNoRows {
+			return Webhook{}, ErrorWebhookNotFound
+		}
+		return Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+// ListByUser returns the webhooks of a user without their secrets
+func (r repository) ListByUser(ctx context.Context, userID int64) ([]Webhook, error) {
+	rows, err := txn.Conn(ctx, r.db).QueryContext(ctx, "SELECT id, user_id, url, date_created FROM webhooks "+
+		"WHERE user_id = ? ORDER BY id;", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var webhook Webhook
+		if err = rows.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.DateCreated); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// SaveDelivery queues a pending delivery. It joins the transaction of the context, and a delivery of an event
+// already queued for the webhook is ignored, so publishing an event again does not notify it twice
+func (r repository) SaveDelivery(ctx context.Context, delivery Delivery) error {
+	_, err := txn.Conn(ctx, r.db).ExecContext(ctx, "INSERT IGNORE INTO webhook_deliveries(webhook_id,event_id,event_type,"+
+		"payload,next_attempt_at)VALUES (?,?,?,?,?);", delivery.WebhookID, delivery.EventID, delivery.EventType,
+		string(delivery.Payload), delivery.NextAttemptAt)
+	return err
+}
+
+// ClaimDue returns the pending deliveries due at now with the url and secret of their webhook, and claims them
+// until the given time by postponing their next attempt to it, so the other deliverers skip them once the
+// transaction of the context is committed. Deliveries locked by another deliverer are skipped, and the webhooks
+// are not locked so new deliveries can be queued meanwhile
+func (r repository) ClaimDue(ctx context.Context, now, until time.Time, limit uint64) ([]Delivery, error) {
+	conn := txn.Conn(ctx, r.db)
+	rows, err := conn.QueryContext(ctx, "SELECT d.id, d.webhook_id, d.event_id, d.event_type, d.payload, "+
+		"d.attempts, d.next_attempt_at, d.date_created, w.url, w.secret FROM webhook_deliveries d "+
+		"JOIN webhooks w ON w.id = d.webhook_id WHERE d.status = 'pending' AND d.next_attempt_at <= ? "+
+		"ORDER BY d.next_attempt_at, d.id LIMIT ? FOR UPDATE OF d SKIP LOCKED;", now, limit)
+	if err != nil {
+		return nil, dberror.Classify(err)
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	var ids []interface{}
+	for rows.Next() {
+		var delivery = Delivery{Status: StatusPending}
+		var payload []byte
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &payload,
+			&delivery.Attempts, &delivery.NextAttemptAt, &delivery.DateCreated, &delivery.url, &delivery.secret)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+		ids = append(ids, delivery.ID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dberror.Classify(err)
+	}
+
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+
+	_, err = conn.ExecContext(ctx, "UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id IN (?"+
+		strings.Repeat(",?", len(ids)-1)+");", append([]interface{}{until}, ids...)...)
+	if err != nil {
+		return nil, dberror.Classify(err)
+	}
+
+	return deliveries, nil
+}
+
+// UpdateDelivery records the outcome of an attempt
+func (r repository) UpdateDelivery(ctx context.Context, delivery Delivery) error {
+	_, err := txn.Conn(ctx, r.db).ExecContext(ctx, "UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, "+
+		"last_attempt_at = ?, response_status = ?, last_error = ? WHERE id = ?;", delivery.Status, delivery.Attempts,
+		delivery.NextAttemptAt, delivery.LastAttemptAt,
+		sql.NullInt64{Int64: int64(delivery.ResponseStatus), Valid: delivery.ResponseStatus != 0},
+		sql.NullString{String: delivery.LastError, Valid: delivery.LastError != ""}, delivery.ID)
+	return err
+}
+
+// Deliveries returns a page of the deliveries of a webhook, newest first
+func (r repository) Deliveries(ctx context.Context, webhookID int64, limit, offset uint64) ([]Delivery, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, webhook_id, event_id, event_type, payload, status, attempts, "+
+		"next_attempt_at, last_attempt_at, response_status, last_error, date_created FROM webhook_deliveries "+
+		"WHERE webhook_id = ? ORDER BY id DESC LIMIT ? OFFSET ?;", webhookID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries = make([]Delivery, 0)
+	for rows.Next() {
+		var delivery Delivery
+		var payload []byte
+		var lastAttemptAt sql.NullTime
+		var responseStatus sql.NullInt64
+		var lastError sql.NullString
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &payload, &delivery.Status,
+			&delivery.Attempts, &delivery.NextAttemptAt, &lastAttemptAt, &responseStatus, &lastError, &delivery.DateCreated)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload, delivery.LastAttemptAt = payload, lastAttemptAt.Time
+		delivery.ResponseStatus, delivery.LastError = int(responseStatus.Int64), lastError.String
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
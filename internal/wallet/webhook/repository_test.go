@@ -0,0 +1,177 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSave_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectExec("INSERT INTO webhooks(user_id,url,secret)VALUES (?,?,?);").
+		WithArgs(int64(1), "https://partner.test/hooks", "whsec_1").WillReturnResult(sqlmock.NewResult(4, 1))
+
+	// then
+	id, err := repository.Save(context.Background(), Webhook{UserID: 1, URL: "https://partner.test/hooks", Secret: "whsec_1"})
+	require.NoError(t, err)
+	require.Equal(t, int64(4), id)
+}
+
+func TestGet_ErrorWebhookNotFound(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	// When
+	mock.ExpectQuery("SELECT id, user_id, url, date_created FROM webhooks WHERE id = ?;").
+		WithArgs(int64(4)).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "url", "date_created"}))
+
+	// then
+	_, err = repository.Get(context.Background(), 4)
+	require.EqualError(t, err, ErrorWebhookNotFound.Error())
+}
+
+func TestSaveDelivery_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	// When
+	mock.ExpectExec("INSERT IGNORE INTO webhook_deliveries(webhook_id,event_id,event_type,payload,next_attempt_at)"+
+		"VALUES (?,?,?,?,?);").
+		WithArgs(int64(4), int64(7), "MovementCreated", `{"id":7}`, now).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// then
+	err = repository.SaveDelivery(context.Background(), Delivery{WebhookID: 4, EventID: 7, EventType: "MovementCreated",
+		Payload: json.RawMessage(`{"id":7}`), NextAttemptAt: now})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimDue_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	until := now.Add(10 * time.Minute)
+	// When
+	mock.ExpectQuery("SELECT d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts, d.next_attempt_at, "+
+		"d.date_created, w.url, w.secret FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id "+
+		"WHERE d.status = 'pending' AND d.next_attempt_at <= ? ORDER BY d.next_attempt_at, d.id LIMIT ? FOR UPDATE OF d SKIP LOCKED;").
+		WithArgs(now, uint64(10)).WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "event_id", "event_type",
+		"payload", "attempts", "next_attempt_at", "date_created", "url", "secret"}).
+		AddRow(9, 4, 7, "MovementCreated", `{"id":7}`, 2, now, now, "https://partner.test/hooks", "whsec_1").
+		AddRow(10, 4, 8, "MovementCreated", `{"id":8}`, 0, now, now, "https://partner.test/hooks", "whsec_1"))
+	mock.ExpectExec("UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id IN (?,?);").
+		WithArgs(until, int64(9), int64(10)).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	// then
+	deliveries, err := repository.ClaimDue(context.Background(), now, until, 10)
+	require.NoError(t, err)
+	require.Equal(t, []Delivery{
+		{ID: 9, WebhookID: 4, EventID: 7, EventType: "MovementCreated", Payload: json.RawMessage(`{"id":7}`),
+			Status: StatusPending, Attempts: 2, NextAttemptAt: now, DateCreated: now, url: "https://partner.test/hooks",
+			secret: "whsec_1"},
+		{ID: 10, WebhookID: 4, EventID: 8, EventType: "MovementCreated", Payload: json.RawMessage(`{"id":8}`),
+			Status: StatusPending, Attempts: 0, NextAttemptAt: now, DateCreated: now, url: "https://partner.test/hooks",
+			secret: "whsec_1"},
+	}, deliveries)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimDue_NoneDue(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	repository := New(db)
+	defer db.Close()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	// When
+	mock.ExpectQuery("SELECT d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts, d.next_attempt_at, "+
+		"d.date_created, w.url, w.secret FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id "+
+		"WHERE d.status = 'pending' AND d.next_attempt_at <= ? ORDER BY d.next_attempt_at, d.id LIMIT ? FOR UPDATE OF d SKIP LOCKED;").
+		WithArgs(now, uint64(10)).WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "event_id", "event_type",
+		"payload", "attempts", "next_attempt_at", "date_created", "url", "secret"}))
+
+	// then
+	deliveries, err := repository.ClaimDue(context.Background(), now, now.Add(10*time.Minute), 10)
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateDelivery_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	// When
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?, "+
+		"response_status = ?, last_error = ? WHERE id = ?;").
+		WithArgs(StatusDelivered, 1, now, now, int64(200), nil, int64(9)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// then
+	err = repository.UpdateDelivery(context.Background(), Delivery{ID: 9, Status: StatusDelivered, Attempts: 1,
+		NextAttemptAt: now, LastAttemptAt: now, ResponseStatus: 200})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeliveries_ok(t *testing.T) {
+	// Given
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		require.NoError(t, err)
+	}
+	repository := New(db)
+	defer db.Close()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	// When
+	mock.ExpectQuery("SELECT id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, "+
+		"last_attempt_at, response_status, last_error, date_created FROM webhook_deliveries WHERE webhook_id = ? "+
+		"ORDER BY id DESC LIMIT ? OFFSET ?;").
+		WithArgs(int64(4), uint64(10), uint64(0)).WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "event_id",
+		"event_type", "payload", "status", "attempts", "next_attempt_at", "last_attempt_at", "response_status", "last_error",
+		"date_created"}).AddRow(9, 4, 7, "MovementCreated", `{"id":7}`, StatusDead, 8, now, now, 500,
+		"unexpected response status 500", now))
+
+	// then
+	deliveries, err := repository.Deliveries(context.Background(), 4, 10, 0)
+	require.NoError(t, err)
+	require.Equal(t, []Delivery{{ID: 9, WebhookID: 4, EventID: 7, EventType: "MovementCreated", Payload: json.RawMessage(`{"id":7}`),
+		Status: StatusDead, Attempts: 8, NextAttemptAt: now, LastAttemptAt: now, ResponseStatus: 500,
+		LastError: "unexpected response status 500", DateCreated: now}}, deliveries)
+}
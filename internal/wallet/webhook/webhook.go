@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Headers of the notifications. The signature is "sha256=" followed by the hex HMAC-SHA256 of the timestamp and the
+// body joined by a dot, keyed by the secret of the webhook
+const (
+	HeaderSignature = "X-Wallet-Signature"
+	HeaderTimestamp = "X-Wallet-Timestamp"
+	HeaderEvent     = "X-Wallet-Event"
+	HeaderDelivery  = "X-Wallet-Delivery"
+)
+
+// secretPrefix tells webhook secrets apart from API keys
+const secretPrefix = "whsec_"
+
+var (
+	ErrorWebhookNotFound  = errors.New("webhook: webhook not found")
+	ErrorInvalidURL       = errors.New("webhook: the url must be an absolute http or https url")
+	ErrorUnresolvableHost = errors.New("webhook: the host of the url cannot be resolved")
+	ErrorForbiddenAddress = errors.New("webhook: the url must not point to a loopback, private, link-local or unspecified address")
+)
+
+// Resolver looks up the addresses of a host, net.DefaultResolver in production
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type Repository interface {
+	Save(ctx context.Context, webhook Webhook) (int64, error)
+	Get(ctx context.Context, id int64) (Webhook, error)
+	ListByUser(ctx context.Context, userID int64) ([]Webhook, error)
+	SaveDelivery(ctx context.Context, delivery Delivery) error
+	ClaimDue(ctx context.Context, now, until time.Time, limit uint64) ([]Delivery, error)
+	UpdateDelivery(ctx context.Context, delivery Delivery) error
+	Deliveries(ctx context.Context, webhookID int64, limit, offset uint64) ([]Delivery, error)
+}
+
+// Webhook is an endpoint notified of the movements of the wallet of a user. The secret is only returned when the
+// webhook is created
+type Webhook struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"userid" binding:"required"`
+	URL         string    `json:"url" binding:"required,max=2048"`
+	Secret      string    `json:"secret,omitempty"`
+	DateCreated time.Time `json:"datecreated"`
+}
+
+// Delivery is the notification of an outbox event to a webhook. Payload is the body sent, the JSON of the event.
+// A pending delivery is attempted at NextAttemptAt until it is delivered or, after the last attempt, dead
+type Delivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhookid"`
+	EventID        int64           `json:"eventid"`
+	EventType      string          `json:"eventtype"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"nextattemptat"`
+	LastAttemptAt  time.Time       `json:"lastattemptat"`
+	ResponseStatus int             `json:"responsestatus"`
+	LastError      string          `json:"lasterror"`
+	DateCreated    time.Time       `json:"datecreated"`
+
+	// url and secret of the webhook, read with the due deliveries to send them
+	url, secret string
+}
+
+// ValidateURL checks the url of a webhook is absolute and http or https, and that none of the addresses of its host
+// is internal, so the webhooks cannot be used to reach the network of the wallet. The addresses are checked again
+// when the notifications are sent, see NewClient, since the host may resolve differently by then
+func ValidateURL(ctx context.Context, resolver Resolver, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return ErrorInvalidURL
+	}
+
+	addresses, err := resolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil || len(addresses) == 0 {
+		return ErrorUnresolvableHost
+	}
+
+	for _, v := range addresses {
+		if forbidden(v.IP) {
+			return ErrorForbiddenAddress
+		}
+	}
+
+	return nil
+}
+
+// NewClient returns the client the notifications are sent with. It refuses to connect to the internal addresses,
+// including the ones reached through a redirect, and ignores the proxy of the environment
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+
+		if ip := net.ParseIP(host); ip == nil || forbidden(ip) {
+			return ErrorForbiddenAddress
+		}
+
+		return nil
+	}}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+	}
+}
+
+// forbidden tells whether the address is internal
+func forbidden(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// NewSecret returns a random secret to sign the notifications of a webhook
+func NewSecret() (string, error) {
+	var secret = make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return secretPrefix + hex.EncodeToString(secret), nil
+}
+
+// Sign returns the signature of a notification body sent at the timestamp, in unix seconds
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify tells whether the signature of a notification is valid, for the receivers of the webhooks
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,8 @@
+package migrations
+
+import "embed"
+
+// MySQL holds the numbered migrations of the mysql schema
+//
+//go:embed mysql/*.sql
+var MySQL embed.FS
@@ -0,0 +1,137 @@
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `first_name` VARCHAR(45) NOT NULL,
+  `last_name` VARCHAR(45) NOT NULL,
+  `alias` VARCHAR(45) NOT NULL,
+  `email` VARCHAR(45) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `alias_UNIQUE` (`alias` ASC),
+  UNIQUE INDEX `email_UNIQUE` (`email` ASC));
+
+CREATE TABLE IF NOT EXISTS `currencies` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(20) NOT NULL,
+  `digits` TINYINT UNSIGNED NOT NULL,
+  `movements_table` VARCHAR(64) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `name_UNIQUE` (`name` ASC));
+
+INSERT IGNORE INTO `currencies` (`name`, `digits`, `movements_table`) VALUES
+  ('ARS', 2, 'movements_ars'),
+  ('BTC', 8, 'movements_btc'),
+  ('USDT', 2, 'movements_usdt');
+
+CREATE TABLE IF NOT EXISTS `exchanges` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `user_id` BIGINT NOT NULL,
+  `from_currency` VARCHAR(20) NOT NULL,
+  `to_currency` VARCHAR(20) NOT NULL,
+  `from_amount` DECIMAL(18,8) NOT NULL,
+  `to_amount` DECIMAL(18,8) NOT NULL,
+  `rate` DECIMAL(30,12) NOT NULL,
+  `date_created` DATETIME NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (`id`),
+  INDEX `user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_exchanges_user_id`
+      FOREIGN KEY (`user_id`)
+          REFERENCES `users` (`id`)
+          ON DELETE CASCADE
+          ON UPDATE CASCADE);
+
+CREATE TABLE IF NOT EXISTS `movements_btc` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `mov_type` ENUM("deposit", "extract","init","transfer_in","transfer_out","exchange_in","exchange_out") NOT NULL,
+  `currency_name` VARCHAR(20) NOT NULL DEFAULT 'BTC',
+  `date_created` DATETIME NOT NULL DEFAULT current_timestamp,
+  `tx_amount` DECIMAL(18,8) ZEROFILL NOT NULL,
+  `total_amount` DECIMAL(18,8) ZEROFILL NOT NULL,
+  `user_id` BIGINT NOT NULL,
+  `exchange_id` BIGINT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `user_id_idx` (`user_id` ASC),
+  INDEX `exchange_id_idx` (`exchange_id` ASC),
+  CONSTRAINT `fk_btc_user_id`
+      FOREIGN KEY (`user_id`)
+          REFERENCES `users` (`id`)
+          ON DELETE CASCADE
+          ON UPDATE CASCADE,
+  CONSTRAINT `fk_btc_exchange_id`
+      FOREIGN KEY (`exchange_id`)
+          REFERENCES `exchanges` (`id`));
+
+CREATE TABLE IF NOT EXISTS `movements_usdt` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `mov_type` ENUM("deposit", "extract","init","transfer_in","transfer_out","exchange_in","exchange_out") NOT NULL,
+  `currency_name` VARCHAR(20) NOT NULL DEFAULT 'USDT',
+  `date_created` DATETIME NOT NULL DEFAULT current_timestamp,
+  `tx_amount` DECIMAL(18,2) ZEROFILL NOT NULL,
+  `total_amount` DECIMAL(18,2) ZEROFILL NOT NULL,
+  `user_id` BIGINT NOT NULL,
+  `exchange_id` BIGINT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `user_id_idx` (`user_id` ASC),
+  INDEX `exchange_id_idx` (`exchange_id` ASC),
+  CONSTRAINT `fk_usdt_user_id`
+      FOREIGN KEY (`user_id`)
+          REFERENCES `users` (`id`)
+          ON DELETE CASCADE
+          ON UPDATE CASCADE,
+  CONSTRAINT `fk_usdt_exchange_id`
+      FOREIGN KEY (`exchange_id`)
+          REFERENCES `exchanges` (`id`));
+
+CREATE TABLE IF NOT EXISTS `movements_ars` (
+   `id` BIGINT NOT NULL AUTO_INCREMENT,
+   `mov_type` ENUM("deposit", "extract","init","transfer_in","transfer_out","exchange_in","exchange_out") NOT NULL,
+   `currency_name` VARCHAR(20) NOT NULL DEFAULT 'ARS',
+   `date_created` DATETIME NOT NULL DEFAULT current_timestamp,
+   `tx_amount` DECIMAL(18,2) ZEROFILL NOT NULL,
+   `total_amount` DECIMAL(18,2) ZEROFILL NOT NULL,
+   `user_id` BIGINT NOT NULL,
+   `exchange_id` BIGINT NULL,
+   PRIMARY KEY (`id`),
+   INDEX `user_id_idx` (`user_id` ASC),
+   INDEX `exchange_id_idx` (`exchange_id` ASC),
+   CONSTRAINT `fk_ars_user_id`
+       FOREIGN KEY (`user_id`)
+           REFERENCES `users` (`id`)
+           ON DELETE CASCADE
+           ON UPDATE CASCADE,
+   CONSTRAINT `fk_ars_exchange_id`
+       FOREIGN KEY (`exchange_id`)
+           REFERENCES `exchanges` (`id`));
+
+CREATE TABLE IF NOT EXISTS `idempotency_keys` (
+  `idempotency_key` VARCHAR(255) NOT NULL,
+  `request_hash` CHAR(64) NOT NULL,
+  `status_code` INT NOT NULL DEFAULT 0,
+  `response_body` TEXT NULL,
+  `date_created` DATETIME NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (`idempotency_key`));
+
+CREATE TABLE IF NOT EXISTS `balances` (
+  `user_id` BIGINT NOT NULL,
+  `currency_name` VARCHAR(20) NOT NULL,
+  `amount` DECIMAL(18,8) UNSIGNED NOT NULL DEFAULT 0,
+  PRIMARY KEY (`user_id`, `currency_name`),
+  CONSTRAINT `fk_balances_user_id`
+      FOREIGN KEY (`user_id`)
+          REFERENCES `users` (`id`)
+          ON DELETE CASCADE
+          ON UPDATE CASCADE);
+
+-- Balances are computed by the application while holding a lock on the balances row (see movement/ledger.go).
+-- Databases created with the former BEFORE INSERT triggers must drop them and load the balances from the latest movements.
+DROP TRIGGER IF EXISTS `movements_usdt_BEFORE_INSERT`;
+DROP TRIGGER IF EXISTS `movements_btc_BEFORE_INSERT`;
+DROP TRIGGER IF EXISTS `movements_ars_BEFORE_INSERT`;
+
+INSERT IGNORE INTO `balances` (`user_id`, `currency_name`, `amount`)
+SELECT m.user_id, 'USDT', m.total_amount FROM `movements_usdt` m
+WHERE m.id = (SELECT max(id) FROM `movements_usdt` WHERE user_id = m.user_id)
+UNION ALL
+SELECT m.user_id, 'BTC', m.total_amount FROM `movements_btc` m
+WHERE m.id = (SELECT max(id) FROM `movements_btc` WHERE user_id = m.user_id)
+UNION ALL
+SELECT m.user_id, 'ARS', m.total_amount FROM `movements_ars` m
+WHERE m.id = (SELECT max(id) FROM `movements_ars` WHERE user_id = m.user_id);
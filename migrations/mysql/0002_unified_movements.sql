@@ -0,0 +1,64 @@
+-- Databases created with the baseline scheme have the per-currency tables without the exchange_id column, which
+-- 0001 leaves unchanged, so the column is added to them before their rows are copied.
+SET @add_exchange_id = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE()
+  AND table_name = 'movements_ars' AND column_name = 'exchange_id') = 0,
+  'ALTER TABLE `movements_ars` ADD COLUMN `exchange_id` BIGINT NULL', 'DO 0');
+PREPARE add_exchange_id FROM @add_exchange_id;
+EXECUTE add_exchange_id;
+DEALLOCATE PREPARE add_exchange_id;
+
+SET @add_exchange_id = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE()
+  AND table_name = 'movements_btc' AND column_name = 'exchange_id') = 0,
+  'ALTER TABLE `movements_btc` ADD COLUMN `exchange_id` BIGINT NULL', 'DO 0');
+PREPARE add_exchange_id FROM @add_exchange_id;
+EXECUTE add_exchange_id;
+DEALLOCATE PREPARE add_exchange_id;
+
+SET @add_exchange_id = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE()
+  AND table_name = 'movements_usdt' AND column_name = 'exchange_id') = 0,
+  'ALTER TABLE `movements_usdt` ADD COLUMN `exchange_id` BIGINT NULL', 'DO 0');
+PREPARE add_exchange_id FROM @add_exchange_id;
+EXECUTE add_exchange_id;
+DEALLOCATE PREPARE add_exchange_id;
+
+-- All the currencies share a single movements table, so a new currency only needs its row in currencies.
+CREATE TABLE IF NOT EXISTS `movements` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `mov_type` ENUM("deposit", "extract","init","transfer_in","transfer_out","exchange_in","exchange_out") NOT NULL,
+  `currency_name` VARCHAR(20) NOT NULL,
+  `date_created` DATETIME NOT NULL DEFAULT current_timestamp,
+  `tx_amount` DECIMAL(18,8) NOT NULL,
+  `total_amount` DECIMAL(18,8) NOT NULL,
+  `user_id` BIGINT NOT NULL,
+  `exchange_id` BIGINT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `user_id_date_created_idx` (`user_id` ASC, `date_created` ASC, `id` ASC),
+  INDEX `exchange_id_idx` (`exchange_id` ASC),
+  INDEX `currency_name_idx` (`currency_name` ASC),
+  CONSTRAINT `fk_movements_user_id`
+      FOREIGN KEY (`user_id`)
+          REFERENCES `users` (`id`)
+          ON DELETE CASCADE
+          ON UPDATE CASCADE,
+  CONSTRAINT `fk_movements_exchange_id`
+      FOREIGN KEY (`exchange_id`)
+          REFERENCES `exchanges` (`id`),
+  CONSTRAINT `fk_movements_currency_name`
+      FOREIGN KEY (`currency_name`)
+          REFERENCES `currencies` (`name`));
+
+-- The rows keep their creation order, their ids are renumbered since each table had its own sequence.
+INSERT INTO `movements` (`mov_type`, `currency_name`, `date_created`, `tx_amount`, `total_amount`, `user_id`, `exchange_id`)
+SELECT m.mov_type, m.currency_name, m.date_created, m.tx_amount, m.total_amount, m.user_id, m.exchange_id FROM (
+  SELECT mov_type, 'ARS' AS currency_name, date_created, tx_amount, total_amount, user_id, exchange_id, id FROM `movements_ars`
+  UNION ALL
+  SELECT mov_type, 'BTC', date_created, tx_amount, total_amount, user_id, exchange_id, id FROM `movements_btc`
+  UNION ALL
+  SELECT mov_type, 'USDT', date_created, tx_amount, total_amount, user_id, exchange_id, id FROM `movements_usdt`
+) m ORDER BY m.date_created, m.currency_name, m.id;
+
+DROP TABLE `movements_ars`;
+DROP TABLE `movements_btc`;
+DROP TABLE `movements_usdt`;
+
+ALTER TABLE `currencies` DROP COLUMN `movements_table`;
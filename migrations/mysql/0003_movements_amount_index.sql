@@ -0,0 +1,2 @@
+-- Searches sorted by amount page through the movements of a user with this index.
+CREATE INDEX `user_id_tx_amount_idx` ON `movements` (`user_id` ASC, `tx_amount` ASC, `id` ASC);
@@ -0,0 +1,16 @@
+-- Long-lived credentials of the users. Only the sha256 of each key is stored.
+CREATE TABLE IF NOT EXISTS `api_keys` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `user_id` BIGINT NOT NULL,
+  `key_hash` CHAR(64) NOT NULL,
+  `scopes` VARCHAR(255) NOT NULL DEFAULT '',
+  `date_created` DATETIME NOT NULL DEFAULT current_timestamp,
+  `revoked_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `key_hash_UNIQUE` (`key_hash` ASC),
+  INDEX `user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_api_keys_user_id`
+      FOREIGN KEY (`user_id`)
+          REFERENCES `users` (`id`)
+          ON DELETE CASCADE
+          ON UPDATE CASCADE);
@@ -0,0 +1,9 @@
+-- A frozen wallet rejects every movement but the adjustments made by an admin.
+ALTER TABLE `users` ADD COLUMN `frozen` TINYINT(1) NOT NULL DEFAULT 0;
+
+-- Adjustments are manual corrections of a balance. They keep the admin who made them and the reason.
+ALTER TABLE `movements`
+  MODIFY COLUMN `mov_type` ENUM("deposit", "extract","init","transfer_in","transfer_out","exchange_in","exchange_out",
+    "adjustment_in","adjustment_out") NOT NULL,
+  ADD COLUMN `actor_id` BIGINT NULL,
+  ADD COLUMN `reason` VARCHAR(255) NULL;
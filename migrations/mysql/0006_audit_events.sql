@@ -0,0 +1,19 @@
+-- Append-only log of the state-changing operations. The events outlive their targets, so there are no foreign keys.
+CREATE TABLE IF NOT EXISTS `audit_events` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `actor_id` BIGINT NULL,
+  `action` VARCHAR(50) NOT NULL,
+  `target_type` VARCHAR(20) NOT NULL,
+  `target_id` BIGINT NOT NULL,
+  `request_id` VARCHAR(64) NULL,
+  `before_snapshot` JSON NULL,
+  `after_snapshot` JSON NULL,
+  `date_created` DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  INDEX `actor_id_idx` (`actor_id` ASC, `id` ASC),
+  INDEX `target_idx` (`target_type` ASC, `target_id` ASC, `id` ASC),
+  INDEX `date_created_idx` (`date_created` ASC));
+
+-- The events can only be inserted.
+CREATE TRIGGER `audit_events_no_update` BEFORE UPDATE ON `audit_events` FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
+CREATE TRIGGER `audit_events_no_delete` BEFORE DELETE ON `audit_events` FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
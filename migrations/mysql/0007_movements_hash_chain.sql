@@ -0,0 +1,7 @@
+-- Each movement hashes its content with the hash of the previous movement of the same user and currency, and the
+-- balance keeps the hash of the last one. Movements saved before this migration have no hash.
+ALTER TABLE `movements`
+  ADD COLUMN `hash` CHAR(64) NULL,
+  ADD INDEX `user_id_currency_name_idx` (`user_id` ASC, `currency_name` ASC, `id` ASC);
+
+ALTER TABLE `balances` ADD COLUMN `last_hash` CHAR(64) NULL;
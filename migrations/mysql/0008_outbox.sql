@@ -0,0 +1,10 @@
+-- Domain events saved in the transaction of the change that raised them, until the relay publishes them.
+CREATE TABLE IF NOT EXISTS `outbox` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `event_type` VARCHAR(50) NOT NULL,
+  `user_id` BIGINT NOT NULL,
+  `payload` JSON NOT NULL,
+  `date_created` DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  `published_at` DATETIME(6) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `published_at_idx` (`published_at` ASC, `id` ASC));
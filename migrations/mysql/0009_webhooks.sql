@@ -0,0 +1,37 @@
+-- Endpoints of the users notified of the movements of their wallet. The secret signs the notifications.
+CREATE TABLE IF NOT EXISTS `webhooks` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `user_id` BIGINT NOT NULL,
+  `url` VARCHAR(2048) NOT NULL,
+  `secret` VARCHAR(100) NOT NULL,
+  `date_created` DATETIME NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (`id`),
+  INDEX `user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_webhooks_user_id`
+      FOREIGN KEY (`user_id`)
+          REFERENCES `users` (`id`)
+          ON DELETE CASCADE
+          ON UPDATE CASCADE);
+
+-- Notifications of an outbox event to a webhook, retried until delivered or dead.
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `webhook_id` BIGINT NOT NULL,
+  `event_id` BIGINT NOT NULL,
+  `event_type` VARCHAR(50) NOT NULL,
+  `payload` JSON NOT NULL,
+  `status` ENUM('pending', 'delivered', 'dead') NOT NULL DEFAULT 'pending',
+  `attempts` INT NOT NULL DEFAULT 0,
+  `next_attempt_at` DATETIME(6) NOT NULL,
+  `last_attempt_at` DATETIME(6) NULL,
+  `response_status` INT NULL,
+  `last_error` VARCHAR(255) NULL,
+  `date_created` DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `webhook_event_UNIQUE` (`webhook_id` ASC, `event_id` ASC),
+  INDEX `status_next_attempt_idx` (`status` ASC, `next_attempt_at` ASC),
+  CONSTRAINT `fk_webhook_deliveries_webhook_id`
+      FOREIGN KEY (`webhook_id`)
+          REFERENCES `webhooks` (`id`)
+          ON DELETE CASCADE
+          ON UPDATE CASCADE);
@@ -0,0 +1,6 @@
+-- Idempotency keys are scoped to the caller that sent them, so two callers can use the same key. The keys saved
+-- before have no caller and are not replayed anymore.
+ALTER TABLE `idempotency_keys`
+  ADD COLUMN `caller_id` BIGINT NOT NULL DEFAULT 0 FIRST,
+  DROP PRIMARY KEY,
+  ADD PRIMARY KEY (`caller_id`, `idempotency_key`);
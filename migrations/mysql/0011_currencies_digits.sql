@@ -0,0 +1,2 @@
+-- The amounts are stored with 8 decimal places, so a currency with more digits would have its amounts rounded.
+ALTER TABLE `currencies` ADD CONSTRAINT `digits_CHECK` CHECK (`digits` <= 8);